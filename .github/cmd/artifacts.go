@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// distDir is where the build pipeline exports plugin artifacts, relative
+// to the repository root, as dist/<plugin>/<artifact>.
+const distDir = "dist"
+
+// goBuilderImage is the image the pipeline runs in, and plugins are
+// cross-compiled in. It is pinned by digest in imageLockFile, so that
+// rebuilding unchanged sources gives the same artifact checksums.
+const goBuilderImage = "golang:1.23"
+
+// artifactPlatforms are the GOOS/GOARCH pairs every plugin is built for.
+var artifactPlatforms = []string{
+	"linux/amd64",
+	"linux/arm64",
+	"darwin/amd64",
+	"darwin/arm64",
+	"windows/amd64",
+	"windows/arm64",
+}
+
+// Artifact is a packaged plugin build for one platform.
+type Artifact struct {
+	// Platform is GOOS/GOARCH, e.g. "linux/amd64".
+	Platform string
+	// Name is the file name of the package in the pipeline artifacts.
+	Name   string
+	Size   int64
+	SHA256 string
+}
+
+func (a Artifact) fields() map[string]interface{} {
+	return map[string]interface{}{
+		"platform": a.Platform,
+		"name":     a.Name,
+		"size":     a.Size,
+		"sha256":   a.SHA256,
+	}
+}
+
+// artifactName is the package file name of a plugin build, e.g.
+// "scmtea_1.0.0_linux_amd64.tar.gz".
+func artifactName(plugin, version, platform string) string {
+	return fmt.Sprintf("%s_%s_%s.tar.gz", plugin, version, strings.ReplaceAll(platform, "/", "_"))
+}
+
+// binaryName is the plugin executable inside a package.
+func binaryName(plugin, platform string) string {
+	if strings.HasPrefix(platform, "windows/") {
+		return plugin + ".exe"
+	}
+	return plugin
+}
+
+func getArtifacts(file, key string, value interface{}) ([]Artifact, error) {
+	tables, err := tableArray(file, key, value)
+	if err != nil {
+		return nil, err
+	}
+	var result []Artifact
+	for i, table := range tables {
+		var a Artifact
+		var err error
+		itemKey := fmt.Sprintf("%s[%d]", key, i)
+		if a.Platform, err = getString(file, itemKey, table, "platform"); err != nil {
+			return nil, err
+		}
+		if a.Name, err = getString(file, itemKey, table, "name"); err != nil {
+			return nil, err
+		}
+		if a.SHA256, err = getString(file, itemKey, table, "sha256"); err != nil {
+			return nil, err
+		}
+		size, ok := table.GetPath([]string{"size"}).(int64)
+		if !ok {
+			return nil, &CatalogError{File: file, Key: itemKey + ".size", Pos: table.GetPositionPath([]string{"size"}), Err: fmt.Errorf("expected an integer")}
+		}
+		a.Size = size
+		result = append(result, a)
+	}
+	return result, nil
+}
+
+// buildPlugin cross-compiles the plugin e for artifactPlatforms and
+// exports one package per platform to dist/<plugin>/. The manifest version
+// is injected into the plugin's main.version with -ldflags. Each package
+// holds the binary and the plugin files covered by its digest.
+func (s *daggerSteps) buildPlugin(ctx context.Context, e pipelineEntry) error {
+	builder := s.entryContainer(e)
+	ldflags := "-s -w -X main.version=" + e.Version
+	for _, platform := range artifactPlatforms {
+		goos, goarch, _ := strings.Cut(platform, "/")
+		stage := "/build/" + goos + "_" + goarch
+		fmt.Fprintf(s.progress, "Building %s %s for %s\n", e.Name, e.Version, platform)
+		builder = builder.
+			WithEnvVariable("GOOS", goos).
+			WithEnvVariable("GOARCH", goarch).
+			WithExec([]string{"go", "build", "-trimpath", "-buildvcs=false", "-ldflags", ldflags, "-o", stage + "/" + binaryName(e.Name, platform), "."}).
+			WithExec(append([]string{"cp", "--parents", "-t", stage}, e.Files...))
+		// Fixed ownership, timestamps and order keep packages reproducible.
+		builder = builder.WithExec([]string{"sh", "-c", fmt.Sprintf(
+			"mkdir -p /dist && tar --sort=name --mtime=@0 --owner=0 --group=0 --numeric-owner -C %s -cf - . | gzip -n > /dist/%s",
+			stage, artifactName(e.Name, e.Version, platform))})
+	}
+
+	out := filepath.Join(s.repoRoot, distDir, e.Name)
+	if _, err := builder.Directory("/dist").Export(ctx, out); err != nil {
+		return fmt.Errorf("failed to build plugin %s: %w", e.Name, err)
+	}
+	fmt.Fprintf(s.progress, "Exported artifacts for %s to %s\n", e.Name, out)
+	return nil
+}
+
+func isLocalReplace(replace string) bool {
+	return strings.HasPrefix(replace, "./") || strings.HasPrefix(replace, "../") || filepath.IsAbs(replace)
+}
+
+// updateArtifacts records the packages in dist/<plugin>/ for every plugin
+// of this repository. When a plugin was not built in this run, its
+// previous artifacts are kept as long as its digest did not change, and
+// dropped otherwise since they no longer match its sources.
+func updateArtifacts(w io.Writer, catalog, previous *Catalog, repoRoot string) error {
+	fmt.Fprintln(w, "Updating plugin artifacts...")
+	for _, name := range sortedKeys(catalog.Plugins) {
+		entry := &catalog.Plugins[name].Entry
+		dir := filepath.Join(repoRoot, distDir, name)
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			entry.Artifacts = nil
+			if old, ok := previous.Plugins[name]; ok && old.Digest == entry.Digest {
+				entry.Artifacts = old.Artifacts
+			}
+			fmt.Fprintf(w, "No new artifacts for %s, keeping %d\n", name, len(entry.Artifacts))
+			continue
+		}
+
+		var artifacts []Artifact
+		for _, platform := range artifactPlatforms {
+			a := Artifact{Platform: platform, Name: artifactName(name, entry.Version, platform)}
+			path := filepath.Join(dir, a.Name)
+			info, err := os.Stat(path)
+			if err != nil {
+				return fmt.Errorf("missing artifact for %s: %w", name, err)
+			}
+			a.Size = info.Size()
+			if a.SHA256, err = hashFile(path); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "Artifact %s: %d bytes, sha256 %s\n", a.Name, a.Size, a.SHA256)
+			artifacts = append(artifacts, a)
+		}
+		entry.Artifacts = artifacts
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTestArtifacts writes a package of plugin at version to dist/ for
+// every platform but skip, and returns the artifacts the catalog should
+// record for them.
+func writeTestArtifacts(t *testing.T, repoRoot, plugin, version, skip string) []Artifact {
+	t.Helper()
+	files := map[string]string{}
+	var artifacts []Artifact
+	for _, platform := range artifactPlatforms {
+		if platform == skip {
+			continue
+		}
+		name := artifactName(plugin, version, platform)
+		content := plugin + " " + version + " " + platform
+		files[distDir+"/"+plugin+"/"+name] = content
+		sum := sha256.Sum256([]byte(content))
+		artifacts = append(artifacts, Artifact{Platform: platform, Name: name, Size: int64(len(content)), SHA256: hex.EncodeToString(sum[:])})
+	}
+	writeTestFiles(t, repoRoot, files)
+	return artifacts
+}
+
+// artifactTestCatalog returns a catalog with the plugin scmtea at version
+// and digest, and the given artifacts.
+func artifactTestCatalog(version, digest string, artifacts []Artifact) *Catalog {
+	catalog := newCatalog()
+	catalog.Plugins["scmtea"] = &PluginEntry{Entry: Entry{Version: version, Path: "plugins/scmtea", Digest: digest, Artifacts: artifacts}}
+	return catalog
+}
+
+func TestUpdateArtifacts(t *testing.T) {
+	built := []Artifact{{Platform: "linux/amd64", Name: artifactName("scmtea", "1.0.0", "linux/amd64"), Size: 42, SHA256: "0123"}}
+	for _, tc := range []struct {
+		name string
+		// digest is the plugin's digest in this run, "sha256:a" before.
+		digest string
+		// build is the version packaged to dist/ in this run, if any.
+		build string
+		// want is ignored when build is set, which expects its packages.
+		want []Artifact
+	}{
+		{name: "unchanged digest keeps the artifacts", digest: "sha256:a", want: built},
+		{name: "changed digest drops the artifacts", digest: "sha256:b"},
+		{name: "changed digest records the rebuilt packages", digest: "sha256:b", build: "1.1.0"},
+		{name: "unchanged digest records the rebuilt packages", digest: "sha256:a", build: "1.0.0"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			repoRoot := t.TempDir()
+			version := "1.0.0"
+			want := tc.want
+			if tc.build != "" {
+				version = tc.build
+				want = writeTestArtifacts(t, repoRoot, "scmtea", version, "")
+			}
+			previous := artifactTestCatalog("1.0.0", "sha256:a", built)
+			catalog := artifactTestCatalog(version, tc.digest, nil)
+
+			if err := updateArtifacts(io.Discard, catalog, previous, repoRoot); err != nil {
+				t.Fatal(err)
+			}
+			got := catalog.Plugins["scmtea"].Artifacts
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("artifacts = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestUpdateArtifactsMissingPlatform(t *testing.T) {
+	repoRoot := t.TempDir()
+	writeTestArtifacts(t, repoRoot, "scmtea", "1.0.0", "windows/arm64")
+	catalog := artifactTestCatalog("1.0.0", "sha256:a", nil)
+
+	err := updateArtifacts(io.Discard, catalog, newCatalog(), repoRoot)
+	if err == nil || !strings.Contains(err.Error(), "missing artifact for scmtea") || !strings.Contains(err.Error(), "windows_arm64") {
+		t.Errorf("err = %v, want the missing windows/arm64 package", err)
+	}
+}
+
+func TestArtifactsRoundTrip(t *testing.T) {
+	content := `[catalog]
+name = "Test"
+description = "Test"
+version = "1.0.0"
+
+[plugins.scmtea]
+version = "1.0.0"
+description = "Gitea integration"
+path = "plugins/scmtea"
+
+[[plugins.scmtea.artifacts]]
+platform = "linux/amd64"
+name = "scmtea_1.0.0_linux_amd64.tar.gz"
+size = 1024
+sha256 = "0123"
+
+[[plugins.scmtea.artifacts]]
+platform = "windows/arm64"
+name = "scmtea_1.0.0_windows_arm64.tar.gz"
+size = 2048
+sha256 = "4567"
+`
+	// The writer puts arrays of tables inline; roundTrip checks that the
+	// artifacts read back the same either way.
+	catalog, _ := roundTrip(t, "artifacts", []byte(content))
+	want := []Artifact{
+		{Platform: "linux/amd64", Name: "scmtea_1.0.0_linux_amd64.tar.gz", Size: 1024, SHA256: "0123"},
+		{Platform: "windows/arm64", Name: "scmtea_1.0.0_windows_arm64.tar.gz", Size: 2048, SHA256: "4567"},
+	}
+	if got := catalog.Plugins["scmtea"].Artifacts; !reflect.DeepEqual(got, want) {
+		t.Errorf("artifacts = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,620 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+)
+
+const (
+	defaultCatalogName        = "Gitspace Official Catalog"
+	defaultCatalogDescription = "Official catalog of plugins and templates for Gitspace"
+	defaultCatalogVersion     = "0.1.0"
+)
+
+// Catalog is the typed model of gitspace-catalog.toml.
+type Catalog struct {
+	Info      CatalogInfo
+	Plugins   map[string]*PluginEntry
+	Templates map[string]*TemplateEntry
+
+	// Extra holds top-level keys the updater does not manage, so that
+	// they survive a load/save round trip.
+	Extra map[string]interface{}
+
+	// comments holds the comment lines that directly follow each table
+	// header, keyed by the header (see parseHeaderComments).
+	comments map[string][]string
+}
+
+// CatalogInfo is the [catalog] section.
+type CatalogInfo struct {
+	Name        string
+	Description string
+	Version     string
+	LastUpdated *LastUpdated
+
+	// VersionPolicy selects how Version is bumped: "semver" (the default)
+	// or "calver".
+	VersionPolicy string
+
+	// NestedCategories enables plugins/<category>/<name> discovery.
+	NestedCategories bool
+
+	// Includes are other catalogs merged into this one, keyed by a name
+	// that is recorded as the origin of their entries.
+	Includes map[string]Include
+
+	Extra map[string]interface{}
+}
+
+// Include is a single [catalog.includes] item. It is written either as
+// name = "path" or as name = { path = "...", conflict = "...", source = "..." }.
+type Include struct {
+	// Path is a catalog file, or a checkout containing
+	// gitspace-catalog.toml, relative to the repository root.
+	Path string
+	// Conflict is the conflict policy for entries that already exist,
+	// see conflictPolicies. Empty means "local".
+	Conflict string
+	// Source is the module path the included catalog is published at,
+	// such as github.com/ssotops/catalog. Install snippets of its entries
+	// point there.
+	Source string
+}
+
+// LastUpdated is the catalog.last_updated inline table.
+type LastUpdated struct {
+	Date       string
+	CommitHash string
+}
+
+// Entry holds the fields shared by plugin and template entries.
+type Entry struct {
+	Version     string
+	Description string
+	Path        string
+
+	// CommitHash and CommitDate identify the last commit that touched
+	// Path. CommitDate is RFC 3339 in UTC.
+	CommitHash string
+	CommitDate string
+
+	// Digest is the sha256 content digest computed by computeDigest.
+	Digest string
+
+	// Origin is the name of the included catalog the entry was merged
+	// from, or empty for entries of this repository. Path, CommitHash,
+	// CommitDate and Digest of included entries refer to their origin.
+	Origin string
+
+	// Source is the module path of the catalog an included entry is
+	// installed from, taken from the source of its include. It is empty
+	// for entries of this repository and when the include has no source.
+	Source string
+
+	Metadata
+
+	// Resolved maps each key in Requires to the version of the entry it
+	// resolved to, see resolveDependencies.
+	Resolved map[string]string
+
+	// Compatibility is nil when the entry has no go.mod and declares no
+	// min_gitspace_version.
+	Compatibility *Compatibility
+
+	// Verification is the outcome of building and testing the entry in
+	// the pipeline, nil when it was never verified.
+	Verification *Verification
+
+	// Artifacts are the packaged builds of a plugin, one per platform.
+	Artifacts []Artifact
+
+	Extra map[string]interface{}
+}
+
+// Compatibility is the [<kind>.<name>.compatibility] table. It lets the
+// gitspace CLI refuse entries built for an incompatible host.
+type Compatibility struct {
+	// Go is the go directive of the entry's go.mod.
+	Go string
+	// SDK is the version of pluginSDKModule the entry requires.
+	SDK string
+	// SDKReplace is the replace target of pluginSDKModule, if any. A local
+	// directory means SDK does not identify the code that is built.
+	SDKReplace string
+	// MinGitspaceVersion is the manifest's min_gitspace_version.
+	MinGitspaceVersion string
+}
+
+func (c Compatibility) fields() tomlTable {
+	var kv tomlTable
+	for _, f := range []keyValue{
+		{"go", c.Go},
+		{"sdk", c.SDK},
+		{"sdk_replace", c.SDKReplace},
+		{"min_gitspace_version", c.MinGitspaceVersion},
+	} {
+		if f.Value != "" {
+			kv = append(kv, f)
+		}
+	}
+	return kv
+}
+
+// PluginEntry is a single [plugins.<name>] table.
+type PluginEntry struct {
+	Entry
+}
+
+// TemplateEntry is a single [templates.<name>] table.
+type TemplateEntry struct {
+	Entry
+}
+
+// CatalogError reports a catalog file that cannot be parsed or whose
+// contents do not match the expected schema.
+type CatalogError struct {
+	File string
+	Key  string
+	Pos  toml.Position
+	Err  error
+}
+
+func (e *CatalogError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(e.File)
+	if !e.Pos.Invalid() {
+		sb.WriteString(fmt.Sprintf(":%d:%d", e.Pos.Line, e.Pos.Col))
+	}
+	if e.Key != "" {
+		sb.WriteString(fmt.Sprintf(": %s", e.Key))
+	}
+	sb.WriteString(fmt.Sprintf(": %v", e.Err))
+	return sb.String()
+}
+
+func (e *CatalogError) Unwrap() error {
+	return e.Err
+}
+
+func newCatalog() *Catalog {
+	return &Catalog{
+		Info: CatalogInfo{
+			Name:        defaultCatalogName,
+			Description: defaultCatalogDescription,
+			Version:     defaultCatalogVersion,
+		},
+		Plugins:   make(map[string]*PluginEntry),
+		Templates: make(map[string]*TemplateEntry),
+	}
+}
+
+func loadCatalog(w io.Writer, path string) (*Catalog, error) {
+	fmt.Fprintf(w, "Attempting to load catalog from: %s\n", path)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		fmt.Fprintln(w, "Catalog file does not exist, creating a new one")
+		return newCatalog(), nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading catalog file: %w", err)
+	}
+	fmt.Fprintf(w, "Loaded catalog content:\n%s\n", string(content))
+	return parseCatalog(path, content)
+}
+
+// readCatalog is loadCatalog without the progress output, for commands
+// that only need the catalog configuration.
+func readCatalog(path string) (*Catalog, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return newCatalog(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading catalog file: %w", err)
+	}
+	return parseCatalog(path, content)
+}
+
+// parseCatalog decodes catalog content. path is only used for error
+// reporting.
+func parseCatalog(path string, content []byte) (*Catalog, error) {
+	tree, err := toml.LoadBytes(content)
+	if err != nil {
+		return nil, &CatalogError{File: path, Err: err}
+	}
+
+	catalog := &Catalog{
+		Plugins:   make(map[string]*PluginEntry),
+		Templates: make(map[string]*TemplateEntry),
+		comments:  parseHeaderComments(content),
+	}
+
+	for _, key := range tree.Keys() {
+		switch key {
+		case "catalog":
+			section, err := getTable(path, tree, key)
+			if err != nil {
+				return nil, err
+			}
+			if err := decodeCatalogInfo(path, section, &catalog.Info); err != nil {
+				return nil, err
+			}
+		case "plugins":
+			section, err := getTable(path, tree, key)
+			if err != nil {
+				return nil, err
+			}
+			for _, name := range section.Keys() {
+				entry, err := decodeEntry(path, "plugins."+name, section, name)
+				if err != nil {
+					return nil, err
+				}
+				catalog.Plugins[name] = &PluginEntry{Entry: entry}
+			}
+		case "templates":
+			section, err := getTable(path, tree, key)
+			if err != nil {
+				return nil, err
+			}
+			for _, name := range section.Keys() {
+				entry, err := decodeEntry(path, "templates."+name, section, name)
+				if err != nil {
+					return nil, err
+				}
+				catalog.Templates[name] = &TemplateEntry{Entry: entry}
+			}
+		default:
+			catalog.setExtra(key, toGoValue(tree.GetPath([]string{key})))
+		}
+	}
+
+	return catalog, nil
+}
+
+func decodeCatalogInfo(file string, section *toml.Tree, info *CatalogInfo) error {
+	for _, key := range section.Keys() {
+		var err error
+		switch key {
+		case "name":
+			info.Name, err = getString(file, "catalog", section, key)
+		case "description":
+			info.Description, err = getString(file, "catalog", section, key)
+		case "version":
+			info.Version, err = getString(file, "catalog", section, key)
+		case "version_policy":
+			info.VersionPolicy, err = getString(file, "catalog", section, key)
+		case "nested_categories":
+			info.NestedCategories, err = getBool(file, "catalog", section, key)
+		case "includes":
+			var includes *toml.Tree
+			includes, err = getTable(file, section, key)
+			if err == nil {
+				info.Includes, err = decodeIncludes(file, includes)
+			}
+		case "last_updated":
+			var lu *toml.Tree
+			lu, err = getTable(file, section, key)
+			if err == nil {
+				info.LastUpdated, err = decodeLastUpdated(file, lu)
+			}
+		default:
+			if info.Extra == nil {
+				info.Extra = make(map[string]interface{})
+			}
+			info.Extra[key] = toGoValue(section.GetPath([]string{key}))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeLastUpdated(file string, section *toml.Tree) (*LastUpdated, error) {
+	lu := &LastUpdated{}
+	var err error
+	if section.Has("date") {
+		if lu.Date, err = getString(file, "catalog.last_updated", section, "date"); err != nil {
+			return nil, err
+		}
+	}
+	if section.Has("commit_hash") {
+		if lu.CommitHash, err = getString(file, "catalog.last_updated", section, "commit_hash"); err != nil {
+			return nil, err
+		}
+	}
+	return lu, nil
+}
+
+func decodeCompatibility(file, fullKey string, section *toml.Tree) (*Compatibility, error) {
+	compat := &Compatibility{}
+	for _, f := range []struct {
+		key string
+		dst *string
+	}{
+		{"go", &compat.Go},
+		{"sdk", &compat.SDK},
+		{"sdk_replace", &compat.SDKReplace},
+		{"min_gitspace_version", &compat.MinGitspaceVersion},
+	} {
+		if section.Has(f.key) {
+			var err error
+			if *f.dst, err = getString(file, fullKey, section, f.key); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return compat, nil
+}
+
+func decodeIncludes(file string, section *toml.Tree) (map[string]Include, error) {
+	includes := make(map[string]Include)
+	for _, name := range section.Keys() {
+		fullKey := "catalog.includes." + name
+		var inc Include
+		switch value := section.GetPath([]string{name}).(type) {
+		case string:
+			inc.Path = value
+		case *toml.Tree:
+			var err error
+			if inc.Path, err = getString(file, fullKey, value, "path"); err != nil {
+				return nil, err
+			}
+			if value.Has("conflict") {
+				if inc.Conflict, err = getString(file, fullKey, value, "conflict"); err != nil {
+					return nil, err
+				}
+			}
+			if value.Has("source") {
+				if inc.Source, err = getString(file, fullKey, value, "source"); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			return nil, &CatalogError{File: file, Key: fullKey, Pos: section.GetPositionPath([]string{name}), Err: fmt.Errorf("expected a path or a table, got %T", value)}
+		}
+		includes[name] = inc
+	}
+	return includes, nil
+}
+
+func decodeEntry(file, fullKey string, parent *toml.Tree, name string) (Entry, error) {
+	var entry Entry
+	section, ok := parent.GetPath([]string{name}).(*toml.Tree)
+	if !ok {
+		return entry, &CatalogError{File: file, Key: fullKey, Pos: parent.GetPositionPath([]string{name}), Err: fmt.Errorf("expected a table, got %T", parent.GetPath([]string{name}))}
+	}
+	for _, key := range section.Keys() {
+		var err error
+		switch key {
+		case "version":
+			entry.Version, err = getString(file, fullKey, section, key)
+		case "description":
+			entry.Description, err = getString(file, fullKey, section, key)
+		case "path":
+			entry.Path, err = getString(file, fullKey, section, key)
+		case "commit_hash":
+			entry.CommitHash, err = getString(file, fullKey, section, key)
+		case "commit_date":
+			entry.CommitDate, err = getString(file, fullKey, section, key)
+		case "digest":
+			entry.Digest, err = getString(file, fullKey, section, key)
+		case "origin":
+			entry.Origin, err = getString(file, fullKey, section, key)
+		case "source":
+			entry.Source, err = getString(file, fullKey, section, key)
+		case "resolved":
+			entry.Resolved, err = getEntryKeyMap(file, section, key)
+		case "compatibility":
+			var table *toml.Tree
+			table, err = getTable(file, section, key)
+			if err == nil {
+				entry.Compatibility, err = decodeCompatibility(file, fullKey+"."+key, table)
+			}
+		case "verification":
+			var table *toml.Tree
+			table, err = getTable(file, section, key)
+			if err == nil {
+				entry.Verification, err = decodeVerification(file, fullKey+"."+key, table)
+			}
+		case "artifacts":
+			entry.Artifacts, err = getArtifacts(file, fullKey+"."+key, section.GetPath([]string{key}))
+		default:
+			var handled bool
+			if handled, err = decodeMetadataField(file, fullKey, section, key, &entry.Metadata); handled {
+				break
+			}
+			if entry.Extra == nil {
+				entry.Extra = make(map[string]interface{})
+			}
+			entry.Extra[key] = toGoValue(section.GetPath([]string{key}))
+		}
+		if err != nil {
+			return entry, err
+		}
+	}
+	// Without a version and a path an entry can be neither compared
+	// nor installed.
+	for _, key := range []string{"version", "path"} {
+		if !section.Has(key) {
+			return entry, &CatalogError{File: file, Key: fullKey + "." + key, Pos: section.Position(), Err: fmt.Errorf("missing required field")}
+		}
+	}
+	return entry, nil
+}
+
+func getTable(file string, tree *toml.Tree, key string) (*toml.Tree, error) {
+	section, ok := tree.GetPath([]string{key}).(*toml.Tree)
+	if !ok {
+		return nil, &CatalogError{File: file, Key: key, Pos: tree.GetPositionPath([]string{key}), Err: fmt.Errorf("expected a table, got %T", tree.GetPath([]string{key}))}
+	}
+	return section, nil
+}
+
+func getString(file, section string, tree *toml.Tree, key string) (string, error) {
+	value := tree.GetPath([]string{key})
+	s, ok := value.(string)
+	if !ok {
+		return "", &CatalogError{File: file, Key: section + "." + key, Pos: tree.GetPositionPath([]string{key}), Err: fmt.Errorf("expected a string, got %T", value)}
+	}
+	return s, nil
+}
+
+func getBool(file, section string, tree *toml.Tree, key string) (bool, error) {
+	value := tree.GetPath([]string{key})
+	b, ok := value.(bool)
+	if !ok {
+		return false, &CatalogError{File: file, Key: section + "." + key, Pos: tree.GetPositionPath([]string{key}), Err: fmt.Errorf("expected a boolean, got %T", value)}
+	}
+	return b, nil
+}
+
+// toGoValue converts go-toml values into plain Go values so they can be
+// kept in Extra maps without holding on to the parse tree.
+func toGoValue(v interface{}) interface{} {
+	switch node := v.(type) {
+	case *toml.Tree:
+		return node.ToMap()
+	case []*toml.Tree:
+		array := make([]interface{}, 0, len(node))
+		for _, item := range node {
+			array = append(array, item.ToMap())
+		}
+		return array
+	default:
+		return v
+	}
+}
+
+// fields returns the entry as TOML key/value pairs in the order they are
+// written to the catalog, leaving out empty fields. Unmanaged keys follow
+// in name order.
+func (e Entry) fields() []keyValue {
+	kv := []keyValue{
+		{"version", e.Version},
+		{"description", e.Description},
+		{"path", e.Path},
+	}
+	if e.CommitHash != "" {
+		kv = append(kv, keyValue{"commit_hash", e.CommitHash}, keyValue{"commit_date", e.CommitDate})
+	}
+	if e.Digest != "" {
+		kv = append(kv, keyValue{"digest", e.Digest})
+	}
+	if e.Origin != "" {
+		kv = append(kv, keyValue{"origin", e.Origin})
+	}
+	if e.Source != "" {
+		kv = append(kv, keyValue{"source", e.Source})
+	}
+	kv = append(kv, e.Metadata.fields()...)
+	if len(e.Resolved) > 0 {
+		kv = append(kv, keyValue{"resolved", stringMapValue(e.Resolved)})
+	}
+	if e.Compatibility != nil {
+		kv = append(kv, keyValue{"compatibility", e.Compatibility.fields()})
+	}
+	if e.Verification != nil {
+		kv = append(kv, keyValue{"verification", e.Verification.fields()})
+	}
+	if len(e.Artifacts) > 0 {
+		artifacts := make([]interface{}, 0, len(e.Artifacts))
+		for _, a := range e.Artifacts {
+			artifacts = append(artifacts, a.fields())
+		}
+		kv = append(kv, keyValue{"artifacts", artifacts})
+	}
+	for _, k := range sortedKeys(e.Extra) {
+		kv = append(kv, keyValue{k, e.Extra[k]})
+	}
+	return kv
+}
+
+// fields returns the [catalog] section as TOML key/value pairs in the
+// order they are written, leaving out unset options. Unmanaged keys follow
+// in name order.
+func (info CatalogInfo) fields() []keyValue {
+	kv := []keyValue{
+		{"name", info.Name},
+		{"description", info.Description},
+		{"version", info.Version},
+	}
+	if info.VersionPolicy != "" {
+		kv = append(kv, keyValue{"version_policy", info.VersionPolicy})
+	}
+	if info.NestedCategories {
+		kv = append(kv, keyValue{"nested_categories", true})
+	}
+	if lu := info.LastUpdated; lu != nil {
+		kv = append(kv, keyValue{"last_updated", []keyValue{
+			{"date", lu.Date},
+			{"commit_hash", lu.CommitHash},
+		}})
+	}
+	for _, k := range sortedKeys(info.Extra) {
+		kv = append(kv, keyValue{k, info.Extra[k]})
+	}
+	if len(info.Includes) > 0 {
+		var includes tomlTable
+		for _, name := range sortedKeys(info.Includes) {
+			inc := info.Includes[name]
+			if inc.Conflict == "" && inc.Source == "" {
+				includes = append(includes, keyValue{name, inc.Path})
+				continue
+			}
+			table := []keyValue{{"path", inc.Path}}
+			if inc.Conflict != "" {
+				table = append(table, keyValue{"conflict", inc.Conflict})
+			}
+			if inc.Source != "" {
+				table = append(table, keyValue{"source", inc.Source})
+			}
+			includes = append(includes, keyValue{name, table})
+		}
+		kv = append(kv, keyValue{"includes", includes})
+	}
+	return kv
+}
+
+// forEachEntry calls fn for every plugin and then every template entry, in
+// name order. key is the entry's table name, e.g. "plugins.scmtea".
+func (c *Catalog) forEachEntry(fn func(key string, entry *Entry) error) error {
+	for _, name := range sortedKeys(c.Plugins) {
+		if err := fn("plugins."+name, &c.Plugins[name].Entry); err != nil {
+			return err
+		}
+	}
+	for _, name := range sortedKeys(c.Templates) {
+		if err := fn("templates."+name, &c.Templates[name].Entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Catalog) setExtra(key string, value interface{}) {
+	if c.Extra == nil {
+		c.Extra = make(map[string]interface{})
+	}
+	c.Extra[key] = value
+}
+
+// Save renders the catalog and writes it to path.
+func (c *Catalog) Save(w io.Writer, path string) error {
+	return saveCatalog(w, formatTomlTree(c), path)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
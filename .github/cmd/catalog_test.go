@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCatalogErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		content string
+		// key is the CatalogError's key, empty for TOML syntax errors.
+		key  string
+		want string
+	}{
+		{
+			name:    "syntax error",
+			content: "[catalog\nname = \"Test\"\n",
+			want:    "test.toml: (1, 2): unexpected token",
+		},
+		{
+			name:    "catalog field of the wrong type",
+			content: "[catalog]\nname = \"Test\"\nversion = 1\n",
+			key:     "catalog.version",
+			want:    "test.toml:3:1: catalog.version: expected a string, got int64",
+		},
+		{
+			name:    "catalog option of the wrong type",
+			content: "[catalog]\nnested_categories = \"yes\"\n",
+			key:     "catalog.nested_categories",
+			want:    "test.toml:2:1: catalog.nested_categories: expected a boolean, got string",
+		},
+		{
+			name:    "entry field of the wrong type",
+			content: "[plugins.scmtea]\nversion = \"1.0.0\"\npath = \"plugins/scmtea\"\ndigest = [\"sha256:0123\"]\n",
+			key:     "plugins.scmtea.digest",
+			want:    "test.toml:4:1: plugins.scmtea.digest: expected a string, got []interface {}",
+		},
+		{
+			name:    "entry that is not a table",
+			content: "[templates]\nstarter = \"templates/starter\"\n",
+			key:     "templates.starter",
+			want:    "test.toml:2:1: templates.starter: expected a table, got string",
+		},
+		{
+			name:    "entry without a version",
+			content: "[catalog]\nname = \"Test\"\n\n[plugins.scmtea]\ndescription = \"Gitea integration\"\npath = \"plugins/scmtea\"\n",
+			key:     "plugins.scmtea.version",
+			want:    "test.toml:4:1: plugins.scmtea.version: missing required field",
+		},
+		{
+			name:    "entry without a path",
+			content: "[templates.starter]\nversion = \"0.1.0\"\n",
+			key:     "templates.starter.path",
+			want:    "test.toml:1:1: templates.starter.path: missing required field",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseCatalog("test.toml", []byte(tc.content))
+			var catalogErr *CatalogError
+			if !errors.As(err, &catalogErr) {
+				t.Fatalf("err = %v, want a *CatalogError", err)
+			}
+			if catalogErr.File != "test.toml" || catalogErr.Key != tc.key {
+				t.Errorf("error is for %s %q, want test.toml %q", catalogErr.File, catalogErr.Key, tc.key)
+			}
+			if !strings.HasPrefix(err.Error(), tc.want) {
+				t.Errorf("err = %q, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseCatalogKeepsUnknownKeys(t *testing.T) {
+	content := `mirror = "https://mirror.example.com"
+
+[catalog]
+name = "Test"
+description = "Test catalog"
+version = "1.0.0"
+maintainer = "ops"
+
+[catalog.review]
+approvals = 2
+
+[plugins.scmtea]
+version = "1.0.0"
+description = "Gitea integration"
+path = "plugins/scmtea"
+stability = "beta"
+
+[plugins.scmtea.ci]
+runner = "ubuntu-latest"
+
+[templates.starter]
+version = "0.1.0"
+description = "Starter template"
+path = "templates/starter"
+featured = true
+
+[mirrors.backup]
+url = "https://backup.example.com"
+`
+	catalog, formatted := roundTrip(t, "unknown", []byte(content))
+
+	for _, tc := range []struct {
+		level string
+		got   map[string]interface{}
+		want  map[string]interface{}
+	}{
+		{"catalog", catalog.Extra, map[string]interface{}{
+			"mirror":  "https://mirror.example.com",
+			"mirrors": map[string]interface{}{"backup": map[string]interface{}{"url": "https://backup.example.com"}},
+		}},
+		{"[catalog]", catalog.Info.Extra, map[string]interface{}{
+			"maintainer": "ops",
+			"review":     map[string]interface{}{"approvals": int64(2)},
+		}},
+		{"plugin entry", catalog.Plugins["scmtea"].Extra, map[string]interface{}{
+			"stability": "beta",
+			"ci":        map[string]interface{}{"runner": "ubuntu-latest"},
+		}},
+		{"template entry", catalog.Templates["starter"].Extra, map[string]interface{}{
+			"featured": true,
+		}},
+	} {
+		if !reflect.DeepEqual(tc.got, tc.want) {
+			t.Errorf("unknown keys of the %s = %#v, want %#v", tc.level, tc.got, tc.want)
+		}
+	}
+	for _, want := range []string{"maintainer = \"ops\"", "stability = \"beta\"", "featured = true", "https://backup.example.com"} {
+		if !strings.Contains(formatted, want) {
+			t.Errorf("formatted catalog is missing %q:\n%s", want, formatted)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	changelogFile = "CHANGELOG.md"
+	historyFile   = "gitspace-catalog-history.jsonl"
+
+	changelogHeader = "# Catalog Changelog\n\nThis file is automatically updated by the GitHub Action whenever catalog entries change.\n"
+)
+
+// HistoryRecord is one line of gitspace-catalog-history.jsonl.
+type HistoryRecord struct {
+	Version         string          `json:"version"`
+	PreviousVersion string          `json:"previous_version"`
+	Date            string          `json:"date"`
+	CommitHash      string          `json:"commit_hash"`
+	Changes         []HistoryChange `json:"changes"`
+}
+
+// HistoryChange is one entry change within a HistoryRecord.
+type HistoryChange struct {
+	Key    string        `json:"key"`
+	Type   ChangeType    `json:"type"`
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+func newHistoryRecord(previousVersion string, catalog *Catalog, diff CatalogDiff) HistoryRecord {
+	record := HistoryRecord{
+		Version:         catalog.Info.Version,
+		PreviousVersion: previousVersion,
+	}
+	if lu := catalog.Info.LastUpdated; lu != nil {
+		record.Date = lu.Date
+		record.CommitHash = lu.CommitHash
+	}
+	for _, c := range diff.Changes {
+		record.Changes = append(record.Changes, HistoryChange{Key: c.Key, Type: c.Type, Fields: c.Fields})
+	}
+	return record
+}
+
+// renderChangelogEntry renders the changelog section for one catalog
+// release.
+func renderChangelogEntry(record HistoryRecord, diff CatalogDiff) string {
+	var added, removed, reversioned, redescribed, other []string
+	for _, c := range diff.Changes {
+		switch c.Type {
+		case ChangeAdded:
+			added = append(added, fmt.Sprintf("- `%s` %s: %s", c.Key, c.New.Version, c.New.Description))
+		case ChangeRemoved:
+			removed = append(removed, fmt.Sprintf("- `%s` %s", c.Key, c.Old.Version))
+		case ChangeUpdated:
+			var rest []string
+			for _, f := range c.Fields {
+				switch f.Field {
+				case "version":
+					reversioned = append(reversioned, fmt.Sprintf("- `%s`: %s → %s", c.Key, c.Old.Version, c.New.Version))
+				case "description":
+					redescribed = append(redescribed, fmt.Sprintf("- `%s`: %s", c.Key, c.New.Description))
+				default:
+					rest = append(rest, f.Field)
+				}
+			}
+			if len(rest) > 0 {
+				other = append(other, fmt.Sprintf("- `%s`: %s", c.Key, strings.Join(rest, ", ")))
+			}
+		}
+	}
+
+	var sb strings.Builder
+	date := record.Date
+	if len(date) >= len("2006-01-02") {
+		date = date[:len("2006-01-02")]
+	}
+	sb.WriteString(fmt.Sprintf("## %s - %s\n", record.Version, date))
+	for _, section := range []struct {
+		title string
+		lines []string
+	}{
+		{"Added", added},
+		{"Removed", removed},
+		{"New versions", reversioned},
+		{"New descriptions", redescribed},
+		{"Other changes", other},
+	} {
+		if len(section.lines) == 0 {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("\n### %s\n\n%s\n", section.title, strings.Join(section.lines, "\n")))
+	}
+	return sb.String()
+}
+
+// updateChangelog adds the entry for this release to CHANGELOG.md in dir,
+// newest first, and appends its record to the history file.
+func updateChangelog(w io.Writer, dir string, record HistoryRecord, diff CatalogDiff) error {
+	fmt.Fprintln(w, "Updating changelog...")
+	changelogPath := filepath.Join(dir, changelogFile)
+	existing, err := os.ReadFile(changelogPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error reading changelog: %w", err)
+	}
+
+	body := strings.TrimPrefix(string(existing), changelogHeader)
+	content := changelogHeader + "\n" + renderChangelogEntry(record, diff)
+	if body = strings.TrimLeft(body, "\n"); body != "" {
+		content += "\n" + body
+	}
+	if err := os.WriteFile(changelogPath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("error writing changelog: %w", err)
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error encoding history record: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, historyFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening history file: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error writing history file: %w", err)
+	}
+
+	fmt.Fprintf(w, "Changelog updated for version %s\n", record.Version)
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpdateChangelogPutsNewestFirst(t *testing.T) {
+	dir := t.TempDir()
+	releases := []struct {
+		record HistoryRecord
+		diff   CatalogDiff
+	}{
+		{
+			HistoryRecord{Version: "1.1.0", PreviousVersion: "1.0.0", Date: "2024-10-01T10:00:00Z", CommitHash: "aaa"},
+			CatalogDiff{Changes: []EntryChange{{Key: "plugins.scmtea", Type: ChangeAdded, New: &Entry{Version: "1.0.0", Description: "Gitea"}}}},
+		},
+		{
+			HistoryRecord{Version: "1.1.1", PreviousVersion: "1.1.0", Date: "2024-10-02T10:00:00Z", CommitHash: "bbb"},
+			CatalogDiff{Changes: []EntryChange{{
+				Key: "plugins.scmtea", Type: ChangeUpdated,
+				Old:    &Entry{Version: "1.0.0"},
+				New:    &Entry{Version: "1.1.0"},
+				Fields: []FieldChange{{Field: "version", Old: "1.0.0", New: "1.1.0"}},
+			}}},
+		},
+	}
+
+	var historyAfterFirst []byte
+	for i, r := range releases {
+		if err := updateChangelog(io.Discard, dir, r.record, r.diff); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			var err error
+			if historyAfterFirst, err = os.ReadFile(filepath.Join(dir, historyFile)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	changelog, err := os.ReadFile(filepath.Join(dir, changelogFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(changelog)
+	if !strings.HasPrefix(content, changelogHeader) {
+		t.Errorf("changelog does not start with its header:\n%s", content)
+	}
+	if strings.Count(content, changelogHeader) != 1 {
+		t.Errorf("header repeated:\n%s", content)
+	}
+	newest := strings.Index(content, "## 1.1.1 - 2024-10-02")
+	oldest := strings.Index(content, "## 1.1.0 - 2024-10-01")
+	if newest < 0 || oldest < 0 || newest > oldest {
+		t.Errorf("sections are not newest first:\n%s", content)
+	}
+	if !strings.Contains(content, "- `plugins.scmtea`: 1.0.0 → 1.1.0") {
+		t.Errorf("version change missing:\n%s", content)
+	}
+
+	history, err := os.ReadFile(filepath.Join(dir, historyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(history), string(historyAfterFirst)) {
+		t.Errorf("history was rewritten instead of appended:\nbefore:\n%s\nafter:\n%s", historyAfterFirst, history)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(history), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("history has %d lines, want 2:\n%s", len(lines), history)
+	}
+	for i, line := range lines {
+		var record HistoryRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("line %d: %v", i+1, err)
+		}
+		if record.Version != releases[i].record.Version {
+			t.Errorf("line %d is version %s, want %s", i+1, record.Version, releases[i].record.Version)
+		}
+	}
+}
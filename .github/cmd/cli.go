@@ -0,0 +1,634 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ssotops/gitspace-catalog/catalogsig"
+)
+
+const usage = `usage: go run ./cmd <command> [flags]
+
+Commands:
+  update      Regenerate the catalog and the files generated with it
+  validate    Check every plugin and template manifest
+  discover    List the plugin and template directories found in the repository
+  diff        Show what update would change, without writing anything
+  check       Fail if the catalog is not up to date
+  publish     Push the catalog and its generated files, or open a pull request
+  list        List the catalog entries
+  verify      Verify entry digests, and optionally the signature and artifacts
+  site        Render the catalog as a static website
+  keygen      Generate a catalog signing key pair
+  pin-images  Pin the images of the Dagger pipeline by digest
+  pipeline    Build, test, update and render in Dagger, then publish (default)
+
+Every command accepts -repo, -catalog, -branch and -format. Run
+"go run ./cmd <command> -h" for the flags of a command.
+`
+
+const (
+	formatText = "text"
+	formatJSON = "json"
+
+	defaultBranch = "master"
+)
+
+// cliOptions are the flags shared by every command.
+type cliOptions struct {
+	// RepoRoot is the repository the entries are discovered in.
+	RepoRoot string
+	// CatalogPath is the catalog file. The files generated with it are
+	// written to the same directory.
+	CatalogPath string
+	// Branch is the branch the catalog is published to.
+	Branch string
+	// Format is the output format, formatText or formatJSON.
+	Format string
+
+	// stdout receives the result of a command.
+	stdout io.Writer
+	// progress receives the progress messages of a command. It is stdout
+	// in text format, and stderr in JSON format so that stdout holds only
+	// the result.
+	progress io.Writer
+}
+
+func main() {
+	command := "pipeline"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	var err error
+	switch command {
+	case "update":
+		err = updateCommand(args)
+	case "validate":
+		err = validateCommand(args)
+	case "discover":
+		err = discoverCommand(args)
+	case "diff":
+		err = diffCommand(args)
+	case "check":
+		err = checkCommand(args)
+	case "publish":
+		err = publishCommand(args)
+	case "list":
+		err = listCommand(args)
+	case "verify":
+		err = verifyCommand(args)
+	case "site":
+		err = siteCommand(args)
+	case "keygen":
+		err = keygenCommand(args)
+	case "pin-images":
+		err = pinImagesCommand(args)
+	case "pipeline":
+		err = pipelineCommand(args)
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// newFlagSet returns the flag set of a command with the shared flags
+// defined on opts.
+func newFlagSet(name string) (*flag.FlagSet, *cliOptions) {
+	opts := &cliOptions{}
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.StringVar(&opts.RepoRoot, "repo", "", "repository root (default: found from the working directory)")
+	flags.StringVar(&opts.CatalogPath, "catalog", "", "catalog file (default: gitspace-catalog.toml in the repository root)")
+	flags.StringVar(&opts.Branch, "branch", defaultBranch, "branch the catalog is published to")
+	flags.StringVar(&opts.Format, "format", formatText, "output format: text or json")
+	return flags, opts
+}
+
+// resolve fills in the default repository root and catalog path, makes
+// them absolute, and sets up the output for the chosen format.
+func (o *cliOptions) resolve() error {
+	if o.RepoRoot == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get working directory: %w", err)
+		}
+		o.RepoRoot = findRepoRoot(wd)
+	}
+	if o.CatalogPath == "" {
+		o.CatalogPath = filepath.Join(o.RepoRoot, "gitspace-catalog.toml")
+	}
+	var err error
+	if o.RepoRoot, err = filepath.Abs(o.RepoRoot); err != nil {
+		return err
+	}
+	if o.CatalogPath, err = filepath.Abs(o.CatalogPath); err != nil {
+		return err
+	}
+
+	o.stdout = os.Stdout
+	switch o.Format {
+	case formatText:
+		o.progress = os.Stdout
+	case formatJSON:
+		o.progress = os.Stderr
+	default:
+		return fmt.Errorf("unknown output format %q (expected %s or %s)", o.Format, formatText, formatJSON)
+	}
+	return nil
+}
+
+// parse parses the flags of a command and resolves the shared options.
+func (o *cliOptions) parse(flags *flag.FlagSet, args []string) error {
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	return o.resolve()
+}
+
+// printJSON writes v to the command output as indented JSON.
+func (o *cliOptions) printJSON(v interface{}) error {
+	content, err := encodeJSON(v)
+	if err != nil {
+		return err
+	}
+	_, err = o.stdout.Write(content)
+	return err
+}
+
+// printUpdate reports a planned or written catalog update. In JSON format
+// it is the history record the update adds, or would add.
+func (o *cliOptions) printUpdate(update *catalogUpdate, verb string) error {
+	if o.Format == formatJSON {
+		record := update.Record()
+		if record.Changes == nil {
+			record.Changes = []HistoryChange{}
+		}
+		return o.printJSON(record)
+	}
+	if update.Diff.Empty() {
+		fmt.Fprintf(o.stdout, "Catalog is up to date at version %s\n", update.Catalog.Info.Version)
+		if len(update.Generated) > 0 {
+			fmt.Fprintf(o.stdout, "Generated files %s: %s\n", verb, strings.Join(update.Generated, ", "))
+		}
+		return nil
+	}
+	fmt.Fprintf(o.stdout, "Catalog %s from version %s to %s:\n%s", verb, update.Previous.Info.Version, update.Catalog.Info.Version, update.Diff)
+	return nil
+}
+
+// printDryRun reports the diff and planned commit of a dry run.
+func (o *cliOptions) printDryRun(run *dryRun) error {
+	if o.Format == formatJSON {
+		record := run.Update.Record()
+		if record.Changes == nil {
+			record.Changes = []HistoryChange{}
+		}
+		return o.printJSON(map[string]interface{}{
+			"update": record,
+			"diff":   run.Diff,
+			"commit": run.Commit,
+		})
+	}
+	if err := o.printUpdate(run.Update, "would be updated"); err != nil {
+		return err
+	}
+	fmt.Fprint(o.stdout, run.Diff)
+	if run.Commit == nil {
+		fmt.Fprintln(o.stdout, "Nothing to commit")
+	} else {
+		run.Commit.print(o.stdout)
+	}
+	fmt.Fprintln(o.stdout, "Dry run: no files were written and GitHub was not called")
+	return nil
+}
+
+// updateCommand regenerates the catalog and the files generated with it.
+// With -dry-run, it updates a temporary copy instead and prints the diff
+// of every file and the commit publishing it would create.
+func updateCommand(args []string) error {
+	flags, opts := newFlagSet("update")
+	dryRun := flags.Bool("dry-run", false, "update a temporary copy and show the diff and planned commit")
+	if err := opts.parse(flags, args); err != nil {
+		return err
+	}
+	if *dryRun {
+		run, err := dryRunUpdate(opts.progress, opts.RepoRoot, opts.CatalogPath, opts.Branch)
+		if err != nil {
+			return err
+		}
+		return opts.printDryRun(run)
+	}
+	update, err := updateCatalog(opts.progress, opts.RepoRoot, opts.CatalogPath)
+	if err != nil {
+		return err
+	}
+	return opts.printUpdate(update, "updated")
+}
+
+// validateCommand checks every plugin and template manifest without
+// updating the catalog.
+func validateCommand(args []string) error {
+	flags, opts := newFlagSet("validate")
+	if err := opts.parse(flags, args); err != nil {
+		return err
+	}
+	catalog, err := readCatalog(opts.CatalogPath)
+	if err != nil {
+		return fmt.Errorf("failed to read catalog: %w", err)
+	}
+	entries, err := discoverEntries(opts.progress, opts.RepoRoot, discoveryOptionsFor(catalog))
+	if err != nil {
+		return fmt.Errorf("failed to discover entries: %w", err)
+	}
+	if opts.Format == formatText {
+		return runValidate(opts.progress, opts.RepoRoot, entries)
+	}
+
+	diags := validateManifests(opts.RepoRoot, entries)
+	if diags == nil {
+		diags = []Diagnostic{}
+	}
+	if err := opts.printJSON(diags); err != nil {
+		return err
+	}
+	if hasErrors(diags) {
+		return fmt.Errorf("manifest validation failed")
+	}
+	return nil
+}
+
+// discoverCommand lists the plugins and templates found in the
+// repository, with what the pipeline needs to build and test them.
+func discoverCommand(args []string) error {
+	flags, opts := newFlagSet("discover")
+	if err := opts.parse(flags, args); err != nil {
+		return err
+	}
+	catalog, err := readCatalog(opts.CatalogPath)
+	if err != nil {
+		return fmt.Errorf("failed to read catalog: %w", err)
+	}
+	discovered, err := discoverEntries(opts.progress, opts.RepoRoot, discoveryOptionsFor(catalog))
+	if err != nil {
+		return fmt.Errorf("failed to discover entries: %w", err)
+	}
+	entries, err := describeEntries(opts.RepoRoot, discovered)
+	if err != nil {
+		return err
+	}
+	if opts.Format == formatJSON {
+		return opts.printJSON(entries)
+	}
+
+	w := tabwriter.NewWriter(opts.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVERSION\tDIR")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", e.Key(), e.Version, e.Dir)
+	}
+	return w.Flush()
+}
+
+// diffCommand shows what update would change, without writing anything.
+func diffCommand(args []string) error {
+	flags, opts := newFlagSet("diff")
+	if err := opts.parse(flags, args); err != nil {
+		return err
+	}
+	update, err := planUpdate(opts.progress, opts.RepoRoot, opts.CatalogPath)
+	if err != nil {
+		return err
+	}
+	return opts.printUpdate(update, "would be updated")
+}
+
+// checkCommand fails if update would change the catalog or any file
+// generated from it, so CI can reject changes whose catalog was not
+// regenerated.
+func checkCommand(args []string) error {
+	flags, opts := newFlagSet("check")
+	if err := opts.parse(flags, args); err != nil {
+		return err
+	}
+	update, err := planUpdate(opts.progress, opts.RepoRoot, opts.CatalogPath)
+	if err != nil {
+		return err
+	}
+	if err := opts.printUpdate(update, "would be updated"); err != nil {
+		return err
+	}
+	return update.upToDate()
+}
+
+// publishOptions are the flags of the commands that publish the catalog.
+type publishOptions struct {
+	// Publisher is the name of the Publisher to use.
+	Publisher string
+	// Repository is the repository as owner/name, for the github and gitea
+	// publishers.
+	Repository string
+	// GitHubAPIURL is the API the github publisher uses, for GitHub
+	// Enterprise Server. Empty means github.com.
+	GitHubAPIURL string
+	// Remote is the git remote of the git publisher, and the one retries
+	// fetch the new state of the branch from.
+	Remote string
+	// GiteaURL is the Gitea instance of the gitea publisher.
+	GiteaURL string
+	// Mode is publishModePush or publishModePullRequest.
+	Mode string
+	// PullRequestBranch is the bot branch of publishModePullRequest.
+	PullRequestBranch string
+}
+
+func addPublishFlags(flags *flag.FlagSet) *publishOptions {
+	p := &publishOptions{}
+	publisher := os.Getenv(publisherEnv)
+	if publisher == "" {
+		publisher = publisherGitHub
+	}
+	flags.StringVar(&p.Publisher, "publisher", publisher, "publisher: github, git or gitea (default from "+publisherEnv+")")
+	flags.StringVar(&p.Repository, "repository", os.Getenv("GITHUB_REPOSITORY"), "repository as owner/name")
+	flags.StringVar(&p.GitHubAPIURL, "github-api-url", os.Getenv("GITHUB_API_URL"), "GitHub API URL, for GitHub Enterprise Server (default https://api.github.com)")
+	flags.StringVar(&p.Remote, "remote", "origin", "git remote the git publisher pushes to and retries fetch from")
+	flags.StringVar(&p.GiteaURL, "gitea-url", os.Getenv("GITEA_URL"), "Gitea instance the gitea publisher commits to")
+	flags.StringVar(&p.Mode, "mode", publishModePush, "publish mode: push to -branch, or open a pull-request into it")
+	flags.StringVar(&p.PullRequestBranch, "pr-branch", defaultPullRequestBranch, "branch pull requests are opened from")
+	return p
+}
+
+// publishResult is the outcome of publishing the catalog.
+type publishResult struct {
+	Publisher string `json:"publisher"`
+	Branch    string `json:"branch"`
+	// Commit is empty if the branch turned out to be up to date when
+	// publishing was retried.
+	Commit      string             `json:"commit"`
+	PullRequest *pullRequestResult `json:"pull_request,omitempty"`
+}
+
+// publishCatalog publishes the catalog and its generated files with the
+// publisher chosen in p, in the mode given by p. Pushes that race with
+// another push to the branch are retried on top of it as given by retry.
+// It refuses a catalog that adds or bumps an entry that did not pass
+// verification, see checkVerifiedVersions.
+func publishCatalog(ctx context.Context, opts *cliOptions, p *publishOptions, retry *publishRetry) (*publishResult, error) {
+	if p.Mode != publishModePush && p.Mode != publishModePullRequest {
+		return nil, fmt.Errorf("unknown publish mode %q (expected %s or %s)", p.Mode, publishModePush, publishModePullRequest)
+	}
+	// Every publish path refuses new versions that did not pass
+	// verification, including an update run outside the pipeline and
+	// the updates of retries.
+	if err := checkCommittedVersions(opts.RepoRoot, opts.CatalogPath); err != nil {
+		return nil, err
+	}
+	if update := retry.Update; update != nil {
+		retry.Update = func(repoRoot, catalogPath string) (*catalogUpdate, error) {
+			u, err := update(repoRoot, catalogPath)
+			if err != nil {
+				return nil, err
+			}
+			if err := checkVerifiedVersions(u); err != nil {
+				return nil, err
+			}
+			return u, nil
+		}
+	}
+	publisher, err := newPublisher(ctx, opts, p)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &publishResult{Publisher: publisher.Name(), Branch: opts.Branch}
+	if p.Mode == publishModePullRequest {
+		proposer, ok := publisher.(pullRequestPublisher)
+		if !ok {
+			return nil, fmt.Errorf("the %s publisher cannot open pull requests", publisher.Name())
+		}
+		if result.PullRequest, err = proposer.PublishPullRequest(ctx, opts.Branch, p.PullRequestBranch, opts.RepoRoot, opts.CatalogPath); err != nil {
+			return nil, fmt.Errorf("failed to publish pull request: %w", err)
+		}
+		result.Commit = result.PullRequest.Commit
+		return result, nil
+	}
+	if result.Commit, err = retry.publish(ctx, opts.progress, publisher, opts.Branch, opts.RepoRoot, opts.CatalogPath); err != nil {
+		return nil, fmt.Errorf("failed to commit and push changes: %w", err)
+	}
+	return result, nil
+}
+
+// publishCommand commits the catalog and its generated files with the
+// chosen publisher: either directly to -branch, or with -mode pull-request
+// as a pull request into it. With -dry-run, it only describes the commit.
+func publishCommand(args []string) error {
+	flags, opts := newFlagSet("publish")
+	p := addPublishFlags(flags)
+	dryRun := flags.Bool("dry-run", false, "describe the commit without publishing it")
+	if err := opts.parse(flags, args); err != nil {
+		return err
+	}
+	if *dryRun {
+		commit, err := planCommit(opts.progress, opts.RepoRoot, opts.CatalogPath, filepath.Dir(opts.CatalogPath), opts.Branch)
+		if err != nil {
+			return err
+		}
+		if opts.Format == formatJSON {
+			return opts.printJSON(commit)
+		}
+		commit.print(opts.stdout)
+		return nil
+	}
+	retry := newPublishRetry(opts.progress, p.Remote)
+	result, err := publishCatalog(context.Background(), opts, p, retry)
+	if err != nil {
+		return err
+	}
+
+	if opts.Format == formatJSON {
+		return opts.printJSON(result)
+	}
+	if pr := result.PullRequest; pr != nil {
+		verb := "Updated"
+		if pr.Created {
+			verb = "Opened"
+		}
+		fmt.Fprintf(opts.stdout, "%s pull request #%d into %s: %s\n", verb, pr.Number, result.Branch, pr.URL)
+		return nil
+	}
+	if result.Commit == "" {
+		fmt.Fprintf(opts.stdout, "Catalog on branch %s is already up to date\n", result.Branch)
+		return nil
+	}
+	fmt.Fprintf(opts.stdout, "Published %s to branch %s with the %s publisher\n", result.Commit, result.Branch, result.Publisher)
+	return nil
+}
+
+// splitRepository splits a GitHub repository given as owner/name. A bare
+// name takes its owner from GITHUB_REPOSITORY_OWNER.
+func splitRepository(repository string) (owner, name string, err error) {
+	if repository == "" {
+		return "", "", fmt.Errorf("no GitHub repository given: use -repository owner/name or set GITHUB_REPOSITORY")
+	}
+	if owner, name, ok := strings.Cut(repository, "/"); ok {
+		return owner, name, nil
+	}
+	owner = os.Getenv("GITHUB_REPOSITORY_OWNER")
+	if owner == "" {
+		return "", "", fmt.Errorf("repository %q has no owner: use owner/name or set GITHUB_REPOSITORY_OWNER", repository)
+	}
+	return owner, repository, nil
+}
+
+// listCommand lists the entries of the catalog. In JSON format, each
+// entry has the same keys as in gitspace-catalog.json plus its key.
+func listCommand(args []string) error {
+	flags, opts := newFlagSet("list")
+	if err := opts.parse(flags, args); err != nil {
+		return err
+	}
+	catalog, err := readCatalog(opts.CatalogPath)
+	if err != nil {
+		return fmt.Errorf("failed to read catalog: %w", err)
+	}
+
+	if opts.Format == formatJSON {
+		list := []map[string]interface{}{}
+		catalog.forEachEntry(func(key string, entry *Entry) error {
+			item := jsonTable(entry.fields())
+			item["key"] = key
+			list = append(list, item)
+			return nil
+		})
+		return opts.printJSON(list)
+	}
+
+	w := tabwriter.NewWriter(opts.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVERSION\tORIGIN\tDESCRIPTION")
+	catalog.forEachEntry(func(key string, entry *Entry) error {
+		origin := entry.Origin
+		if origin == "" {
+			origin = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", key, entry.Version, origin, entry.Description)
+		return nil
+	})
+	return w.Flush()
+}
+
+// verifyCommand checks the catalog digests against a checkout, given with
+// -repo or as the only argument. With -public-key, the catalog signature
+// is checked first; with -dist, downloaded plugin artifacts are checked
+// against the catalog too.
+func verifyCommand(args []string) error {
+	flags, opts := newFlagSet("verify")
+	publicKey := flags.String("public-key", "", "ed25519 public key, or a file holding it, to verify the catalog signature with")
+	dist := flags.String("dist", "", "directory of downloaded plugin artifacts, laid out as <plugin>/<artifact>")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		opts.RepoRoot = flags.Arg(0)
+	}
+	if err := opts.resolve(); err != nil {
+		return err
+	}
+
+	if *publicKey != "" {
+		key, err := readPublicKey(*publicKey)
+		if err != nil {
+			return err
+		}
+		if err := verifyCatalogSignature(opts.progress, opts.CatalogPath, key); err != nil {
+			return err
+		}
+	}
+	if err := runVerify(opts.progress, opts.CatalogPath, opts.RepoRoot); err != nil {
+		return err
+	}
+	if *dist != "" {
+		catalog, err := readCatalog(opts.CatalogPath)
+		if err != nil {
+			return fmt.Errorf("failed to read catalog: %w", err)
+		}
+		return verifyArtifacts(opts.progress, catalog, *dist)
+	}
+	return nil
+}
+
+// siteCommand renders the catalog as a static website. The output
+// directory, the only argument, defaults to site/ in the repository root.
+func siteCommand(args []string) error {
+	flags, opts := newFlagSet("site")
+	if err := opts.parse(flags, args); err != nil {
+		return err
+	}
+	outDir := filepath.Join(opts.RepoRoot, siteDir)
+	if flags.NArg() > 0 {
+		outDir = flags.Arg(0)
+	}
+	catalog, err := readCatalog(opts.CatalogPath)
+	if err != nil {
+		return fmt.Errorf("failed to read catalog: %w", err)
+	}
+	return generateSite(opts.progress, catalog, opts.RepoRoot, outDir)
+}
+
+// keygenCommand prints a new catalog signing key pair. The private key
+// goes into the CATALOG_SIGNING_KEY secret; the public key is pinned by
+// clients.
+func keygenCommand(args []string) error {
+	flags, opts := newFlagSet("keygen")
+	if err := opts.parse(flags, args); err != nil {
+		return err
+	}
+	seed, publicKey, err := catalogsig.GenerateKey()
+	if err != nil {
+		return fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	if opts.Format == formatJSON {
+		return opts.printJSON(map[string]string{"private_key": seed, "public_key": publicKey})
+	}
+	fmt.Fprintf(opts.stdout, "%s=%s\n", signingKeyEnv, seed)
+	fmt.Fprintf(opts.stdout, "Public key: %s\n", publicKey)
+	return nil
+}
+
+// pinImagesCommand resolves the images of the Dagger pipeline to their
+// current digests and writes them to the image lock.
+func pinImagesCommand(args []string) error {
+	flags, opts := newFlagSet("pin-images")
+	if err := opts.parse(flags, args); err != nil {
+		return err
+	}
+	return pinImages(context.Background(), opts.progress, opts.RepoRoot)
+}
+
+// pipelineCommand runs the Dagger pipeline that CI runs: it discovers and
+// validates the entries, builds and tests the plugins, updates the
+// catalog and renders the site in containers, and publishes the catalog
+// if it changed.
+func pipelineCommand(args []string) error {
+	flags, opts := newFlagSet("pipeline")
+	p := addPublishFlags(flags)
+	if err := opts.parse(flags, args); err != nil {
+		return err
+	}
+	return runPipeline(context.Background(), opts, p)
+}
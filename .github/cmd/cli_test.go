@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestResolveFormat(t *testing.T) {
+	stdout := os.Stdout
+	for _, test := range []struct {
+		format   string
+		progress *os.File
+	}{
+		{formatText, os.Stdout},
+		{formatJSON, os.Stderr},
+	} {
+		opts := &cliOptions{RepoRoot: t.TempDir(), Format: test.format}
+		if err := opts.resolve(); err != nil {
+			t.Fatal(err)
+		}
+		if opts.stdout != stdout {
+			t.Errorf("%s: result is not written to stdout", test.format)
+		}
+		if opts.progress != test.progress {
+			t.Errorf("%s: progress is written to %v, want %s", test.format, opts.progress, test.progress.Name())
+		}
+		if os.Stdout != stdout {
+			t.Fatalf("%s: resolve replaced os.Stdout", test.format)
+		}
+	}
+
+	opts := &cliOptions{RepoRoot: t.TempDir(), Format: "yaml"}
+	if err := opts.resolve(); err == nil {
+		t.Error("resolve accepted an unknown format")
+	}
+}
@@ -3,94 +3,209 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
-	"strconv"
+	"strings"
 
-	"github.com/bradleyfalzon/ghinstallation/v2"
 	"github.com/google/go-github/v45/github"
 )
 
-func commitAndPush(ctx context.Context, repoOwner, repoName string, repoRoot string) error {
-	appID, err := strconv.ParseInt(os.Getenv("APP_ID"), 10, 64)
+// generatedFiles are the files that the updater writes next to the
+// catalog and commitAndPush commits along with it.
+var generatedFiles = []string{
+	catalogJSONFile,
+	searchIndexFile,
+	changelogFile,
+	historyFile,
+}
+
+// commitMessage is the message of the commits commitAndPush creates.
+const commitMessage = "Update gitspace-catalog.toml"
+
+// optionalGeneratedFiles are generated files that may be absent, such as
+// the signature of a catalog updated without a signing key. When absent,
+// they are deleted from the repository if it tracks them.
+var optionalGeneratedFiles = []string{
+	signatureFile,
+}
+
+// commitAndPush commits the catalog at catalogPath and the generated files
+// next to it on top of branch, moves branch to the new commit, and returns
+// the commit SHA. base is the commit the catalog was updated on, see
+// Publisher.
+func commitAndPush(ctx context.Context, w io.Writer, client *github.Client, repoOwner, repoName, branch, base, repoRoot, catalogPath string) (string, error) {
+	// Log the repository information
+	fmt.Fprintf(w, "Attempting to access repository: %s/%s\n", repoOwner, repoName)
+
+	// Get the current commit SHA
+	ref, err := getBranchRef(ctx, w, client, repoOwner, repoName, branch)
 	if err != nil {
-		return fmt.Errorf("invalid APP_ID: %w", err)
+		return "", err
+	}
+	if err := checkBase(branch, base, ref.GetObject().GetSHA()); err != nil {
+		return "", err
 	}
 
-	installationID, err := strconv.ParseInt(os.Getenv("INSTALLATION_ID"), 10, 64)
+	// Read the generated files
+	fmt.Fprintf(w, "Repository root: %s\n", repoRoot)
+	entries, err := generatedTreeEntries(w, repoRoot, catalogPath, filepath.Dir(catalogPath))
 	if err != nil {
-		return fmt.Errorf("invalid INSTALLATION_ID: %w", err)
+		return "", err
 	}
 
-	privateKey := []byte(os.Getenv("APP_PRIVATE_KEY"))
-
-	// Create a new transport using the GitHub App authentication
-	itr, err := ghinstallation.New(http.DefaultTransport, appID, installationID, privateKey)
+	commit, err := createCatalogCommit(ctx, client, repoOwner, repoName, ref.GetObject().GetSHA(), entries)
 	if err != nil {
-		return fmt.Errorf("error creating GitHub App transport: %w", err)
+		return "", err
 	}
 
-	// Create a new GitHub client using the App authentication
-	client := github.NewClient(&http.Client{Transport: itr})
+	// Update the reference, which GitHub refuses if branch moved since
+	// the ref was read
+	_, _, err = client.Git.UpdateRef(ctx, repoOwner, repoName, &github.Reference{
+		Ref:    github.String("refs/heads/" + branch),
+		Object: &github.GitObject{SHA: commit.SHA},
+	}, false)
+	if isNotFastForward(err) {
+		return "", fmt.Errorf("error updating ref: %w: %w", errNonFastForward, err)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error updating ref: %w", err)
+	}
 
-	// Log the repository information
-	fmt.Printf("Attempting to access repository: %s/%s\n", repoOwner, repoName)
+	fmt.Fprintln(w, "Successfully committed and pushed changes")
+	return commit.GetSHA(), nil
+}
 
-	// Get the current commit SHA
-	ref, _, err := client.Git.GetRef(ctx, repoOwner, repoName, "heads/master")
+// getBranchRef returns the ref of branch, logging the details of API
+// errors.
+func getBranchRef(ctx context.Context, w io.Writer, client *github.Client, repoOwner, repoName, branch string) (*github.Reference, error) {
+	ref, _, err := client.Git.GetRef(ctx, repoOwner, repoName, "heads/"+branch)
 	if err != nil {
 		// Log more details about the error
-		fmt.Printf("Error getting ref: %v\n", err)
+		fmt.Fprintf(w, "Error getting ref: %v\n", err)
 		if errResp, ok := err.(*github.ErrorResponse); ok {
-			fmt.Printf("GitHub API responded with status: %s\n", errResp.Response.Status)
-			fmt.Printf("GitHub API error message: %s\n", errResp.Message)
+			fmt.Fprintf(w, "GitHub API responded with status: %s\n", errResp.Response.Status)
+			fmt.Fprintf(w, "GitHub API error message: %s\n", errResp.Message)
 		}
-		return fmt.Errorf("error getting ref: %w", err)
+		return nil, fmt.Errorf("error getting ref: %w", err)
 	}
+	return ref, nil
+}
 
-	// Read the updated catalog content
-	fmt.Printf("Repository root: %s\n", repoRoot)
-	catalogPath := filepath.Join(repoRoot, "gitspace-catalog.toml")
-	fmt.Printf("Attempting to read catalog from: %s\n", catalogPath)
+// isNotFastForward reports whether err is GitHub refusing a ref update
+// that does not fast-forward the ref.
+func isNotFastForward(err error) bool {
+	errResp, ok := err.(*github.ErrorResponse)
+	return ok && errResp.Response != nil && errResp.Response.StatusCode == http.StatusUnprocessableEntity &&
+		strings.Contains(strings.ToLower(errResp.Message), "fast forward")
+}
 
-	catalogContent, err := os.ReadFile(catalogPath)
+// readGitHubFile returns the content of the file at treePath on ref, and
+// false if there is no such file.
+func readGitHubFile(ctx context.Context, client *github.Client, repoOwner, repoName, ref, treePath string) ([]byte, bool, error) {
+	file, _, _, err := client.Repositories.GetContents(ctx, repoOwner, repoName, treePath, &github.RepositoryContentGetOptions{Ref: ref})
+	if isNotFound(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading %s on %s: %w", treePath, ref, err)
+	}
+	content, err := file.GetContent()
 	if err != nil {
-		return fmt.Errorf("error reading updated catalog file: %w", err)
+		return nil, false, fmt.Errorf("error decoding %s on %s: %w", treePath, ref, err)
 	}
+	return []byte(content), true, nil
+}
 
-	// Create a new tree with the updated catalog file
-	tree, _, err := client.Git.CreateTree(ctx, repoOwner, repoName, *ref.Object.SHA, []*github.TreeEntry{
-		{
-			Path:    github.String("gitspace-catalog.toml"),
-			Mode:    github.String("100644"),
-			Type:    github.String("blob"),
-			Content: github.String(string(catalogContent)),
-		},
-	})
+// createCatalogCommit creates a commit of entries on top of parent, without
+// moving any branch.
+func createCatalogCommit(ctx context.Context, client *github.Client, repoOwner, repoName, parent string, entries []*github.TreeEntry) (*github.Commit, error) {
+	// Create a new tree with the generated files
+	tree, _, err := client.Git.CreateTree(ctx, repoOwner, repoName, parent, entries)
 	if err != nil {
-		return fmt.Errorf("error creating tree: %w", err)
+		return nil, fmt.Errorf("error creating tree: %w", err)
 	}
 
 	// Create a new commit
 	commit, _, err := client.Git.CreateCommit(ctx, repoOwner, repoName, &github.Commit{
-		Message: github.String("Update gitspace-catalog.toml"),
+		Message: github.String(commitMessage),
 		Tree:    tree,
-		Parents: []*github.Commit{{SHA: ref.Object.SHA}},
+		Parents: []*github.Commit{{SHA: github.String(parent)}},
 	})
 	if err != nil {
-		return fmt.Errorf("error creating commit: %w", err)
+		return nil, fmt.Errorf("error creating commit: %w", err)
+	}
+	return commit, nil
+}
+
+// catalogTreePath returns the path of the catalog at catalogPath in the
+// repository tree.
+func catalogTreePath(repoRoot, catalogPath string) (string, error) {
+	rel, err := filepath.Rel(repoRoot, catalogPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("catalog %s is not inside the repository %s", catalogPath, repoRoot)
 	}
+	return filepath.ToSlash(rel), nil
+}
 
-	// Update the reference
-	_, _, err = client.Git.UpdateRef(ctx, repoOwner, repoName, &github.Reference{
-		Ref:    github.String("refs/heads/master"),
-		Object: &github.GitObject{SHA: commit.SHA},
-	}, false)
+// generatedTreeEntries returns the tree entries that commit the catalog at
+// catalogPath and the files generated with it, read from dir. dir is
+// usually the catalog's own directory; a dry run reads them from a copy.
+func generatedTreeEntries(w io.Writer, repoRoot, catalogPath, dir string) ([]*github.TreeEntry, error) {
+	catalogRel, err := catalogTreePath(repoRoot, catalogPath)
 	if err != nil {
-		return fmt.Errorf("error updating ref: %w", err)
+		return nil, err
 	}
+	// treePath is the path of a generated file in the repository tree.
+	treePath := func(file string) string {
+		return path.Join(path.Dir(catalogRel), file)
+	}
+
+	var entries []*github.TreeEntry
+	for _, file := range append([]string{filepath.Base(catalogPath)}, generatedFiles...) {
+		path := filepath.Join(dir, file)
+		fmt.Fprintf(w, "Attempting to read generated file from: %s\n", path)
 
-	fmt.Println("Successfully committed and pushed changes")
-	return nil
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading generated file %s: %w", file, err)
+		}
+		entries = append(entries, &github.TreeEntry{
+			Path:    github.String(treePath(file)),
+			Mode:    github.String("100644"),
+			Type:    github.String("blob"),
+			Content: github.String(string(content)),
+		})
+	}
+	for _, file := range optionalGeneratedFiles {
+		content, err := os.ReadFile(filepath.Join(dir, file))
+		if os.IsNotExist(err) {
+			tracked, err := gitTracked(repoRoot, treePath(file))
+			if err != nil {
+				return nil, err
+			}
+			if tracked {
+				fmt.Fprintf(w, "Deleting %s from the repository\n", file)
+				// A tree entry without content or SHA deletes the file.
+				entries = append(entries, &github.TreeEntry{
+					Path: github.String(treePath(file)),
+					Mode: github.String("100644"),
+					Type: github.String("blob"),
+				})
+			}
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading generated file %s: %w", file, err)
+		}
+		entries = append(entries, &github.TreeEntry{
+			Path:    github.String(treePath(file)),
+			Mode:    github.String("100644"),
+			Type:    github.String("blob"),
+			Content: github.String(string(content)),
+		})
+	}
+	return entries, nil
 }
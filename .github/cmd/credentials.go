@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/google/go-github/v45/github"
+)
+
+// defaultGitHubAPIURL is the API of github.com. GitHub Enterprise Server
+// is used by setting -github-api-url or GITHUB_API_URL to its address.
+const defaultGitHubAPIURL = "https://api.github.com/"
+
+// credentialProvider is one way of authenticating to the GitHub API.
+type credentialProvider interface {
+	// Name identifies the provider in logs and errors.
+	Name() string
+	// Transport returns a transport that authenticates requests to the
+	// API at baseURL, or an error saying why the provider cannot.
+	Transport(ctx context.Context, baseURL *url.URL) (http.RoundTripper, error)
+}
+
+// defaultCredentialProviders are the providers tried, in order, when
+// publishing to GitHub: the GitHub App, then a token, then the git
+// credential helper of repoRoot.
+func defaultCredentialProviders(repoRoot string) []credentialProvider {
+	return []credentialProvider{
+		appCredentials{},
+		tokenCredentials{},
+		gitCredentials{RepoRoot: repoRoot},
+	}
+}
+
+// newGitHubClient returns a GitHub client for the API at apiURL, which
+// defaults to github.com, authenticated by the first of providers that
+// can.
+func newGitHubClient(ctx context.Context, w io.Writer, apiURL string, providers []credentialProvider) (*github.Client, error) {
+	if apiURL == "" {
+		apiURL = defaultGitHubAPIURL
+	}
+	// NewEnterpriseClient resolves the API path of a GitHub Enterprise
+	// Server address, such as /api/v3/, which the providers need too.
+	probe, err := github.NewEnterpriseClient(apiURL, apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub API URL %q: %w", apiURL, err)
+	}
+
+	var failures []string
+	for _, provider := range providers {
+		transport, err := provider.Transport(ctx, probe.BaseURL)
+		if err != nil {
+			fmt.Fprintf(w, "Skipping %s credentials: %v\n", provider.Name(), err)
+			failures = append(failures, fmt.Sprintf("%s: %v", provider.Name(), err))
+			continue
+		}
+		fmt.Fprintf(w, "Authenticating to %s with %s credentials\n", probe.BaseURL, provider.Name())
+		return github.NewEnterpriseClient(apiURL, apiURL, &http.Client{Transport: transport})
+	}
+	return nil, fmt.Errorf("no GitHub credentials found, tried:\n  %s", strings.Join(failures, "\n  "))
+}
+
+// appCredentials authenticate as the GitHub App installation given by
+// APP_ID and INSTALLATION_ID, with the private key in APP_PRIVATE_KEY or
+// in the file named by APP_PRIVATE_KEY_FILE.
+type appCredentials struct{}
+
+func (appCredentials) Name() string {
+	return "github-app"
+}
+
+func (appCredentials) Transport(ctx context.Context, baseURL *url.URL) (http.RoundTripper, error) {
+	if os.Getenv("APP_ID") == "" {
+		return nil, fmt.Errorf("APP_ID is not set")
+	}
+	appID, err := strconv.ParseInt(os.Getenv("APP_ID"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid APP_ID: %w", err)
+	}
+	installationID, err := strconv.ParseInt(os.Getenv("INSTALLATION_ID"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid INSTALLATION_ID: %w", err)
+	}
+
+	privateKey := []byte(os.Getenv("APP_PRIVATE_KEY"))
+	if path := os.Getenv("APP_PRIVATE_KEY_FILE"); len(privateKey) == 0 && path != "" {
+		if privateKey, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("error reading APP_PRIVATE_KEY_FILE: %w", err)
+		}
+	}
+	if len(privateKey) == 0 {
+		return nil, fmt.Errorf("neither APP_PRIVATE_KEY nor APP_PRIVATE_KEY_FILE is set")
+	}
+
+	itr, err := ghinstallation.New(http.DefaultTransport, appID, installationID, privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("error creating GitHub App transport: %w", err)
+	}
+	itr.BaseURL = strings.TrimSuffix(baseURL.String(), "/")
+	return itr, nil
+}
+
+// tokenCredentials authenticate with the token in GITHUB_TOKEN, such as
+// the one GitHub Actions provides, or a personal access token in
+// GITHUB_PAT.
+type tokenCredentials struct{}
+
+func (tokenCredentials) Name() string {
+	return "token"
+}
+
+func (tokenCredentials) Transport(ctx context.Context, baseURL *url.URL) (http.RoundTripper, error) {
+	for _, env := range []string{"GITHUB_TOKEN", "GITHUB_PAT"} {
+		if token := os.Getenv(env); token != "" {
+			return &tokenTransport{Token: token}, nil
+		}
+	}
+	return nil, fmt.Errorf("neither GITHUB_TOKEN nor GITHUB_PAT is set")
+}
+
+// gitCredentials authenticate with the password git's credential helper
+// has for the GitHub host, as configured in RepoRoot.
+type gitCredentials struct {
+	RepoRoot string
+}
+
+func (gitCredentials) Name() string {
+	return "git-credential"
+}
+
+func (g gitCredentials) Transport(ctx context.Context, baseURL *url.URL) (http.RoundTripper, error) {
+	// The API of github.com is on its own host, but credentials are
+	// stored for github.com itself.
+	host := baseURL.Host
+	if host == "api.github.com" {
+		host = "github.com"
+	}
+	input := fmt.Sprintf("protocol=%s\nhost=%s\n\n", baseURL.Scheme, host)
+	// Fail instead of prompting when no helper has a password.
+	env := []string{"GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=", "SSH_ASKPASS="}
+	output, err := runGit(ctx, g.RepoRoot, env, input, "credential", "fill")
+	if err != nil {
+		return nil, fmt.Errorf("no credential for %s://%s: %w", baseURL.Scheme, host, err)
+	}
+	for _, line := range strings.Split(output, "\n") {
+		if password, ok := strings.CutPrefix(line, "password="); ok && password != "" {
+			return &tokenTransport{Token: password}, nil
+		}
+	}
+	return nil, fmt.Errorf("the credential for %s://%s has no password", baseURL.Scheme, host)
+}
+
+// tokenTransport adds a token to every request.
+type tokenTransport struct {
+	Token string
+	// Base sends the requests, http.DefaultTransport if nil.
+	Base http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.Token)
+	return base.RoundTrip(req)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+)
+
+// clearCredentials unsets every credential the providers look for, and
+// isolates git from the user's and system's credential helpers.
+func clearCredentials(t *testing.T) {
+	t.Helper()
+	for _, env := range []string{"APP_ID", "INSTALLATION_ID", "APP_PRIVATE_KEY", "APP_PRIVATE_KEY_FILE", "GITHUB_TOKEN", "GITHUB_PAT"} {
+		t.Setenv(env, "")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", home)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+}
+
+// newAuthServer returns a stand-in for a GitHub Enterprise Server API that
+// records the Authorization header of every request.
+func newAuthServer(t *testing.T) (*httptest.Server, *[]string) {
+	t.Helper()
+	var auth []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = append(auth, r.Header.Get("Authorization"))
+		if r.URL.Path != "/api/v3/repos/owner/repo/git/ref/heads/master" {
+			writeFakeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+			return
+		}
+		writeFakeJSON(w, http.StatusOK, fakeRef("master", "base0"))
+	}))
+	t.Cleanup(server.Close)
+	return server, &auth
+}
+
+func getMasterRef(t *testing.T, server *httptest.Server, repoRoot string) {
+	t.Helper()
+	client, err := newGitHubClient(context.Background(), io.Discard, server.URL, defaultCredentialProviders(repoRoot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := getBranchRef(context.Background(), io.Discard, client, "owner", "repo", "master"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewGitHubClientUsesToken(t *testing.T) {
+	clearCredentials(t)
+	t.Setenv("GITHUB_TOKEN", "actions-token")
+	t.Setenv("GITHUB_PAT", "personal-token")
+	server, auth := newAuthServer(t)
+
+	getMasterRef(t, server, t.TempDir())
+	if len(*auth) != 1 || (*auth)[0] != "Bearer actions-token" {
+		t.Errorf("Authorization = %q, want the GITHUB_TOKEN", *auth)
+	}
+}
+
+func TestNewGitHubClientUsesGitCredentialHelper(t *testing.T) {
+	clearCredentials(t)
+	repoRoot := t.TempDir()
+	gitTest(t, repoRoot, "init", "--quiet")
+	gitTest(t, repoRoot, "config", "credential.helper", "!f() { echo username=bot; echo password=helper-token; }; f")
+	server, auth := newAuthServer(t)
+
+	getMasterRef(t, server, repoRoot)
+	if len(*auth) != 1 || (*auth)[0] != "Bearer helper-token" {
+		t.Errorf("Authorization = %q, want the credential helper's password", *auth)
+	}
+}
+
+func TestAppCredentialsFromKeyFile(t *testing.T) {
+	clearCredentials(t)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "app.pem")
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("APP_ID", "1")
+	t.Setenv("INSTALLATION_ID", "2")
+	t.Setenv("APP_PRIVATE_KEY_FILE", keyFile)
+	t.Setenv("GITHUB_TOKEN", "actions-token")
+
+	baseURL, _ := url.Parse("https://github.example.com/api/v3/")
+	transport, err := appCredentials{}.Transport(context.Background(), baseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	itr, ok := transport.(*ghinstallation.Transport)
+	if !ok {
+		t.Fatalf("transport is a %T, want a GitHub App transport", transport)
+	}
+	if itr.BaseURL != "https://github.example.com/api/v3" {
+		t.Errorf("BaseURL = %q", itr.BaseURL)
+	}
+}
+
+func TestNewGitHubClientReportsEveryProvider(t *testing.T) {
+	clearCredentials(t)
+	repoRoot := t.TempDir()
+	gitTest(t, repoRoot, "init", "--quiet")
+	t.Setenv("APP_ID", "not-a-number")
+
+	_, err := newGitHubClient(context.Background(), io.Discard, "https://github.example.com", defaultCredentialProviders(repoRoot))
+	if err == nil {
+		t.Fatal("newGitHubClient succeeded without credentials")
+	}
+	for _, want := range []string{
+		"github-app: invalid APP_ID",
+		"token: neither GITHUB_TOKEN nor GITHUB_PAT is set",
+		"git-credential: no credential for https://github.example.com",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not contain %q:\n%v", want, err)
+		}
+	}
+}
@@ -1,88 +1,346 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"dagger.io/dagger"
+	"golang.org/x/sync/errgroup"
 )
 
-func main() {
-	if err := build(context.Background()); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+// catalogTool is where the catalog tool is installed in the containers of
+// the pipeline.
+const catalogTool = "/usr/local/bin/gitspace-catalog"
+
+// daggerSteps runs the catalog work of the pipeline in containers of one
+// pinned Go image, which share the Go module and build caches. The host
+// only reads the repository and collects the exported results.
+type daggerSteps struct {
+	client      *dagger.Client
+	image       string
+	repoRoot    string
+	catalogPath string
+	// progress receives the progress messages of the steps.
+	progress io.Writer
+}
+
+// goContainer returns a container of the pinned Go image with the Go
+// module and build caches mounted.
+func (s *daggerSteps) goContainer() *dagger.Container {
+	return s.client.Container().From(s.image).
+		WithMountedCache("/go/pkg/mod", s.client.CacheVolume("go-mod")).
+		WithMountedCache("/root/.cache/go-build", s.client.CacheVolume("go-build"))
+}
+
+// source returns the repository as it is on the host now, with the
+// directories in exclude left out.
+func (s *daggerSteps) source(exclude ...string) *dagger.Directory {
+	return s.client.Host().Directory(s.repoRoot, dagger.HostDirectoryOpts{Exclude: exclude})
+}
+
+// tool returns a container with the catalog tool installed, built from
+// the .github and catalogsig directories of the repository, and the
+// repository mounted at /src. The repository is read again on every
+// call, so that a step sees the results of the steps before it.
+func (s *daggerSteps) tool(exclude ...string) *dagger.Container {
+	// The tool module replaces catalogsig by its sibling directory.
+	toolSrc := s.client.Host().Directory(s.repoRoot, dagger.HostDirectoryOpts{
+		Include: []string{".github/", "catalogsig/"},
+	})
+	return s.goContainer().
+		WithDirectory("/tool", toolSrc).
+		WithWorkdir("/tool/.github").
+		WithExec([]string{"go", "build", "-o", catalogTool, "./cmd"}).
+		// The checkout belongs to another user than the container's.
+		WithExec([]string{"git", "config", "--global", "--add", "safe.directory", "*"}).
+		WithDirectory("/src", s.source(exclude...)).
+		WithWorkdir("/src")
+}
+
+// toolArgs returns the arguments that run the catalog tool command on
+// the repository mounted at /src.
+func (s *daggerSteps) toolArgs(command string, args ...string) ([]string, error) {
+	catalogRel, err := catalogTreePath(s.repoRoot, s.catalogPath)
+	if err != nil {
+		return nil, err
 	}
+	return append([]string{catalogTool, command, "-repo", "/src", "-catalog", "/src/" + catalogRel}, args...), nil
 }
 
-func build(ctx context.Context) error {
-	fmt.Println("Building with Dagger")
+// discover lists the entries of the repository.
+func (s *daggerSteps) discover(ctx context.Context) ([]pipelineEntry, error) {
+	fmt.Fprintln(s.progress, "Discovering entries")
+	args, err := s.toolArgs("discover", "-format", formatJSON)
+	if err != nil {
+		return nil, err
+	}
+	output, err := s.tool(siteDir, distDir).WithExec(args).Stdout(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover entries: %w", err)
+	}
+	var entries []pipelineEntry
+	if err := json.Unmarshal([]byte(output), &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse discovered entries: %w", err)
+	}
+	for _, e := range entries {
+		fmt.Fprintf(s.progress, "Discovered %s %s in %s\n", e.Key(), e.Version, e.Dir)
+	}
+	return entries, nil
+}
 
-	// initialize Dagger client
-	client, err := dagger.Connect(ctx, dagger.WithLogOutput(os.Stdout))
+// validate checks every manifest.
+func (s *daggerSteps) validate(ctx context.Context) error {
+	fmt.Fprintln(s.progress, "Validating manifests")
+	args, err := s.toolArgs("validate")
 	if err != nil {
 		return err
 	}
-	defer client.Close()
+	output, err := s.tool(siteDir, distDir).WithExec(args).Stdout(ctx)
+	fmt.Fprint(s.progress, output)
+	if err != nil {
+		return fmt.Errorf("manifest validation failed: %w", err)
+	}
+	return nil
+}
+
+// entryContainer returns a container with the directory of e mounted at
+// /src, ready to build it. A replace of the plugin SDK by a local
+// directory cannot be resolved in the container, so it is dropped and the
+// entry is built against the SDK version its go.mod requires.
+func (s *daggerSteps) entryContainer(e pipelineEntry) *dagger.Container {
+	src := s.client.Host().Directory(filepath.Join(s.repoRoot, e.Dir), dagger.HostDirectoryOpts{
+		Exclude: append([]string{e.Name, "node_modules"}, digestIgnoredPatterns...),
+	})
+	c := s.goContainer().
+		WithDirectory("/src", src).
+		WithWorkdir("/src").
+		WithEnvVariable("CGO_ENABLED", "0")
+	if e.LocalSDKReplace {
+		fmt.Fprintf(s.progress, "Dropping local replace of %s for %s\n", pluginSDKModule, e.Name)
+		c = c.WithExec([]string{"go", "mod", "edit", "-dropreplace=" + pluginSDKModule})
+	}
+	return c
+}
 
-	// get the current working directory
-	wd, err := os.Getwd()
+// update runs the catalog update in a container, on the repository with
+// the plugin artifacts exported to dist/, and copies the catalog and its
+// generated files back to the host. An update that checkVerifiedVersions
+// refuses is not copied back. The signing key is passed as a secret.
+func (s *daggerSteps) update(ctx context.Context) (*catalogUpdate, error) {
+	fmt.Fprintln(s.progress, "Updating catalog")
+	previous, err := readCatalog(s.catalogPath)
 	if err != nil {
-		return fmt.Errorf("failed to get working directory: %w", err)
+		return nil, fmt.Errorf("failed to read catalog: %w", err)
 	}
+	args, err := s.toolArgs("update")
+	if err != nil {
+		return nil, err
+	}
+	catalogRel, _ := catalogTreePath(s.repoRoot, s.catalogPath)
+	dir := "/src/" + filepath.ToSlash(filepath.Dir(catalogRel))
+	files := append(append([]string{filepath.Base(s.catalogPath)}, generatedFiles...), optionalGeneratedFiles...)
 
-	// determine the repository root (parent of .github)
-	repoRoot := filepath.Dir(wd)
-	fmt.Printf("Repository root: %s\n", repoRoot)
+	updater := s.tool(siteDir)
+	if key := os.Getenv(signingKeyEnv); key != "" {
+		updater = updater.WithSecretVariable(signingKeyEnv, s.client.SetSecret("catalog-signing-key", key))
+	}
+	// Collect the files in /out; absent optional files are left out.
+	collect := fmt.Sprintf("mkdir -p /out && cd %s && for f in %s; do if [ -f \"$f\" ]; then cp \"$f\" /out/; fi; done", dir, strings.Join(files, " "))
+	out := updater.WithExec(args).WithExec([]string{"sh", "-c", collect}).Directory("/out")
 
-	// Check if gitspace-catalog.toml exists
-	catalogPath := filepath.Join(repoRoot, "gitspace-catalog.toml")
-	if _, err := os.Stat(catalogPath); os.IsNotExist(err) {
-		return fmt.Errorf("gitspace-catalog.toml not found at %s", catalogPath)
+	tmp, err := os.MkdirTemp("", "gitspace-catalog-update-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	if _, err := out.Export(ctx, tmp); err != nil {
+		return nil, fmt.Errorf("failed to update catalog: %w", err)
+	}
+
+	catalog, err := readCatalog(filepath.Join(tmp, filepath.Base(s.catalogPath)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read updated catalog: %w", err)
+	}
+	update := &catalogUpdate{CatalogPath: s.catalogPath, Previous: previous, Catalog: catalog, Diff: diffCatalogs(previous, catalog)}
+	fmt.Fprintf(s.progress, "Catalog changes:\n%s\n", update.Diff)
+	if update.Diff.Empty() {
+		if update.Generated, err = changedFiles(tmp, filepath.Dir(s.catalogPath), files[1:]); err != nil {
+			return nil, err
+		}
+	}
+
+	// A refused update leaves the catalog on the host untouched.
+	if err := checkVerifiedVersions(update); err != nil {
+		return nil, err
+	}
+	if err := syncCatalogFiles(tmp, filepath.Dir(s.catalogPath), filepath.Base(s.catalogPath)); err != nil {
+		return nil, fmt.Errorf("failed to collect the catalog files: %w", err)
+	}
+	return update, nil
+}
+
+// changedFiles returns the files that differ between srcDir and dstDir,
+// including those that exist in only one of them.
+func changedFiles(srcDir, dstDir string, files []string) ([]string, error) {
+	var changed []string
+	for _, file := range files {
+		src, srcErr := os.ReadFile(filepath.Join(srcDir, file))
+		dst, dstErr := os.ReadFile(filepath.Join(dstDir, file))
+		for _, err := range []error{srcErr, dstErr} {
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+		if os.IsNotExist(srcErr) != os.IsNotExist(dstErr) || !bytes.Equal(src, dst) {
+			changed = append(changed, file)
+		}
 	}
+	return changed, nil
+}
 
-	// get reference to the local project
-	src := client.Host().Directory(repoRoot)
+// buildSite generates the catalog site in a container and exports it to
+// site/ in the repository root. The repository is read from the host
+// again so that the site reflects the updated catalog.
+func (s *daggerSteps) buildSite(ctx context.Context) error {
+	args, err := s.toolArgs("site", "/site")
+	if err != nil {
+		return err
+	}
+	out := s.tool(siteDir, distDir).WithExec(args).Directory("/site")
+	if _, err := out.Export(ctx, filepath.Join(s.repoRoot, siteDir)); err != nil {
+		return fmt.Errorf("failed to export site: %w", err)
+	}
+	fmt.Fprintf(s.progress, "Catalog site exported to %s\n", filepath.Join(s.repoRoot, siteDir))
+	return nil
+}
 
-	// get `golang` image
-	golang := client.Container().From("golang:latest")
+// run discovers the entries, then validates the manifests and verifies
+// every entry and builds every plugin in parallel, and updates the
+// catalog.
+func (s *daggerSteps) run(ctx context.Context) (*catalogUpdate, error) {
+	entries, err := s.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.RemoveAll(filepath.Join(s.repoRoot, distDir)); err != nil {
+		return nil, fmt.Errorf("failed to clean %s: %w", distDir, err)
+	}
 
-	// mount cloned repository into `golang` image
-	golang = golang.WithDirectory("/src", src).WithWorkdir("/src")
+	// validate, verify every entry, and cross-compile the plugins that
+	// passed into dist/ so the update can record them
+	var mu sync.Mutex
+	verifications := make(map[string]Verification)
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() error { return s.validate(gctx) })
+	for _, e := range entries {
+		g.Go(func() error {
+			v, err := s.verifyEntry(gctx, e)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			verifications[e.Key()] = *v
+			mu.Unlock()
+			if e.Kind != "plugins" || !e.GoModule {
+				return nil
+			}
+			if v.Status != verificationPassed {
+				fmt.Fprintf(s.progress, "Skipping build for %s: verification failed\n", e.Key())
+				return nil
+			}
+			return s.buildPlugin(gctx, e)
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	if err := writeVerifications(s.progress, s.repoRoot, verifications); err != nil {
+		return nil, fmt.Errorf("failed to record verification: %w", err)
+	}
+
+	return s.update(ctx)
+}
+
+// runPipeline runs the steps, publishes the catalog as given by p if it
+// changed, and renders the site. A new version of an entry that failed
+// verification is not published. A retry after a concurrent push runs
+// the steps again on a checkout of the new state of the branch. All of it
+// runs in Dagger containers except publishing.
+func runPipeline(ctx context.Context, opts *cliOptions, p *publishOptions) error {
+	w := opts.progress
+	fmt.Fprintln(w, "Building with Dagger")
 
-	// update catalog
-	if err := updateCatalog(repoRoot); err != nil {
-		return fmt.Errorf("failed to update catalog: %w", err)
+	// initialize Dagger client
+	client, err := dagger.Connect(ctx, dagger.WithLogOutput(w))
+	if err != nil {
+		return err
 	}
+	defer client.Close()
 
-	// Verify catalog file exists and print its content
-	content, err := os.ReadFile(catalogPath)
+	repoRoot := opts.RepoRoot
+	fmt.Fprintf(w, "Repository root: %s\n", repoRoot)
+
+	// Check if the catalog exists
+	catalogPath := opts.CatalogPath
+	if _, err := os.Stat(catalogPath); os.IsNotExist(err) {
+		return fmt.Errorf("catalog not found at %s", catalogPath)
+	}
+
+	lock, err := loadImageLock(repoRoot)
 	if err != nil {
-		return fmt.Errorf("failed to read catalog file after update: %w", err)
+		return err
 	}
-	fmt.Printf("Catalog file content after update:\n%s\n", string(content))
+	image, err := lock.resolve(w, goBuilderImage)
+	if err != nil {
+		return err
+	}
+	steps := &daggerSteps{client: client, image: image, repoRoot: repoRoot, catalogPath: catalogPath, progress: w}
 
-	// Get repository owner and name
-	repoOwner := os.Getenv("GITHUB_REPOSITORY_OWNER")
-	repoName := os.Getenv("GITHUB_REPOSITORY")
-	if repoOwner == "" || repoName == "" {
-		return fmt.Errorf("GITHUB_REPOSITORY_OWNER or GITHUB_REPOSITORY environment variables are not set")
+	update, err := steps.run(ctx)
+	if err != nil {
+		return err
 	}
+	if !update.Changed() {
+		fmt.Fprintln(w, "Catalog is up to date, nothing to commit")
+	} else if err := publishPipelineUpdate(ctx, opts, p, steps, update); err != nil {
+		return err
+	}
+
+	// render the catalog site from the catalog as published, whether or
+	// not it changed
+	return steps.buildSite(ctx)
+}
+
+// publishPipelineUpdate publishes the catalog update of steps, or
+// proposes it in a pull request, as given by p. A retry runs steps again
+// on the checkout of the new state of the branch.
+func publishPipelineUpdate(ctx context.Context, opts *cliOptions, p *publishOptions, steps *daggerSteps, update *catalogUpdate) error {
+	w := opts.progress
 
-	// If GITHUB_REPOSITORY includes the owner, split it
-	if strings.Contains(repoName, "/") {
-		parts := strings.SplitN(repoName, "/", 2)
-		repoOwner = parts[0]
-		repoName = parts[1]
+	// Verify catalog file exists and print its content
+	content, err := os.ReadFile(steps.catalogPath)
+	if err != nil {
+		return fmt.Errorf("failed to read catalog file after update: %w", err)
 	}
+	fmt.Fprintf(w, "Catalog file content after update:\n%s\n", string(content))
 
-	// commit and push changes
-	if err := commitAndPush(ctx, repoOwner, repoName, repoRoot); err != nil {
-		return fmt.Errorf("failed to commit and push changes: %w", err)
+	retry := newPublishRetry(w, p.Remote)
+	retry.Update = func(repoRoot, catalogPath string) (*catalogUpdate, error) {
+		checkout := *steps
+		checkout.repoRoot, checkout.catalogPath = repoRoot, catalogPath
+		return checkout.run(ctx)
+	}
+	if _, err := publishCatalog(ctx, opts, p, retry); err != nil {
+		return err
 	}
 
-	fmt.Println("Catalog updated and changes pushed successfully")
+	fmt.Fprintln(w, "Catalog updated and changes published successfully")
 	return nil
 }
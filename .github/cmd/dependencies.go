@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+)
+
+// entryKeyItem is one item of a table keyed by entry key, such as
+// requires or resolved.
+type entryKeyItem struct {
+	Key   string
+	Value interface{}
+	Pos   toml.Position
+}
+
+// entryKeyItems lists the items of a table keyed by entry key. Both
+// "plugins.scmtea" = "^1.0" and the unquoted plugins.scmtea = "^1.0",
+// which TOML reads as a nested table, are accepted.
+func entryKeyItems(table *toml.Tree) []entryKeyItem {
+	var items []entryKeyItem
+	for _, key := range table.Keys() {
+		value := table.GetPath([]string{key})
+		if nested, ok := value.(*toml.Tree); ok {
+			for _, name := range nested.Keys() {
+				items = append(items, entryKeyItem{
+					Key:   key + "." + name,
+					Value: nested.GetPath([]string{name}),
+					Pos:   nested.GetPositionPath([]string{name}),
+				})
+			}
+			continue
+		}
+		items = append(items, entryKeyItem{Key: key, Value: value, Pos: table.GetPositionPath([]string{key})})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+	return items
+}
+
+// getEntryKeyMap decodes a table of strings keyed by entry key.
+func getEntryKeyMap(file string, tree *toml.Tree, key string) (map[string]string, error) {
+	value := tree.GetPath([]string{key})
+	if value == nil {
+		return nil, nil
+	}
+	table, ok := value.(*toml.Tree)
+	if !ok {
+		return nil, &CatalogError{File: file, Key: key, Pos: tree.GetPositionPath([]string{key}), Err: fmt.Errorf("expected a table, got %T", value)}
+	}
+	result := make(map[string]string)
+	for _, item := range entryKeyItems(table) {
+		s, ok := item.Value.(string)
+		if !ok {
+			return nil, &CatalogError{File: file, Key: key + "." + item.Key, Pos: item.Pos, Err: fmt.Errorf("expected a string")}
+		}
+		result[item.Key] = s
+	}
+	return result, nil
+}
+
+// isEntryKey reports whether key has the form "plugins.<name>" or
+// "templates.<name>".
+func isEntryKey(key string) bool {
+	kind, name, ok := strings.Cut(key, ".")
+	if !ok || name == "" {
+		return false
+	}
+	for _, k := range entryKinds {
+		if kind == k {
+			return true
+		}
+	}
+	return false
+}
+
+// catalogEntry returns the entry with the given key, or nil.
+func (c *Catalog) catalogEntry(key string) *Entry {
+	kind, name, _ := strings.Cut(key, ".")
+	switch kind {
+	case "plugins":
+		if p := c.Plugins[name]; p != nil {
+			return &p.Entry
+		}
+	case "templates":
+		if t := c.Templates[name]; t != nil {
+			return &t.Entry
+		}
+	}
+	return nil
+}
+
+// resolveDependencies checks the requires of every entry against the
+// catalog and records the version each dependency resolved to in
+// Resolved. It fails on unknown entries, versions that do not satisfy
+// their constraint, and dependency cycles, listing every problem found.
+// Entries merged from included catalogs keep the resolution of their
+// origin, but still take part in cycle detection.
+func resolveDependencies(w io.Writer, catalog *Catalog) error {
+	fmt.Fprintln(w, "Resolving entry dependencies...")
+	var problems []string
+	graph := make(map[string][]string)
+
+	catalog.forEachEntry(func(key string, entry *Entry) error {
+		if entry.Origin != "" {
+			for dep := range entry.Resolved {
+				graph[key] = append(graph[key], dep)
+			}
+			sort.Strings(graph[key])
+			return nil
+		}
+		entry.Resolved = nil
+		for _, dep := range sortedKeys(entry.Requires) {
+			text := entry.Requires[dep]
+			graph[key] = append(graph[key], dep)
+			constraint, err := parseConstraint(text)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s requires %s: %v", key, dep, err))
+				continue
+			}
+			target := catalog.catalogEntry(dep)
+			if target == nil {
+				problems = append(problems, fmt.Sprintf("%s requires %s %s, which is not in the catalog", key, dep, text))
+				continue
+			}
+			version, err := parseSemver(target.Version)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s requires %s: %v", key, dep, err))
+				continue
+			}
+			if !constraint.Check(version) {
+				problems = append(problems, fmt.Sprintf("%s requires %s %s, but the catalog has %s", key, dep, text, target.Version))
+				continue
+			}
+			if entry.Resolved == nil {
+				entry.Resolved = make(map[string]string)
+			}
+			entry.Resolved[dep] = target.Version
+			fmt.Fprintf(w, "%s requires %s %s: resolved to %s\n", key, dep, text, target.Version)
+		}
+		return nil
+	})
+
+	if cycle := findCycle(graph); cycle != nil {
+		problems = append(problems, "dependency cycle: "+strings.Join(cycle, " -> "))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("unresolvable dependencies:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// findCycle returns the first dependency cycle in graph, in key order, as
+// a path that starts and ends with the same key, or nil if there is none.
+func findCycle(graph map[string][]string) []string {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int)
+	var stack []string
+
+	var visit func(key string) []string
+	visit = func(key string) []string {
+		state[key] = visiting
+		stack = append(stack, key)
+		for _, dep := range graph[key] {
+			switch state[dep] {
+			case visiting:
+				for i, k := range stack {
+					if k == dep {
+						return append(append([]string{}, stack[i:]...), dep)
+					}
+				}
+			case unvisited:
+				if cycle := visit(dep); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[key] = done
+		return nil
+	}
+
+	for _, key := range sortedKeys(graph) {
+		if state[key] == unvisited {
+			if cycle := visit(key); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
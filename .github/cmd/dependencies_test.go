@@ -0,0 +1,147 @@
+package main
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// dependencyCatalog returns a catalog of plugins with the given versions
+// and requires.
+func dependencyCatalog(plugins map[string]string, requires map[string]map[string]string) *Catalog {
+	catalog := &Catalog{Plugins: map[string]*PluginEntry{}, Templates: map[string]*TemplateEntry{}}
+	for name, version := range plugins {
+		entry := &PluginEntry{Entry{Version: version}}
+		entry.Requires = requires[name]
+		catalog.Plugins[name] = entry
+	}
+	return catalog
+}
+
+func TestResolveDependencies(t *testing.T) {
+	catalog := dependencyCatalog(
+		map[string]string{"app": "1.0.0", "sdk": "1.4.2", "auth": "0.3.1"},
+		map[string]map[string]string{
+			"app":  {"plugins.sdk": ">= 1.2, <2", "plugins.auth": "^0.3"},
+			"auth": {"plugins.sdk": "~1.4"},
+		},
+	)
+	catalog.Templates["starter"] = &TemplateEntry{Entry{Version: "0.1.0"}}
+	catalog.Templates["starter"].Requires = map[string]string{"plugins.app": "1"}
+
+	if err := resolveDependencies(io.Discard, catalog); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]map[string]string{
+		"plugins.app":       {"plugins.sdk": "1.4.2", "plugins.auth": "0.3.1"},
+		"plugins.auth":      {"plugins.sdk": "1.4.2"},
+		"plugins.sdk":       nil,
+		"templates.starter": {"plugins.app": "1.0.0"},
+	} {
+		if got := catalog.catalogEntry(key).Resolved; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s resolved = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestResolveDependenciesProblems(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		plugins  map[string]string
+		requires map[string]map[string]string
+		want     []string
+	}{
+		{
+			name:     "missing",
+			plugins:  map[string]string{"app": "1.0.0"},
+			requires: map[string]map[string]string{"app": {"plugins.sdk": "^1"}},
+			want:     []string{"plugins.app requires plugins.sdk ^1, which is not in the catalog"},
+		},
+		{
+			name:     "unsatisfiable",
+			plugins:  map[string]string{"app": "1.0.0", "sdk": "2.1.0"},
+			requires: map[string]map[string]string{"app": {"plugins.sdk": "^1.2"}},
+			want:     []string{"plugins.app requires plugins.sdk ^1.2, but the catalog has 2.1.0"},
+		},
+		{
+			name:     "invalid constraint",
+			plugins:  map[string]string{"app": "1.0.0", "sdk": "1.0.0"},
+			requires: map[string]map[string]string{"app": {"plugins.sdk": ">="}},
+			want:     []string{`plugins.app requires plugins.sdk: invalid constraint ">="`},
+		},
+		{
+			name:     "self",
+			plugins:  map[string]string{"app": "1.0.0"},
+			requires: map[string]map[string]string{"app": {"plugins.app": "*"}},
+			want:     []string{"dependency cycle: plugins.app -> plugins.app"},
+		},
+		{
+			name:    "cycle",
+			plugins: map[string]string{"a": "1.0.0", "b": "1.0.0", "c": "1.0.0", "d": "1.0.0"},
+			requires: map[string]map[string]string{
+				"a": {"plugins.b": "*"},
+				"b": {"plugins.c": "*"},
+				"c": {"plugins.a": "*", "plugins.d": "*"},
+			},
+			want: []string{"dependency cycle: plugins.a -> plugins.b -> plugins.c -> plugins.a"},
+		},
+		{
+			name:     "every problem",
+			plugins:  map[string]string{"app": "1.0.0", "sdk": "2.0.0"},
+			requires: map[string]map[string]string{"app": {"plugins.sdk": "^1", "plugins.auth": "^1"}},
+			want: []string{
+				"plugins.app requires plugins.auth ^1, which is not in the catalog",
+				"plugins.app requires plugins.sdk ^1, but the catalog has 2.0.0",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := resolveDependencies(io.Discard, dependencyCatalog(tc.plugins, tc.requires))
+			if err == nil {
+				t.Fatal("resolveDependencies(io.Discard, ) succeeded")
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFindCycle(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		graph map[string][]string
+		want  []string
+	}{
+		{"none", map[string][]string{"a": {"b", "c"}, "b": {"c"}, "c": nil}, nil},
+		{"diamond", map[string][]string{"a": {"b", "c"}, "b": {"d"}, "c": {"d"}}, nil},
+		{"self", map[string][]string{"a": {"a"}}, []string{"a", "a"}},
+		{"two", map[string][]string{"a": {"b"}, "b": {"a"}}, []string{"a", "b", "a"}},
+		{"behind a path", map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"d"}, "d": {"b"}}, []string{"b", "c", "d", "b"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := findCycle(tc.graph); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("findCycle() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestResolveDependenciesIncludedEntries(t *testing.T) {
+	catalog := dependencyCatalog(map[string]string{"app": "1.0.0", "sdk": "1.0.0"}, nil)
+	// Included entries keep the resolution of their origin, which here
+	// closes a cycle through a local entry.
+	catalog.Plugins["sdk"].Origin = "official"
+	catalog.Plugins["sdk"].Resolved = map[string]string{"plugins.app": "0.9.0"}
+	catalog.Plugins["app"].Requires = map[string]string{"plugins.sdk": "1"}
+	err := resolveDependencies(io.Discard, catalog)
+	if err == nil || !strings.Contains(err.Error(), "dependency cycle: plugins.app -> plugins.sdk -> plugins.app") {
+		t.Errorf("resolveDependencies(io.Discard, ) = %v, want a cycle through the included entry", err)
+	}
+	if got := catalog.Plugins["sdk"].Resolved["plugins.app"]; got != "0.9.0" {
+		t.Errorf("included resolution changed to %q", got)
+	}
+}
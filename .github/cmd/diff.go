@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ChangeType describes how a catalog entry changed between two catalogs.
+type ChangeType string
+
+const (
+	ChangeAdded   ChangeType = "added"
+	ChangeRemoved ChangeType = "removed"
+	ChangeUpdated ChangeType = "updated"
+)
+
+// FieldChange is a single field that differs between two versions of an
+// entry. Old or New is nil when the field is missing on that side.
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// EntryChange describes one added, removed or updated entry. Key is the
+// entry's table name, e.g. "plugins.scmtea".
+type EntryChange struct {
+	Key    string
+	Type   ChangeType
+	Old    *Entry
+	New    *Entry
+	Fields []FieldChange
+}
+
+// CatalogDiff is the semantic difference between the entries of two
+// catalogs, ordered by entry key.
+type CatalogDiff struct {
+	Changes []EntryChange
+}
+
+// Empty reports whether the two catalogs have identical entries.
+func (d CatalogDiff) Empty() bool {
+	return len(d.Changes) == 0
+}
+
+func (d CatalogDiff) String() string {
+	if d.Empty() {
+		return "no changes"
+	}
+	var sb strings.Builder
+	for _, c := range d.Changes {
+		sb.WriteString(fmt.Sprintf("%s %s\n", c.Type, c.Key))
+		for _, f := range c.Fields {
+			sb.WriteString(fmt.Sprintf("  %s: %s -> %s\n", f.Field, formatFieldValue(f.Old), formatFieldValue(f.New)))
+		}
+	}
+	return sb.String()
+}
+
+// diffCatalogs compares the plugin and template entries of old and new.
+// Catalog-level metadata such as the version and last_updated is not part
+// of the diff, since it is derived from the diff.
+func diffCatalogs(old, new *Catalog) CatalogDiff {
+	oldEntries := catalogEntries(old)
+	newEntries := catalogEntries(new)
+
+	keys := make(map[string]bool)
+	for k := range oldEntries {
+		keys[k] = true
+	}
+	for k := range newEntries {
+		keys[k] = true
+	}
+
+	var diff CatalogDiff
+	for _, key := range sortedKeys(keys) {
+		o, inOld := oldEntries[key]
+		n, inNew := newEntries[key]
+		switch {
+		case !inOld:
+			diff.Changes = append(diff.Changes, EntryChange{Key: key, Type: ChangeAdded, New: n})
+		case !inNew:
+			diff.Changes = append(diff.Changes, EntryChange{Key: key, Type: ChangeRemoved, Old: o})
+		default:
+			if fields := diffEntries(*o, *n); len(fields) > 0 {
+				diff.Changes = append(diff.Changes, EntryChange{Key: key, Type: ChangeUpdated, Old: o, New: n, Fields: fields})
+			}
+		}
+	}
+	return diff
+}
+
+func catalogEntries(c *Catalog) map[string]*Entry {
+	entries := make(map[string]*Entry)
+	c.forEachEntry(func(key string, entry *Entry) error {
+		entries[key] = entry
+		return nil
+	})
+	return entries
+}
+
+// entryFields flattens an entry into its TOML key/value pairs.
+func entryFields(e Entry) map[string]interface{} {
+	fields := make(map[string]interface{})
+	for _, kv := range e.fields() {
+		fields[kv.Key] = kv.Value
+	}
+	return fields
+}
+
+func formatFieldValue(v interface{}) string {
+	if v == nil {
+		return "(none)"
+	}
+	return formatValue(v)
+}
+
+func diffEntries(old, new Entry) []FieldChange {
+	oldFields := entryFields(old)
+	newFields := entryFields(new)
+
+	keys := make(map[string]bool)
+	for k := range oldFields {
+		keys[k] = true
+	}
+	for k := range newFields {
+		keys[k] = true
+	}
+
+	var changes []FieldChange
+	for _, k := range sortedKeys(keys) {
+		if formatFieldValue(oldFields[k]) != formatFieldValue(newFields[k]) {
+			changes = append(changes, FieldChange{Field: k, Old: oldFields[k], New: newFields[k]})
+		}
+	}
+	return changes
+}
+
+// clone returns a copy of c whose entry maps can be modified without
+// affecting c.
+func (c *Catalog) clone() *Catalog {
+	cp := *c
+	cp.Plugins = make(map[string]*PluginEntry, len(c.Plugins))
+	for k, v := range c.Plugins {
+		entry := *v
+		cp.Plugins[k] = &entry
+	}
+	cp.Templates = make(map[string]*TemplateEntry, len(c.Templates))
+	for k, v := range c.Templates {
+		entry := *v
+		cp.Templates[k] = &entry
+	}
+	if c.Info.LastUpdated != nil {
+		lu := *c.Info.LastUpdated
+		cp.Info.LastUpdated = &lu
+	}
+	return &cp
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+)
+
+const digestPrefix = "sha256:"
+
+// digestIgnoredNames are files and directories that are never part of an
+// entry digest, at any depth.
+var digestIgnoredNames = map[string]bool{
+	".git":         true,
+	".DS_Store":    true,
+	"node_modules": true,
+}
+
+// digestIgnoredPatterns match build outputs that are never part of an
+// entry digest, at any depth. The binary that a build writes next to each
+// entry, named after the entry, is handled separately in entryFiles.
+var digestIgnoredPatterns = []string{
+	"*.so",
+	"*.exe",
+	"*.dll",
+	"*.dylib",
+}
+
+// fileRules restricts the files of an entry that go into its digest.
+// Patterns are slash-separated, relative to the entry directory, and may
+// use ** to match any number of directories.
+type fileRules struct {
+	Include []string
+	Exclude []string
+}
+
+// loadFileRules reads [template.files] include/exclude from a template
+// manifest. Plugins and templates without the section get empty rules,
+// which select every file.
+func loadFileRules(entryDir string) (fileRules, error) {
+	var rules fileRules
+	manifestPath := filepath.Join(entryDir, templateManifestName)
+	if _, err := os.Stat(manifestPath); os.IsNotExist(err) {
+		return rules, nil
+	}
+	tree, err := toml.LoadFile(manifestPath)
+	if err != nil {
+		return rules, fmt.Errorf("error loading %s: %w", manifestPath, err)
+	}
+	files, ok := tree.GetPath([]string{"template", "files"}).(*toml.Tree)
+	if !ok {
+		return rules, nil
+	}
+	if rules.Include, err = stringArray(files, "include"); err != nil {
+		return rules, fmt.Errorf("%s: template.files.%w", manifestPath, err)
+	}
+	if rules.Exclude, err = stringArray(files, "exclude"); err != nil {
+		return rules, fmt.Errorf("%s: template.files.%w", manifestPath, err)
+	}
+	return rules, nil
+}
+
+func stringArray(tree *toml.Tree, key string) ([]string, error) {
+	value := tree.GetPath([]string{key})
+	if value == nil {
+		return nil, nil
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: expected an array of strings", key)
+	}
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: expected an array of strings", key)
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+// entryFiles lists the files of the entry name in entryDir that are
+// covered by its digest, as sorted slash-separated paths relative to
+// entryDir. name is the entry's manifest name, which is also the name of
+// the binary a build writes at the top of entryDir, so that binary is left
+// out. Manifests are always included so that metadata changes show up in
+// the digest even when a template's include list does not name them.
+func entryFiles(entryDir, name string, rules fileRules) ([]string, error) {
+	var files []string
+	err := filepath.Walk(entryDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == entryDir {
+			return nil
+		}
+		rel, err := filepath.Rel(entryDir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if digestIgnoredNames[info.Name()] {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if rel == name || matchesAny(digestIgnoredPatterns, info.Name()) {
+			return nil
+		}
+		if rel == pluginManifestName || rel == templateManifestName {
+			files = append(files, rel)
+			return nil
+		}
+		if len(rules.Include) > 0 && !matchesAnyGlob(rules.Include, rel) {
+			return nil
+		}
+		if matchesAnyGlob(rules.Exclude, rel) {
+			return nil
+		}
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing files in %s: %w", entryDir, err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// computeDigest returns a deterministic sha256 digest of the entry name
+// in entryDir. The digest covers the relative path and content of every file
+// returned by entryFiles, so it does not depend on the checkout location,
+// file timestamps or walk order.
+func computeDigest(entryDir, name string) (string, error) {
+	rules, err := loadFileRules(entryDir)
+	if err != nil {
+		return "", err
+	}
+	files, err := entryFiles(entryDir, name, rules)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	for _, rel := range files {
+		fileHash, err := hashFile(filepath.Join(entryDir, filepath.FromSlash(rel)))
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\x00%s\n", rel, fileHash)
+	}
+	return digestPrefix + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashFile(p string) (string, error) {
+	info, err := os.Lstat(p)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(p)
+		if err != nil {
+			return "", err
+		}
+		io.WriteString(h, "symlink:"+target)
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("error hashing %s: %w", p, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAnyGlob(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob reports whether the slash-separated path rel matches pattern.
+// Each pattern segment is matched with path.Match, except "**", which
+// matches zero or more whole segments.
+func matchGlob(pattern, rel string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// updateDigests stores the content digest of every entry. Entry paths
+// must already be relative to repoRoot.
+func updateDigests(w io.Writer, catalog *Catalog, repoRoot string) error {
+	fmt.Fprintln(w, "Updating entry digests...")
+	update := func(name string, entry *Entry) error {
+		digest, err := computeDigest(filepath.Join(repoRoot, entry.Path), entryName(name))
+		if err != nil {
+			return fmt.Errorf("error computing digest for %s: %w", name, err)
+		}
+		entry.Digest = digest
+		fmt.Fprintf(w, "Digest for %s: %s\n", name, digest)
+		return nil
+	}
+
+	return catalog.forEachEntry(update)
+}
+
+// entryName returns the manifest name of the entry with the catalog key,
+// such as scmtea for plugins.scmtea.
+func entryName(key string) string {
+	_, name, _ := strings.Cut(key, ".")
+	return name
+}
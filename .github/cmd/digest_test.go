@@ -0,0 +1,142 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, rel string
+		want         bool
+	}{
+		{"*.log", "build.log", true},
+		{"*.log", "logs/build.log", false},
+		{"**/*.log", "build.log", true},
+		{"**/*.log", "logs/deep/build.log", true},
+		{"docs/**", "docs/a/b.md", true},
+		{"docs/**", "src/docs/a.md", false},
+		{"src/*.go", "src/main.go", true},
+		{"src/*.go", "src/pkg/main.go", false},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+	} {
+		if got := matchGlob(tc.pattern, tc.rel); got != tc.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tc.pattern, tc.rel, got, tc.want)
+		}
+	}
+}
+
+func TestEntryFilesHonoursRules(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "starter")
+	writeTestFiles(t, dir, map[string]string{
+		templateManifestName:  "[template]\n",
+		"main.go":             "package main\n",
+		"build.log":           "log\n",
+		"logs/run.log":        "log\n",
+		"cache/a.tmp":         "tmp\n",
+		"notes.txt":           "not included\n",
+		"starter":             "binary\n",
+		"lib/plugin.so":       "shared object\n",
+		"node_modules/x/i.js": "dependency\n",
+		".git/HEAD":           "ref\n",
+		"docs/guide/intro.md": "# Intro\n",
+	})
+	rules := fileRules{
+		Include: []string{"*.go", "*.log", "logs/*", "cache/*", "docs/**", "starter", "lib/*"},
+		Exclude: []string{"**/*.tmp", "*.log"},
+	}
+	files, err := entryFiles(dir, "starter", rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// *.log only excludes build.log at the top; logs/run.log is kept. The
+	// binary named after the entry and *.so files are never included.
+	want := []string{"docs/guide/intro.md", templateManifestName, "logs/run.log", "main.go"}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("files = %q, want %q", files, want)
+	}
+}
+
+func TestEntryFilesWithoutRulesSelectsEverything(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "scmtea")
+	writeTestFiles(t, dir, map[string]string{
+		pluginManifestName: "[metadata]\n",
+		"main.go":          "package main\n",
+		"ssh-key/index.js": "",
+		"scmtea":           "binary\n",
+		"sub/scmtea":       "not the binary\n",
+	})
+	files, err := entryFiles(dir, "scmtea", fileRules{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{pluginManifestName, "main.go", "ssh-key/index.js", "sub/scmtea"}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("files = %q, want %q", files, want)
+	}
+}
+
+func TestEntryFilesSkipsBinaryNamedAfterManifest(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "gitea-plugin")
+	writeTestFiles(t, dir, map[string]string{
+		pluginManifestName: "[metadata]\nname = \"scmtea\"\n",
+		"main.go":          "package main\n",
+		"scmtea":           "binary\n",
+		"gitea-plugin":     "not the binary\n",
+	})
+	files, err := entryFiles(dir, "scmtea", fileRules{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"gitea-plugin", pluginManifestName, "main.go"}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("files = %q, want %q", files, want)
+	}
+}
+
+func TestComputeDigest(t *testing.T) {
+	files := map[string]string{
+		pluginManifestName: "[metadata]\nname = \"scmtea\"\n",
+		"main.go":          "package main\n",
+		"ssh-key/index.js": "console.log(1)\n",
+	}
+	first := filepath.Join(t.TempDir(), "scmtea")
+	second := filepath.Join(t.TempDir(), "elsewhere", "scmtea")
+	writeTestFiles(t, first, files)
+	writeTestFiles(t, second, files)
+
+	digest := func(dir string) string {
+		t.Helper()
+		d, err := computeDigest(dir, "scmtea")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	want := digest(first)
+	if got := digest(second); got != want {
+		t.Errorf("digest depends on the location: %s != %s", got, want)
+	}
+
+	// Ignored build outputs do not change the digest.
+	writeTestFiles(t, second, map[string]string{"scmtea": "binary\n", "plugin.so": "so\n", "node_modules/a.js": "a\n"})
+	if got := digest(second); got != want {
+		t.Errorf("build outputs changed the digest: %s != %s", got, want)
+	}
+
+	// Content and renames do.
+	writeTestFiles(t, second, map[string]string{"main.go": "package main // changed\n"})
+	changed := digest(second)
+	if changed == want {
+		t.Error("content change did not change the digest")
+	}
+	if err := os.Rename(filepath.Join(second, "main.go"), filepath.Join(second, "plugin.go")); err != nil {
+		t.Fatal(err)
+	}
+	if got := digest(second); got == changed {
+		t.Error("rename did not change the digest")
+	}
+}
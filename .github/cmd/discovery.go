@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+)
+
+// ignoreFileName lists repository paths that discovery must skip, one
+// glob per line (see matchGlob), relative to the repository root.
+const ignoreFileName = ".gitspaceignore"
+
+// entryKinds are the top-level directories that hold catalog entries.
+var entryKinds = []string{"plugins", "templates"}
+
+// discoveryOptions control how entry directories are found. They are read
+// from the [catalog] section.
+type discoveryOptions struct {
+	// NestedCategories also looks one level deeper, so that entries can
+	// be grouped as plugins/<category>/<name>.
+	NestedCategories bool
+}
+
+func discoveryOptionsFor(catalog *Catalog) discoveryOptions {
+	return discoveryOptions{NestedCategories: catalog.Info.NestedCategories}
+}
+
+// discoveredEntry is a plugin or template directory with its manifests.
+type discoveredEntry struct {
+	Kind      string
+	Name      string
+	Dir       string
+	Manifests []string
+}
+
+// Key returns the catalog table name of the entry, e.g. "plugins.scmtea".
+func (d discoveredEntry) Key() string {
+	return d.Kind + "." + d.Name
+}
+
+// discoverEntries finds every plugin and template in repoRoot.
+//
+// An entry is a directory directly below plugins/ or templates/ that
+// contains a manifest. With NestedCategories, a directory without a
+// manifest is treated as a category and its direct children are
+// searched as well. Hidden directories, node_modules and paths matched by
+// .gitspaceignore are skipped. Entries are keyed by the name declared in
+// their manifest, falling back to the directory name if the manifest
+// cannot be read; validation reports the underlying problem.
+func discoverEntries(w io.Writer, repoRoot string, opts discoveryOptions) ([]discoveredEntry, error) {
+	ignore, err := loadIgnorePatterns(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []discoveredEntry
+	seen := make(map[string]string)
+	for _, kind := range entryKinds {
+		dirs, err := candidateDirs(w, repoRoot, kind, opts, ignore)
+		if err != nil {
+			return nil, err
+		}
+		for _, dir := range dirs {
+			entry := discoveredEntry{Kind: kind, Dir: dir, Manifests: entryManifests(dir)}
+			entry.Name = manifestName(kind, entry.Manifests)
+			if entry.Name == "" {
+				entry.Name = filepath.Base(dir)
+			}
+			if other, ok := seen[entry.Key()]; ok {
+				return nil, fmt.Errorf("duplicate %s name %q declared in %s and %s", kind, entry.Name, other, dir)
+			}
+			seen[entry.Key()] = dir
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// candidateDirs returns the entry directories below repoRoot/kind that
+// contain at least one manifest.
+func candidateDirs(w io.Writer, repoRoot, kind string, opts discoveryOptions, ignore []string) ([]string, error) {
+	root := filepath.Join(repoRoot, kind)
+	children, err := childDirs(w, repoRoot, root, ignore)
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs []string
+	for _, dir := range children {
+		if len(entryManifests(dir)) > 0 {
+			dirs = append(dirs, dir)
+			continue
+		}
+		if !opts.NestedCategories {
+			fmt.Fprintf(w, "Skipping %s: no manifest found\n", dir)
+			continue
+		}
+		nested, err := childDirs(w, repoRoot, dir, ignore)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range nested {
+			if len(entryManifests(n)) > 0 {
+				dirs = append(dirs, n)
+			} else {
+				fmt.Fprintf(w, "Skipping %s: no manifest found\n", n)
+			}
+		}
+	}
+	return dirs, nil
+}
+
+// childDirs lists the direct subdirectories of dir, in name order, that
+// are not hidden, node_modules or ignored.
+func childDirs(w io.Writer, repoRoot, dir string, ignore []string) ([]string, error) {
+	infos, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", dir, err)
+	}
+
+	var dirs []string
+	for _, info := range infos {
+		name := info.Name()
+		if !info.IsDir() || strings.HasPrefix(name, ".") || name == "node_modules" {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		rel, err := filepath.Rel(repoRoot, path)
+		if err != nil {
+			return nil, err
+		}
+		if matchesAnyGlob(ignore, filepath.ToSlash(rel)) {
+			fmt.Fprintf(w, "Skipping %s: matched by %s\n", rel, ignoreFileName)
+			continue
+		}
+		dirs = append(dirs, path)
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+// entryManifests returns the manifests present in dir.
+func entryManifests(dir string) []string {
+	var manifests []string
+	for _, name := range []string{pluginManifestName, templateManifestName} {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			manifests = append(manifests, path)
+		}
+	}
+	return manifests
+}
+
+// manifestName returns the name declared by the manifest that defines an
+// entry of the given kind, or "" if it cannot be read.
+func manifestName(kind string, manifests []string) string {
+	want := pluginManifestName
+	sections := []string{"metadata", "plugin"}
+	if kind == "templates" {
+		want = templateManifestName
+		sections = []string{"template"}
+		if !containsManifest(manifests, want) {
+			// Templates may still be described by a plugin manifest.
+			want = pluginManifestName
+			sections = []string{"metadata", "template", "plugin"}
+		}
+	}
+	if !containsManifest(manifests, want) {
+		return ""
+	}
+
+	for _, path := range manifests {
+		if filepath.Base(path) != want {
+			continue
+		}
+		tree, err := toml.LoadFile(path)
+		if err != nil {
+			return ""
+		}
+		for _, section := range sections {
+			if name, ok := tree.GetPath([]string{section, "name"}).(string); ok && name != "" {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+func containsManifest(manifests []string, name string) bool {
+	for _, path := range manifests {
+		if filepath.Base(path) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// loadIgnorePatterns reads .gitspaceignore from repoRoot. Blank lines and
+// lines starting with # are skipped, and a trailing slash is ignored.
+func loadIgnorePatterns(repoRoot string) ([]string, error) {
+	f, err := os.Open(filepath.Join(repoRoot, ignoreFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", ignoreFileName, err)
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, strings.TrimSuffix(strings.TrimPrefix(line, "/"), "/"))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", ignoreFileName, err)
+	}
+	return patterns, nil
+}
+
+// pipelineEntry is what the Dagger pipeline needs to know about a
+// discovered entry to build and test it. It is the output of the discover
+// command, so that discovery runs in a container rather than on the host.
+type pipelineEntry struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Dir is the entry directory relative to the repository root.
+	Dir     string `json:"dir"`
+	Version string `json:"version"`
+	// GoModule reports whether the entry has a go.mod.
+	GoModule bool `json:"go_module"`
+	// LocalSDKReplace reports whether go.mod replaces the plugin SDK by a
+	// local directory, which cannot be resolved in a container.
+	LocalSDKReplace bool `json:"local_sdk_replace"`
+	// Files are the entry files covered by its digest, relative to Dir.
+	Files []string `json:"files"`
+	// Commands are the commands the manifest declares, such as test.
+	Commands map[string]string `json:"commands,omitempty"`
+}
+
+// Key returns the catalog table name of the entry, e.g. "plugins.scmtea".
+func (e pipelineEntry) Key() string {
+	return e.Kind + "." + e.Name
+}
+
+// describeEntries returns the pipelineEntry of every discovered entry.
+func describeEntries(repoRoot string, entries []discoveredEntry) ([]pipelineEntry, error) {
+	result := []pipelineEntry{}
+	for _, d := range entries {
+		dir, err := filepath.Rel(repoRoot, d.Dir)
+		if err != nil {
+			return nil, err
+		}
+		e := pipelineEntry{Kind: d.Kind, Name: d.Name, Dir: filepath.ToSlash(dir)}
+
+		var entry Entry
+		if d.Kind == "plugins" {
+			plugin, err := loadPluginInfo(d.Dir)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load plugin %s: %w", d.Name, err)
+			}
+			entry = plugin.Entry
+		} else {
+			template, err := loadTemplateInfo(d.Dir)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load template %s: %w", d.Name, err)
+			}
+			entry = template.Entry
+		}
+		e.Version = entry.Version
+		e.Commands = entry.Commands
+		if compat := entry.Compatibility; compat != nil {
+			e.LocalSDKReplace = isLocalReplace(compat.SDKReplace)
+		}
+		if _, err := os.Stat(filepath.Join(d.Dir, "go.mod")); err == nil {
+			e.GoModule = true
+		}
+
+		rules, err := loadFileRules(d.Dir)
+		if err != nil {
+			return nil, err
+		}
+		if e.Files, err = entryFiles(d.Dir, d.Name, rules); err != nil {
+			return nil, err
+		}
+		result = append(result, e)
+	}
+	return result, nil
+}
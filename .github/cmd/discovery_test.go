@@ -0,0 +1,118 @@
+package main
+
+import (
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func pluginManifest(name string) string {
+	return "[metadata]\nname = \"" + name + "\"\nversion = \"1.0.0\"\n"
+}
+
+func templateManifest(name string) string {
+	return "[template]\nname = \"" + name + "\"\nversion = \"0.1.0\"\n"
+}
+
+func TestDiscoverEntries(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		files  map[string]string
+		nested bool
+		// want maps entry keys to directories relative to the root.
+		want map[string]string
+	}{
+		{
+			name: "direct children",
+			files: map[string]string{
+				"plugins/scmtea/" + pluginManifestName:       pluginManifest("scmtea"),
+				"plugins/empty/README.md":                    "no manifest",
+				"templates/starter/" + templateManifestName:  templateManifest("starter"),
+				"plugins/group/nested/" + pluginManifestName: pluginManifest("nested"),
+				"plugins/scmtea/sub/" + pluginManifestName:   pluginManifest("sub"),
+			},
+			want: map[string]string{
+				"plugins.scmtea":    "plugins/scmtea",
+				"templates.starter": "templates/starter",
+			},
+		},
+		{
+			name: "nested categories",
+			files: map[string]string{
+				"plugins/scmtea/" + pluginManifestName:         pluginManifest("scmtea"),
+				"plugins/group/nested/" + pluginManifestName:   pluginManifest("nested"),
+				"plugins/group/deeper/x/" + pluginManifestName: pluginManifest("deeper"),
+			},
+			nested: true,
+			want: map[string]string{
+				"plugins.scmtea": "plugins/scmtea",
+				"plugins.nested": "plugins/group/nested",
+			},
+		},
+		{
+			name: "hidden, node_modules and ignored",
+			files: map[string]string{
+				"plugins/scmtea/" + pluginManifestName:          pluginManifest("scmtea"),
+				"plugins/.hidden/" + pluginManifestName:         pluginManifest("hidden"),
+				"plugins/node_modules/" + pluginManifestName:    pluginManifest("modules"),
+				"plugins/wip/" + pluginManifestName:             pluginManifest("wip"),
+				"templates/old-starter/" + templateManifestName: templateManifest("old"),
+				ignoreFileName: "# work in progress\nplugins/wip/\n/templates/old-*\n",
+			},
+			want: map[string]string{
+				"plugins.scmtea": "plugins/scmtea",
+			},
+		},
+		{
+			name: "keys from manifest names",
+			files: map[string]string{
+				"plugins/gitea-dir/" + pluginManifestName:       pluginManifest("scmtea"),
+				"plugins/old-format/" + pluginManifestName:      "[plugin]\nname = \"legacy\"\n",
+				"plugins/broken/" + pluginManifestName:          "not toml = = =",
+				"templates/starter-dir/" + templateManifestName: templateManifest("starter"),
+				"templates/plugin-only/" + pluginManifestName:   "[template]\nname = \"described-by-plugin\"\n",
+			},
+			want: map[string]string{
+				"plugins.scmtea":                "plugins/gitea-dir",
+				"plugins.legacy":                "plugins/old-format",
+				"plugins.broken":                "plugins/broken",
+				"templates.starter":             "templates/starter-dir",
+				"templates.described-by-plugin": "templates/plugin-only",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeTestFiles(t, root, tc.files)
+			entries, err := discoverEntries(io.Discard, root, discoveryOptions{NestedCategories: tc.nested})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]string)
+			for _, e := range entries {
+				rel, err := filepath.Rel(root, e.Dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got[e.Key()] = filepath.ToSlash(rel)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("entries = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDiscoverEntriesRejectsDuplicateNames(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"plugins/first/" + pluginManifestName:  pluginManifest("scmtea"),
+		"plugins/second/" + pluginManifestName: pluginManifest("scmtea"),
+	})
+	_, err := discoverEntries(io.Discard, root, discoveryOptions{})
+	if err == nil || !strings.Contains(err.Error(), `duplicate plugins name "scmtea"`) {
+		t.Errorf("discoverEntries(io.Discard, ) error = %v, want a duplicate name error", err)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dryRun is the outcome of an update run against a copy of the catalog.
+type dryRun struct {
+	Update *catalogUpdate
+	// Diff is the unified diff of the catalog and every generated file.
+	Diff string
+	// Commit is the commit commitAndPush would create, or nil if the
+	// catalog did not change.
+	Commit *plannedCommit
+}
+
+// plannedCommit describes the commit commitAndPush would create.
+type plannedCommit struct {
+	Branch string `json:"branch"`
+	// Parent is the commit the branch points to locally, read from
+	// ParentRef, since a dry run does not ask GitHub.
+	Parent    string             `json:"parent"`
+	ParentRef string             `json:"parent_ref"`
+	Message   string             `json:"message"`
+	Tree      []plannedTreeEntry `json:"tree"`
+}
+
+// plannedTreeEntry is one entry of the tree of a plannedCommit.
+type plannedTreeEntry struct {
+	Path string `json:"path"`
+	Mode string `json:"mode"`
+	Type string `json:"type"`
+	// SHA is the blob the entry would get, empty when it deletes a file.
+	SHA string `json:"sha,omitempty"`
+	// Action is what the entry does to the parent's tree: "create",
+	// "update", "delete" or "unchanged".
+	Action string `json:"action"`
+}
+
+// dryRunUpdate runs updateCatalog against a temporary copy of the catalog
+// at catalogPath and the files generated with it, so nothing in repoRoot
+// is written. It returns the diff of every file and the commit that
+// publishing the result to branch would create.
+func dryRunUpdate(w io.Writer, repoRoot, catalogPath, branch string) (*dryRun, error) {
+	tmp, err := os.MkdirTemp("", "gitspace-catalog-dry-run-")
+	if err != nil {
+		return nil, fmt.Errorf("error creating dry run directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	dir := filepath.Dir(catalogPath)
+	files := append(append([]string{filepath.Base(catalogPath)}, generatedFiles...), optionalGeneratedFiles...)
+	for _, file := range files {
+		if err := copyFile(filepath.Join(dir, file), filepath.Join(tmp, file)); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error copying %s for the dry run: %w", file, err)
+		}
+	}
+
+	fmt.Fprintf(w, "Dry run: updating a copy of the catalog in %s\n", tmp)
+	update, err := updateCatalog(w, repoRoot, filepath.Join(tmp, filepath.Base(catalogPath)))
+	if err != nil {
+		return nil, err
+	}
+	result := &dryRun{Update: update}
+
+	catalogDir, err := filepath.Rel(repoRoot, dir)
+	if err != nil {
+		return nil, err
+	}
+	var diff strings.Builder
+	for _, file := range files {
+		name := filepath.ToSlash(filepath.Join(catalogDir, file))
+		oldText, oldName, err := readForDiff(filepath.Join(dir, file), name)
+		if err != nil {
+			return nil, err
+		}
+		newText, newName, err := readForDiff(filepath.Join(tmp, file), name)
+		if err != nil {
+			return nil, err
+		}
+		diff.WriteString(unifiedDiff(oldName, newName, oldText, newText))
+	}
+	result.Diff = diff.String()
+
+	if update.Changed() {
+		if result.Commit, err = planCommit(w, repoRoot, catalogPath, tmp, branch); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// readForDiff returns the content of path, and name, or "" for both if
+// the file does not exist.
+func readForDiff(path, name string) (string, string, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return string(content), name, nil
+}
+
+func copyFile(src, dst string) error {
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, content, 0644)
+}
+
+// planCommit describes the commit commitAndPush would create from the
+// catalog files in dir on top of branch, using only the local repository.
+// The parent is the remote-tracking branch if there is one, and the local
+// branch otherwise.
+func planCommit(w io.Writer, repoRoot, catalogPath, dir, branch string) (*plannedCommit, error) {
+	commit := &plannedCommit{Branch: branch, Message: commitMessage}
+	for _, ref := range []string{"refs/remotes/origin/" + branch, "refs/heads/" + branch} {
+		sha, err := gitRevParse(repoRoot, ref+"^{commit}")
+		if err != nil {
+			return nil, err
+		}
+		if sha != "" {
+			commit.Parent, commit.ParentRef = sha, ref
+			break
+		}
+	}
+	if commit.Parent == "" {
+		return nil, fmt.Errorf("branch %s not found in %s", branch, repoRoot)
+	}
+
+	entries, err := generatedTreeEntries(w, repoRoot, catalogPath, dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		planned := plannedTreeEntry{Path: entry.GetPath(), Mode: entry.GetMode(), Type: entry.GetType()}
+		previous, err := gitRevParse(repoRoot, commit.Parent+":"+planned.Path)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case entry.Content == nil:
+			planned.Action = "delete"
+		case previous == "":
+			planned.Action = "create"
+		default:
+			planned.Action = "update"
+		}
+		if entry.Content != nil {
+			planned.SHA = gitBlobSHA([]byte(entry.GetContent()))
+			if planned.SHA == previous {
+				planned.Action = "unchanged"
+			}
+		}
+		commit.Tree = append(commit.Tree, planned)
+	}
+	return commit, nil
+}
+
+func (c *plannedCommit) print(w io.Writer) {
+	fmt.Fprintf(w, "Planned commit on %s:\n", c.Branch)
+	fmt.Fprintf(w, "  parent:  %s (%s)\n", c.Parent, c.ParentRef)
+	fmt.Fprintf(w, "  message: %s\n", c.Message)
+	fmt.Fprintln(w, "  tree:")
+	for _, entry := range c.Tree {
+		sha := entry.SHA
+		if sha == "" {
+			sha = strings.Repeat("-", 40)
+		}
+		fmt.Fprintf(w, "    %-9s %s %s %s  %s\n", entry.Action, entry.Mode, entry.Type, sha, entry.Path)
+	}
+}
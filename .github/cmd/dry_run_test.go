@@ -0,0 +1,133 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// copyCatalogFiles copies the catalog of repoRoot and its generated files to
+// a new directory, as a dry run does, and returns it.
+func copyCatalogFiles(t *testing.T, repoRoot string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, file := range append(append([]string{"gitspace-catalog.toml"}, generatedFiles...), optionalGeneratedFiles...) {
+		if err := copyFile(filepath.Join(repoRoot, file), filepath.Join(dir, file)); err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestPlanCommitActions(t *testing.T) {
+	repoRoot, _ := newTestRemote(t)
+	// The branch does not have the history file yet.
+	gitTest(t, repoRoot, "rm", "--quiet", historyFile)
+	gitTest(t, repoRoot, "commit", "--quiet", "-m", "Remove history")
+	gitTest(t, repoRoot, "push", "--quiet", "origin", "master")
+	parent := gitTest(t, repoRoot, "rev-parse", "HEAD")
+
+	dir := copyCatalogFiles(t, repoRoot)
+	files := map[string]string{
+		"gitspace-catalog.toml": testCatalog,
+		changelogFile:           "# Changelog\n\n## 2024.10.2\n",
+		historyFile:             "{}\n",
+	}
+	writeTestFiles(t, dir, files)
+	if err := os.Remove(filepath.Join(dir, signatureFile)); err != nil {
+		t.Fatal(err)
+	}
+
+	catalogPath := filepath.Join(repoRoot, "gitspace-catalog.toml")
+	commit, err := planCommit(io.Discard, repoRoot, catalogPath, dir, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit.Parent != parent || commit.ParentRef != "refs/remotes/origin/master" {
+		t.Errorf("parent = %s (%s), want %s (refs/remotes/origin/master)", commit.Parent, commit.ParentRef, parent)
+	}
+	if commit.Branch != "master" || commit.Message != commitMessage {
+		t.Errorf("commit = %+v", commit)
+	}
+
+	want := map[string]string{
+		"gitspace-catalog.toml": "update",
+		catalogJSONFile:         "unchanged",
+		searchIndexFile:         "unchanged",
+		changelogFile:           "update",
+		historyFile:             "create",
+		signatureFile:           "delete",
+	}
+	if len(commit.Tree) != len(want) {
+		t.Errorf("got %d tree entries, want %d: %+v", len(commit.Tree), len(want), commit.Tree)
+	}
+	for _, entry := range commit.Tree {
+		if entry.Action != want[entry.Path] {
+			t.Errorf("%s: action %q, want %q", entry.Path, entry.Action, want[entry.Path])
+		}
+		if entry.Mode != "100644" || entry.Type != "blob" {
+			t.Errorf("%s: mode %s, type %s", entry.Path, entry.Mode, entry.Type)
+		}
+		if entry.Action == "delete" {
+			if entry.SHA != "" {
+				t.Errorf("%s: deleted file has sha %s", entry.Path, entry.SHA)
+			}
+			continue
+		}
+		// The planned blob is the one git would store for the file.
+		if sha := gitTest(t, dir, "hash-object", entry.Path); entry.SHA != sha {
+			t.Errorf("%s: sha %s, git hash-object %s", entry.Path, entry.SHA, sha)
+		}
+	}
+}
+
+func TestPlanCommitParent(t *testing.T) {
+	t.Run("remote-tracking branch", func(t *testing.T) {
+		repoRoot, _ := newTestRemote(t)
+		remote := gitTest(t, repoRoot, "rev-parse", "HEAD")
+		// A local commit that was not pushed is not the parent.
+		gitTest(t, repoRoot, "commit", "--quiet", "--allow-empty", "-m", "Local")
+
+		commit, err := planCommit(io.Discard, repoRoot, filepath.Join(repoRoot, "gitspace-catalog.toml"), repoRoot, "master")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if commit.Parent != remote || commit.ParentRef != "refs/remotes/origin/master" {
+			t.Errorf("parent = %s (%s), want %s (refs/remotes/origin/master)", commit.Parent, commit.ParentRef, remote)
+		}
+	})
+
+	t.Run("local branch", func(t *testing.T) {
+		repoRoot := t.TempDir()
+		gitTest(t, repoRoot, "init", "--quiet", "--initial-branch=main")
+		gitTest(t, repoRoot, "config", "user.name", "Test")
+		gitTest(t, repoRoot, "config", "user.email", "test@example.com")
+		catalogPath := writeTestCatalog(t, repoRoot)
+		gitTest(t, repoRoot, "add", ".")
+		gitTest(t, repoRoot, "commit", "--quiet", "-m", "Initial catalog")
+		head := gitTest(t, repoRoot, "rev-parse", "HEAD")
+
+		commit, err := planCommit(io.Discard, repoRoot, catalogPath, repoRoot, "main")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if commit.Parent != head || commit.ParentRef != "refs/heads/main" {
+			t.Errorf("parent = %s (%s), want %s (refs/heads/main)", commit.Parent, commit.ParentRef, head)
+		}
+		for _, entry := range commit.Tree {
+			if entry.Action != "unchanged" {
+				t.Errorf("%s: action %q, want unchanged", entry.Path, entry.Action)
+			}
+		}
+	})
+
+	t.Run("missing branch", func(t *testing.T) {
+		repoRoot, _ := newTestRemote(t)
+		_, err := planCommit(io.Discard, repoRoot, filepath.Join(repoRoot, "gitspace-catalog.toml"), repoRoot, "release")
+		if err == nil || !strings.Contains(err.Error(), "branch release not found") {
+			t.Errorf("planCommit() = %v, want a missing branch error", err)
+		}
+	})
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pelletier/go-toml"
+)
+
+const (
+	catalogJSONFile = "gitspace-catalog.json"
+	searchIndexFile = "gitspace-catalog-index.json"
+
+	// exportSchemaVersion is bumped whenever the layout of the JSON files
+	// changes in a way that clients have to know about.
+	exportSchemaVersion = 1
+)
+
+// catalogJSON is the layout of gitspace-catalog.json. Tables hold the
+// same keys and values as the TOML catalog, written from the same fields
+// methods, so the two files never disagree.
+type catalogJSON struct {
+	SchemaVersion int                               `json:"schema_version"`
+	Catalog       map[string]interface{}            `json:"catalog"`
+	Plugins       map[string]map[string]interface{} `json:"plugins"`
+	Templates     map[string]map[string]interface{} `json:"templates"`
+	// Extra holds unmanaged top-level keys of the TOML catalog.
+	Extra map[string]interface{} `json:"extra,omitempty"`
+}
+
+// searchIndex is the layout of gitspace-catalog-index.json. Tokens maps
+// every lower-case word of an entry's name, description and tags to the
+// keys of the matching entries, e.g. "gitea" -> ["plugins.scmtea"].
+type searchIndex struct {
+	SchemaVersion int                 `json:"schema_version"`
+	Version       string              `json:"version"`
+	Entries       []string            `json:"entries"`
+	Tokens        map[string][]string `json:"tokens"`
+}
+
+// searchStopWords are too common in descriptions to be worth indexing.
+var searchStopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "for": true, "in": true,
+	"of": true, "on": true, "or": true, "the": true, "to": true, "with": true,
+}
+
+func newCatalogJSON(catalog *Catalog) catalogJSON {
+	export := catalogJSON{
+		SchemaVersion: exportSchemaVersion,
+		Catalog:       jsonTable(catalog.Info.fields()),
+		Plugins:       make(map[string]map[string]interface{}, len(catalog.Plugins)),
+		Templates:     make(map[string]map[string]interface{}, len(catalog.Templates)),
+	}
+	for name, plugin := range catalog.Plugins {
+		export.Plugins[name] = jsonTable(plugin.fields())
+	}
+	for name, template := range catalog.Templates {
+		export.Templates[name] = jsonTable(template.fields())
+	}
+	if len(catalog.Extra) > 0 {
+		export.Extra = jsonValue(catalog.Extra).(map[string]interface{})
+	}
+	return export
+}
+
+func jsonTable(kv []keyValue) map[string]interface{} {
+	table := make(map[string]interface{}, len(kv))
+	for _, item := range kv {
+		table[item.Key] = jsonValue(item.Value)
+	}
+	return table
+}
+
+// jsonValue converts a catalog value to its JSON form. Date-times are
+// written as RFC 3339 strings, the same text as in the TOML file.
+func jsonValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case []keyValue:
+		return jsonTable(value)
+	case tomlTable:
+		return jsonTable(value)
+	case map[string]interface{}:
+		table := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			table[k] = jsonValue(item)
+		}
+		return table
+	case []interface{}:
+		items := make([]interface{}, len(value))
+		for i, item := range value {
+			items[i] = jsonValue(item)
+		}
+		return items
+	case time.Time:
+		return value.Format(time.RFC3339Nano)
+	case toml.LocalDate, toml.LocalTime, toml.LocalDateTime:
+		return fmt.Sprint(value)
+	default:
+		return value
+	}
+}
+
+func newSearchIndex(catalog *Catalog) searchIndex {
+	index := searchIndex{
+		SchemaVersion: exportSchemaVersion,
+		Version:       catalog.Info.Version,
+		Entries:       []string{},
+		Tokens:        make(map[string][]string),
+	}
+	catalog.forEachEntry(func(key string, entry *Entry) error {
+		index.Entries = append(index.Entries, key)
+
+		name := key[strings.Index(key, ".")+1:]
+		words := append([]string{name}, searchTokens(name)...)
+		words = append(words, searchTokens(entry.Description)...)
+		for _, tag := range entry.Tags {
+			words = append(words, strings.ToLower(tag))
+			words = append(words, searchTokens(tag)...)
+		}
+		for _, word := range words {
+			index.Tokens[word] = appendUnique(index.Tokens[word], key)
+		}
+		return nil
+	})
+	sort.Strings(index.Entries)
+	for _, keys := range index.Tokens {
+		sort.Strings(keys)
+	}
+	return index
+}
+
+// searchTokens splits s into lower-case words on anything that is not a
+// letter or digit, dropping single characters and stop words.
+func searchTokens(s string) []string {
+	var tokens []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len(word) > 1 && !searchStopWords[word] {
+			tokens = append(tokens, word)
+		}
+	}
+	return tokens
+}
+
+// writeCatalogExports writes gitspace-catalog.json and the search index
+// to dir, the directory of the TOML catalog.
+func writeCatalogExports(w io.Writer, catalog *Catalog, dir string) error {
+	exports, err := catalogExports(catalog)
+	if err != nil {
+		return err
+	}
+	for _, file := range sortedKeys(exports) {
+		path := filepath.Join(dir, file)
+		if err := os.WriteFile(path, exports[file], 0644); err != nil {
+			return fmt.Errorf("error writing %s: %w", file, err)
+		}
+		fmt.Fprintf(w, "Wrote %s\n", path)
+	}
+	return nil
+}
+
+// catalogExports returns the content of the JSON exports of catalog, keyed
+// by file name.
+func catalogExports(catalog *Catalog) (map[string][]byte, error) {
+	exports := make(map[string][]byte)
+	for _, export := range []struct {
+		file  string
+		value interface{}
+	}{
+		{catalogJSONFile, newCatalogJSON(catalog)},
+		{searchIndexFile, newSearchIndex(catalog)},
+	} {
+		content, err := encodeJSON(export.value)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding %s: %w", export.file, err)
+		}
+		exports[export.file] = content
+	}
+	return exports, nil
+}
+
+// encodeJSON encodes v as indented JSON. Unlike json.Marshal it leaves
+// characters such as "<" and ">" in constraints unescaped.
+func encodeJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalJSON writes a table in its JSON export form, e.g. in the field
+// changes of history records.
+func (t tomlTable) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonTable(t))
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/pelletier/go-toml"
+)
+
+// exportTestCatalog covers every part of the model the JSON export has to
+// mirror: catalog options, includes in both forms, unmanaged keys at every
+// level, nested tables, arrays of tables and date-times.
+const exportTestCatalog = `mirror = "https://mirror.example.com"
+
+[catalog]
+name = "Test Catalog"
+description = "Catalog for the export tests"
+version = "1.2.0"
+version_policy = "semver"
+nested_categories = true
+last_updated = { date = "2024-10-01T10:30:00Z", commit_hash = "abc123" }
+maintainer = "ops"
+
+[catalog.includes]
+community = "vendor/community"
+official = { path = "vendor/official", conflict = "override", source = "github.com/ssotops/catalog" }
+
+[plugins.scmtea]
+version = "1.0.0"
+description = "Gitea integration"
+path = "plugins/scmtea"
+digest = "sha256:0123"
+author = "ssotops"
+tags = ["git", "source-control"]
+released = 2024-10-01T10:30:00Z
+entry_points = [{ path = "main.go", entry_point = "Plugin" }]
+
+[plugins.scmtea.dependencies]
+go = ">=1.21"
+
+[[plugins.scmtea.artifacts]]
+platform = "linux/amd64"
+name = "scmtea_1.0.0_linux_amd64.tar.gz"
+size = 1024
+sha256 = "4567"
+
+[plugins."official/runner"]
+version = "0.3.0"
+description = "Runner from the official catalog"
+path = "plugins/runner"
+origin = "official"
+source = "github.com/ssotops/catalog"
+
+[templates.starter]
+version = "0.1.0"
+description = "Starter template"
+path = "templates/starter"
+
+[templates.starter.variables.name]
+type = "string"
+default = "app"
+
+[templates.starter.review]
+owner = "ops"
+weight = 3
+
+[mirrors.backup]
+url = "https://backup.example.com"
+`
+
+// normalizeJSON returns v as generic JSON values, so that values built
+// from TOML and decoded from JSON compare equal.
+func normalizeJSON(t *testing.T, v interface{}) interface{} {
+	t.Helper()
+	content, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(content, &normalized); err != nil {
+		t.Fatal(err)
+	}
+	return normalized
+}
+
+func TestCatalogJSONMirrorsTOML(t *testing.T) {
+	catalog, err := parseCatalog("export", []byte(exportTestCatalog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exports, err := catalogExports(catalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(exports[catalogJSONFile], &got); err != nil {
+		t.Fatal(err)
+	}
+
+	// The TOML catalog as written, read back without the typed model.
+	tree, err := toml.Load(formatTomlTree(catalog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables := tree.ToMap()
+	want := map[string]interface{}{"schema_version": exportSchemaVersion, "extra": map[string]interface{}{}}
+	for key, value := range tables {
+		switch key {
+		case "catalog", "plugins", "templates":
+			want[key] = value
+		default:
+			want["extra"].(map[string]interface{})[key] = value
+		}
+	}
+
+	gotTables := normalizeJSON(t, got).(map[string]interface{})
+	for _, section := range []string{"schema_version", "catalog", "plugins", "templates", "extra"} {
+		if g, w := gotTables[section], normalizeJSON(t, want[section]); !reflect.DeepEqual(g, w) {
+			t.Errorf("%s differs from the TOML catalog\nJSON: %#v\nTOML: %#v", section, g, w)
+		}
+	}
+	if len(gotTables) != len(want) {
+		t.Errorf("JSON has %d sections, want %d: %v", len(gotTables), len(want), sortedKeys(gotTables))
+	}
+}
+
+func TestSearchIndexTokens(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		entry       string
+		description string
+		tags        []string
+		want        []string
+		dropped     []string
+	}{
+		{
+			name:        "stop words and single characters",
+			entry:       "scmtea",
+			description: "A tool for the Gitea API in Go, v 2",
+			want:        []string{"tool", "gitea", "api", "go"},
+			dropped:     []string{"a", "for", "the", "in", "v", "2"},
+		},
+		{
+			name:    "tags whole and by word",
+			entry:   "scmtea",
+			tags:    []string{"Source-Control", "CI"},
+			want:    []string{"source-control", "source", "control", "ci"},
+			dropped: []string{"Source-Control", "CI"},
+		},
+		{
+			name:  "name whole and by word",
+			entry: "gitea-runner",
+			want:  []string{"gitea-runner", "gitea", "runner"},
+		},
+		{
+			name:        "case and punctuation",
+			entry:       "scmtea",
+			description: "Mirrors repos (GitHub/Gitea).",
+			want:        []string{"mirrors", "repos", "github", "gitea"},
+			dropped:     []string{"github/gitea", "gitea)."},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			catalog := newCatalog()
+			entry := Entry{Version: "1.0.0", Description: tc.description, Path: "plugins/" + tc.entry}
+			entry.Tags = tc.tags
+			catalog.Plugins[tc.entry] = &PluginEntry{Entry: entry}
+			index := newSearchIndex(catalog)
+
+			key := "plugins." + tc.entry
+			if !reflect.DeepEqual(index.Entries, []string{key}) {
+				t.Errorf("entries = %q, want [%s]", index.Entries, key)
+			}
+			for _, token := range tc.want {
+				if !reflect.DeepEqual(index.Tokens[token], []string{key}) {
+					t.Errorf("token %q = %q, want [%s]", token, index.Tokens[token], key)
+				}
+			}
+			for _, token := range tc.dropped {
+				if keys, ok := index.Tokens[token]; ok {
+					t.Errorf("token %q is indexed as %q", token, keys)
+				}
+			}
+		})
+	}
+}
+
+func TestCatalogExportsAreDeterministic(t *testing.T) {
+	catalog := newCatalog()
+	for _, name := range []string{"scmtea", "gitea-runner", "lint", "deploy", "backup"} {
+		catalog.Plugins[name] = &PluginEntry{Entry: Entry{Version: "1.0.0", Description: "Gitea " + name, Path: "plugins/" + name}}
+		catalog.Templates[name] = &TemplateEntry{Entry: Entry{Version: "1.0.0", Description: "Gitea " + name, Path: "templates/" + name}}
+	}
+
+	first, err := catalogExports(catalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Go randomizes map iteration, so a few runs catch any ordering that
+	// depends on it.
+	for i := 0; i < 10; i++ {
+		again, err := catalogExports(catalog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for file, content := range first {
+			if !bytes.Equal(again[file], content) {
+				t.Fatalf("%s differs between runs:\n%s\n%s", file, content, again[file])
+			}
+		}
+	}
+
+	index := newSearchIndex(catalog)
+	want := []string{
+		"plugins.backup", "plugins.deploy", "plugins.gitea-runner", "plugins.lint", "plugins.scmtea",
+		"templates.backup", "templates.deploy", "templates.gitea-runner", "templates.lint", "templates.scmtea",
+	}
+	if !reflect.DeepEqual(index.Entries, want) {
+		t.Errorf("entries = %q, want %q", index.Entries, want)
+	}
+	if !reflect.DeepEqual(index.Tokens["gitea"], want) {
+		t.Errorf("token gitea = %q, want %q", index.Tokens["gitea"], want)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Conflict policies for entries of an included catalog whose name is
+// already taken by an entry of this repository or an earlier include.
+const (
+	// conflictLocal keeps the existing entry and drops the included one.
+	conflictLocal = "local"
+	// conflictInclude replaces the existing entry with the included one.
+	conflictInclude = "include"
+	// conflictNamespace keeps both, adding the included entry as
+	// "<include>/<name>".
+	conflictNamespace = "namespace"
+	// conflictError fails the update.
+	conflictError = "error"
+)
+
+var conflictPolicies = []string{conflictLocal, conflictInclude, conflictNamespace, conflictError}
+
+// checkIncludes reports includes with a missing path or an unknown
+// conflict policy.
+func checkIncludes(includes map[string]Include) error {
+	for _, name := range sortedKeys(includes) {
+		inc := includes[name]
+		if inc.Path == "" {
+			return fmt.Errorf("catalog.includes.%s: missing path", name)
+		}
+		if inc.Conflict == "" {
+			continue
+		}
+		known := false
+		for _, policy := range conflictPolicies {
+			known = known || inc.Conflict == policy
+		}
+		if !known {
+			return fmt.Errorf("catalog.includes.%s: unknown conflict policy %q (expected one of %s)", name, inc.Conflict, strings.Join(conflictPolicies, ", "))
+		}
+	}
+	return nil
+}
+
+// includePath resolves the catalog file of an include relative to
+// repoRoot. A directory stands for the gitspace-catalog.toml inside it.
+func includePath(repoRoot string, inc Include) (string, error) {
+	path := inc.Path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(repoRoot, path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		path = filepath.Join(path, "gitspace-catalog.toml")
+		if _, err := os.Stat(path); err != nil {
+			return "", err
+		}
+	}
+	return path, nil
+}
+
+// mergeIncludes adds the entries of every included catalog to catalog,
+// in include name order, and records the include name as their origin.
+// Entries that an included catalog itself included keep their chain of
+// origins, e.g. "internal/official", and their source. Included entries
+// are taken as they are: their path, provenance and digest refer to the
+// included catalog, whose source they get if they came from it directly.
+func mergeIncludes(w io.Writer, catalog *Catalog, repoRoot string) error {
+	if len(catalog.Info.Includes) == 0 {
+		return nil
+	}
+	fmt.Fprintln(w, "Merging included catalogs...")
+
+	for _, name := range sortedKeys(catalog.Info.Includes) {
+		inc := catalog.Info.Includes[name]
+		path, err := includePath(repoRoot, inc)
+		if err != nil {
+			return fmt.Errorf("error resolving include %s: %w", name, err)
+		}
+		fmt.Fprintf(w, "Including catalog %s from %s\n", name, path)
+		included, err := readCatalog(path)
+		if err != nil {
+			return fmt.Errorf("error loading include %s: %w", name, err)
+		}
+
+		policy := inc.Conflict
+		if policy == "" {
+			policy = conflictLocal
+		}
+		for _, key := range sortedKeys(included.Plugins) {
+			entry := included.Plugins[key]
+			includeEntry(&entry.Entry, name, inc)
+			target, err := resolveConflict(w, "plugins", key, name, policy, func(k string) bool { return catalog.Plugins[k] != nil })
+			if err != nil {
+				return err
+			}
+			if target != "" {
+				catalog.Plugins[target] = entry
+			}
+		}
+		for _, key := range sortedKeys(included.Templates) {
+			entry := included.Templates[key]
+			includeEntry(&entry.Entry, name, inc)
+			target, err := resolveConflict(w, "templates", key, name, policy, func(k string) bool { return catalog.Templates[k] != nil })
+			if err != nil {
+				return err
+			}
+			if target != "" {
+				catalog.Templates[target] = entry
+			}
+		}
+	}
+	return nil
+}
+
+// resolveConflict returns the name under which the included entry kind.key
+// is stored, or "" if it is dropped. exists reports whether a name is
+// already taken.
+func resolveConflict(w io.Writer, kind, key, include, policy string, exists func(string) bool) (string, error) {
+	if !exists(key) {
+		fmt.Fprintf(w, "Included %s.%s from %s\n", kind, key, include)
+		return key, nil
+	}
+	switch policy {
+	case conflictInclude:
+		fmt.Fprintf(w, "Replacing %s.%s with the entry from %s\n", kind, key, include)
+		return key, nil
+	case conflictNamespace:
+		namespaced := include + "/" + key
+		if exists(namespaced) {
+			return "", fmt.Errorf("included %s.%s from %s conflicts with existing %s.%s", kind, key, include, kind, namespaced)
+		}
+		fmt.Fprintf(w, "Included %s.%s from %s as %s.%s\n", kind, key, include, kind, namespaced)
+		return namespaced, nil
+	case conflictError:
+		return "", fmt.Errorf("included %s.%s from %s conflicts with an existing entry", kind, key, include)
+	default:
+		fmt.Fprintf(w, "Keeping existing %s.%s, skipping the entry from %s\n", kind, key, include)
+		return "", nil
+	}
+}
+
+// includeEntry records that entry came from the include name.
+func includeEntry(entry *Entry, name string, inc Include) {
+	if entry.Origin == "" {
+		entry.Source = inc.Source
+	}
+	entry.Origin = joinOrigin(name, entry.Origin)
+}
+
+func joinOrigin(include, origin string) string {
+	if origin == "" {
+		return include
+	}
+	return include + "/" + origin
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+const officialCatalog = `[catalog]
+name = "official"
+version = "1.0.0"
+
+[plugins]
+
+[plugins.scmtea]
+version = "2.0.0"
+description = "scmtea from official"
+path = "plugins/scmtea"
+
+[plugins.gitea-runner]
+version = "0.3.0"
+description = "Gitea runner"
+path = "plugins/gitea-runner"
+
+[templates]
+
+[templates.starter]
+version = "0.2.0"
+description = "starter from official"
+path = "templates/starter"
+`
+
+// internalCatalog itself included the official catalog.
+const internalCatalog = `[catalog]
+name = "internal"
+version = "1.0.0"
+
+[plugins]
+
+[plugins.audit]
+version = "1.0.0"
+description = "Audit"
+path = "plugins/audit"
+origin = "official"
+
+[plugins.lint]
+version = "0.1.0"
+description = "Lint"
+path = "plugins/lint"
+
+[templates]
+`
+
+func federatedCatalog(policy string) *Catalog {
+	return &Catalog{
+		Info: CatalogInfo{Includes: map[string]Include{
+			"official": {Path: "vendor/official", Conflict: policy},
+		}},
+		Plugins: map[string]*PluginEntry{
+			"scmtea": {Entry{Version: "1.0.0", Description: "local scmtea", Path: "plugins/scmtea"}},
+		},
+		Templates: map[string]*TemplateEntry{},
+	}
+}
+
+func TestMergeIncludesConflictPolicies(t *testing.T) {
+	repoRoot := t.TempDir()
+	writeTestFiles(t, repoRoot, map[string]string{"vendor/official/gitspace-catalog.toml": officialCatalog})
+
+	for _, tc := range []struct {
+		policy string
+		// want maps plugin keys to their description.
+		want map[string]string
+		err  string
+	}{
+		{"", map[string]string{"scmtea": "local scmtea", "gitea-runner": "Gitea runner"}, ""},
+		{conflictLocal, map[string]string{"scmtea": "local scmtea", "gitea-runner": "Gitea runner"}, ""},
+		{conflictInclude, map[string]string{"scmtea": "scmtea from official", "gitea-runner": "Gitea runner"}, ""},
+		{conflictNamespace, map[string]string{"scmtea": "local scmtea", "official/scmtea": "scmtea from official", "gitea-runner": "Gitea runner"}, ""},
+		{conflictError, nil, "included plugins.scmtea from official conflicts with an existing entry"},
+	} {
+		name := tc.policy
+		if name == "" {
+			name = "default"
+		}
+		t.Run(name, func(t *testing.T) {
+			catalog := federatedCatalog(tc.policy)
+			err := mergeIncludes(io.Discard, catalog, repoRoot)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("mergeIncludes(io.Discard, ) error = %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]string)
+			for key, entry := range catalog.Plugins {
+				got[key] = entry.Description
+			}
+			if len(got) != len(tc.want) {
+				t.Errorf("plugins = %v, want %v", got, tc.want)
+			}
+			for key, description := range tc.want {
+				if got[key] != description {
+					t.Errorf("plugins.%s = %q, want %q", key, got[key], description)
+				}
+			}
+			for key, entry := range catalog.Plugins {
+				wantOrigin := "official"
+				if entry.Description == "local scmtea" {
+					wantOrigin = ""
+				}
+				if entry.Origin != wantOrigin {
+					t.Errorf("plugins.%s origin = %q, want %q", key, entry.Origin, wantOrigin)
+				}
+			}
+			if tpl := catalog.Templates["starter"]; tpl == nil || tpl.Origin != "official" {
+				t.Errorf("templates.starter = %+v, want it included from official", tpl)
+			}
+		})
+	}
+}
+
+func TestMergeIncludesNamespaceCollision(t *testing.T) {
+	repoRoot := t.TempDir()
+	writeTestFiles(t, repoRoot, map[string]string{"vendor/official/gitspace-catalog.toml": officialCatalog})
+	catalog := federatedCatalog(conflictNamespace)
+	catalog.Plugins["official/scmtea"] = &PluginEntry{Entry{Version: "1.0.0"}}
+	if err := mergeIncludes(io.Discard, catalog, repoRoot); err == nil {
+		t.Error("mergeIncludes(io.Discard, ) overwrote an existing namespaced entry")
+	}
+}
+
+func TestMergeIncludesKeepsOriginChain(t *testing.T) {
+	repoRoot := t.TempDir()
+	writeTestFiles(t, repoRoot, map[string]string{"internal.toml": internalCatalog})
+	catalog := &Catalog{
+		Info:      CatalogInfo{Includes: map[string]Include{"internal": {Path: "internal.toml", Source: "github.com/acme/catalog"}}},
+		Plugins:   map[string]*PluginEntry{},
+		Templates: map[string]*TemplateEntry{},
+	}
+	if err := mergeIncludes(io.Discard, catalog, repoRoot); err != nil {
+		t.Fatal(err)
+	}
+	audit := catalog.Plugins["audit"]
+	if audit == nil || audit.Origin != "internal/official" {
+		t.Errorf("plugins.audit = %+v, want origin internal/official", audit)
+	}
+	// Only entries of the included catalog itself are installed from its
+	// source; audit lives in the catalog that internal included.
+	if audit != nil && audit.Source != "" {
+		t.Errorf("plugins.audit source = %q, want none", audit.Source)
+	}
+	if lint := catalog.Plugins["lint"]; lint == nil || lint.Source != "github.com/acme/catalog" {
+		t.Errorf("plugins.lint = %+v, want source github.com/acme/catalog", lint)
+	}
+}
+
+func TestCheckIncludes(t *testing.T) {
+	if err := checkIncludes(map[string]Include{"a": {Path: "a", Conflict: "merge"}}); err == nil {
+		t.Error("checkIncludes accepted an unknown conflict policy")
+	}
+	if err := checkIncludes(map[string]Include{"a": {}}); err == nil {
+		t.Error("checkIncludes accepted an include without a path")
+	}
+	if err := checkIncludes(map[string]Include{"a": {Path: "a", Conflict: conflictNamespace}}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIncludeSourceRoundTrips(t *testing.T) {
+	catalog, _ := roundTrip(t, "includes", []byte(`[catalog]
+name = "internal"
+version = "1.0.0"
+
+[catalog.includes]
+local = "vendor/local"
+official = { path = "../gitspace-catalog", source = "github.com/ssotops/catalog" }
+
+[plugins]
+
+[plugins.scmtea]
+version = "1.0.0"
+description = "scmtea"
+path = "plugins/scmtea"
+origin = "official"
+source = "github.com/ssotops/catalog"
+
+[templates]
+`))
+	if got := catalog.Info.Includes["official"]; got.Source != "github.com/ssotops/catalog" {
+		t.Errorf("include official = %+v, want its source", got)
+	}
+	if got := catalog.Plugins["scmtea"].Source; got != "github.com/ssotops/catalog" {
+		t.Errorf("plugins.scmtea source = %q", got)
+	}
+}
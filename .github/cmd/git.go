@@ -1,52 +1,157 @@
 package main
 
 import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
+	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
+	"time"
 )
 
-// func gitConfig() error {
-// 	cmd := exec.Command("git", "config", "--global", "user.email", "github-actions[bot]@users.noreply.github.com")
-// 	if err := cmd.Run(); err != nil {
-// 		return err
-// 	}
+// runGit runs git with args in repoRoot and returns its trimmed output.
+// env is added to the environment of git, and stdin, if not empty, is
+// written to its standard input.
+func runGit(ctx context.Context, repoRoot string, env []string, stdin string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = repoRoot
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w", args[0], gitError(err))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
 
-// 	cmd = exec.Command("git", "config", "--global", "user.name", "GitHub Actions")
-// 	return cmd.Run()
-// }
+// gitFetch fetches branch from remote into repoRoot and returns the
+// commit it points to.
+func gitFetch(ctx context.Context, repoRoot, remote, branch string) (string, error) {
+	if _, err := runGit(ctx, repoRoot, nil, "", "fetch", "--quiet", remote, "refs/heads/"+branch); err != nil {
+		return "", fmt.Errorf("error fetching %s: %w", branch, err)
+	}
+	return runGit(ctx, repoRoot, nil, "", "rev-parse", "--verify", "FETCH_HEAD^{commit}")
+}
 
-func gitAdd(repoRoot string) error {
-	cmd := exec.Command("git", "add", filepath.Join(repoRoot, "gitspace-catalog.toml"))
-	cmd.Dir = repoRoot
-	return cmd.Run()
+// gitCheckout clones repoRoot into a new temporary directory and checks
+// out commit there, detached. A local clone copies every object of
+// repoRoot, through hard links where it can, so commit only has to exist
+// in repoRoot, for example as FETCH_HEAD. Unlike a worktree, the clone is
+// a repository of its own that can be mounted into a container.
+func gitCheckout(ctx context.Context, repoRoot, commit string) (string, error) {
+	dir, err := os.MkdirTemp("", "gitspace-catalog-checkout-")
+	if err != nil {
+		return "", err
+	}
+	if _, err := runGit(ctx, repoRoot, nil, "", "clone", "--quiet", "--no-checkout", repoRoot, dir); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("error cloning %s: %w", repoRoot, err)
+	}
+	if _, err := runGit(ctx, dir, nil, "", "checkout", "--quiet", "--detach", commit); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("error checking out %s: %w", commit, err)
+	}
+	return dir, nil
+}
+
+// gitCommitInfo identifies a single commit.
+type gitCommitInfo struct {
+	Hash string
+	Date time.Time
 }
 
-func gitHasChanges(repoRoot string) (bool, error) {
-	cmd := exec.Command("git", "status", "--porcelain")
+// gitHeadCommit returns the commit checked out in repoRoot.
+func gitHeadCommit(repoRoot string) (*gitCommitInfo, error) {
+	commit, err := gitLogOne(repoRoot, "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("error reading HEAD commit: %w", err)
+	}
+	if commit == nil {
+		return nil, fmt.Errorf("error reading HEAD commit: repository has no commits")
+	}
+	return commit, nil
+}
+
+// gitLastCommit returns the most recent commit that touched path, which is
+// relative to repoRoot. It returns a nil info if no commit touched it yet.
+func gitLastCommit(repoRoot, path string) (*gitCommitInfo, error) {
+	commit, err := gitLogOne(repoRoot, "--", path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading history of %s: %w", path, err)
+	}
+	return commit, nil
+}
+
+// gitLogOne returns the first commit listed by git log with args, or nil
+// if git log lists none.
+func gitLogOne(repoRoot string, args ...string) (*gitCommitInfo, error) {
+	cmd := exec.Command("git", append([]string{"log", "-1", "--format=%H%x00%cI"}, args...)...)
 	cmd.Dir = repoRoot
 	output, err := cmd.Output()
 	if err != nil {
-		return false, err
+		return nil, gitError(err)
 	}
-	return len(strings.TrimSpace(string(output))) > 0, nil
+	line := strings.TrimSpace(string(output))
+	if line == "" {
+		return nil, nil
+	}
+	parts := strings.SplitN(line, "\x00", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("unexpected git log output: %q", line)
+	}
+	date, err := time.Parse(time.RFC3339, parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid commit date: %w", err)
+	}
+	return &gitCommitInfo{Hash: parts[0], Date: date.UTC()}, nil
 }
 
-func gitCommit() error {
-	cmd := exec.Command("git", "commit", "-m", "Update gitspace-catalog.toml")
-	output, err := cmd.CombinedOutput()
+// gitError adds git's stderr to an exec error, if there is any.
+func gitError(err error) error {
+	if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return err
+}
+
+// gitTracked reports whether path, relative to repoRoot, is tracked at
+// HEAD.
+func gitTracked(repoRoot, path string) (bool, error) {
+	cmd := exec.Command("git", "ls-tree", "--name-only", "HEAD", "--", path)
+	cmd.Dir = repoRoot
+	output, err := cmd.Output()
 	if err != nil {
-		return fmt.Errorf("%w: %s", err, string(output))
+		return false, fmt.Errorf("error checking whether %s is tracked: %w", path, gitError(err))
 	}
-	return nil
+	return strings.TrimSpace(string(output)) != "", nil
 }
 
-func gitPush() error {
-	cmd := exec.Command("git", "push")
-	output, err := cmd.CombinedOutput()
+// gitRevParse returns the object name rev resolves to in repoRoot, or ""
+// if it does not resolve, e.g. a branch that does not exist or a path
+// that is not in a commit.
+func gitRevParse(repoRoot, rev string) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "--verify", "--quiet", rev)
+	cmd.Dir = repoRoot
+	output, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		return "", nil
+	}
 	if err != nil {
-		return fmt.Errorf("%w: %s", err, string(output))
+		return "", fmt.Errorf("error resolving %s: %w", rev, gitError(err))
 	}
-	return nil
+	return strings.TrimSpace(string(output)), nil
+}
+
+// gitBlobSHA returns the object name git gives a file with content.
+func gitBlobSHA(content []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(content))
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
 }
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The identity of commits made by gitPublisher when git has no user
+// configured, as on a fresh CI runner.
+const (
+	gitPublisherName  = "GitHub Actions"
+	gitPublisherEmail = "github-actions[bot]@users.noreply.github.com"
+)
+
+// gitPublisher publishes with the git command line: it commits to a remote
+// of the local repository, using whatever credentials git is set up with.
+type gitPublisher struct {
+	// RepoRoot is the local repository that git runs in.
+	RepoRoot string
+	// Remote is the remote pushed to, such as origin.
+	Remote string
+	// Progress receives the progress messages.
+	Progress io.Writer
+}
+
+func newGitPublisher(w io.Writer, repoRoot, remote string) *gitPublisher {
+	return &gitPublisher{RepoRoot: repoRoot, Remote: remote, Progress: w}
+}
+
+func (g *gitPublisher) Name() string {
+	return publisherGit
+}
+
+// fetch fetches branch from the remote and returns the commit it points
+// to.
+func (g *gitPublisher) fetch(ctx context.Context, branch string) (string, error) {
+	fmt.Fprintf(g.Progress, "Fetching %s from %s\n", branch, g.Remote)
+	return gitFetch(ctx, g.RepoRoot, g.Remote, branch)
+}
+
+// Publish fetches branch from the remote and builds the commit on top of
+// it in a temporary index of RepoRoot, so neither its working tree nor its
+// checked out branch is touched. The commit is then pushed to branch,
+// which the remote rejects unless the push fast-forwards it. The catalog
+// files are read from repoRoot, which may be a checkout other than
+// RepoRoot.
+func (g *gitPublisher) Publish(ctx context.Context, branch, base, repoRoot, catalogPath string) (string, error) {
+	parent, err := g.fetch(ctx, branch)
+	if err != nil {
+		return "", err
+	}
+	if err := checkBase(branch, base, parent); err != nil {
+		return "", err
+	}
+
+	entries, err := generatedTreeEntries(g.Progress, repoRoot, catalogPath, filepath.Dir(catalogPath))
+	if err != nil {
+		return "", err
+	}
+
+	index, err := os.CreateTemp("", "gitspace-catalog-index-")
+	if err != nil {
+		return "", fmt.Errorf("error creating index: %w", err)
+	}
+	index.Close()
+	defer os.Remove(index.Name())
+	env := []string{"GIT_INDEX_FILE=" + index.Name()}
+
+	if _, err := runGit(ctx, g.RepoRoot, env, "", "read-tree", parent); err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if entry.Content == nil {
+			if _, err := runGit(ctx, g.RepoRoot, env, "", "update-index", "--force-remove", "--", entry.GetPath()); err != nil {
+				return "", err
+			}
+			continue
+		}
+		blob, err := runGit(ctx, g.RepoRoot, nil, entry.GetContent(), "hash-object", "-w", "--stdin")
+		if err != nil {
+			return "", fmt.Errorf("error writing %s: %w", entry.GetPath(), err)
+		}
+		cacheInfo := fmt.Sprintf("%s,%s,%s", entry.GetMode(), blob, entry.GetPath())
+		if _, err := runGit(ctx, g.RepoRoot, env, "", "update-index", "--add", "--cacheinfo", cacheInfo); err != nil {
+			return "", err
+		}
+	}
+	tree, err := runGit(ctx, g.RepoRoot, env, "", "write-tree")
+	if err != nil {
+		return "", fmt.Errorf("error creating tree: %w", err)
+	}
+
+	if email, _ := runGit(ctx, g.RepoRoot, nil, "", "config", "user.email"); email == "" {
+		env = append(env,
+			"GIT_AUTHOR_NAME="+gitPublisherName, "GIT_AUTHOR_EMAIL="+gitPublisherEmail,
+			"GIT_COMMITTER_NAME="+gitPublisherName, "GIT_COMMITTER_EMAIL="+gitPublisherEmail)
+	}
+	commit, err := runGit(ctx, g.RepoRoot, env, "", "commit-tree", tree, "-p", parent, "-m", commitMessage)
+	if err != nil {
+		return "", fmt.Errorf("error creating commit: %w", err)
+	}
+
+	fmt.Fprintf(g.Progress, "Pushing %s to %s %s\n", commit, g.Remote, branch)
+	_, err = runGit(ctx, g.RepoRoot, nil, "", "push", "--quiet", g.Remote, commit+":refs/heads/"+branch)
+	if err != nil && strings.Contains(err.Error(), "[rejected]") {
+		return "", fmt.Errorf("error pushing to %s: %w: %w", branch, errNonFastForward, err)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error pushing to %s: %w", branch, err)
+	}
+	fmt.Fprintln(g.Progress, "Successfully committed and pushed changes")
+	return commit, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func gitTest(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	output, err := runGit(context.Background(), dir, nil, "", args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return output
+}
+
+// newTestRemote returns a clone of a new bare repository whose master
+// holds testBaseCatalog and its generated files, and the bare repository.
+func newTestRemote(t *testing.T) (string, string) {
+	t.Helper()
+	remote := t.TempDir()
+	gitTest(t, remote, "init", "--quiet", "--bare", "--initial-branch=master")
+	repoRoot := t.TempDir()
+	gitTest(t, repoRoot, "clone", "--quiet", remote, ".")
+	gitTest(t, repoRoot, "config", "user.name", "Test")
+	gitTest(t, repoRoot, "config", "user.email", "test@example.com")
+
+	catalogPath := writeTestCatalog(t, repoRoot)
+	if err := os.WriteFile(catalogPath, []byte(testBaseCatalog), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitTest(t, repoRoot, "add", ".")
+	gitTest(t, repoRoot, "commit", "--quiet", "-m", "Initial catalog")
+	gitTest(t, repoRoot, "push", "--quiet", "origin", "master")
+	return repoRoot, remote
+}
+
+func TestGitPublisherPushesToRemote(t *testing.T) {
+	repoRoot, remote := newTestRemote(t)
+	head := gitTest(t, repoRoot, "rev-parse", "HEAD")
+
+	// The update changes the catalog and, without a signing key, removes
+	// the tracked signature.
+	catalogPath := filepath.Join(repoRoot, "gitspace-catalog.toml")
+	if err := os.WriteFile(catalogPath, []byte(testCatalog), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(repoRoot, signatureFile)); err != nil {
+		t.Fatal(err)
+	}
+
+	sha, err := newGitPublisher(io.Discard, repoRoot, "origin").Publish(context.Background(), "master", head, repoRoot, catalogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := gitTest(t, remote, "rev-parse", "master"); got != sha {
+		t.Errorf("remote master = %s, want %s", got, sha)
+	}
+	if got := gitTest(t, remote, "rev-parse", sha+"^"); got != head {
+		t.Errorf("parent = %s, want %s", got, head)
+	}
+	if got := gitTest(t, remote, "show", "master:gitspace-catalog.toml"); got+"\n" != testCatalog {
+		t.Errorf("published catalog:\n%s", got)
+	}
+	if got := gitTest(t, remote, "ls-tree", "--name-only", "master", signatureFile); got != "" {
+		t.Errorf("%s was not deleted", signatureFile)
+	}
+	if got := gitTest(t, remote, "log", "-1", "--format=%s", "master"); got != commitMessage {
+		t.Errorf("commit message = %q", got)
+	}
+
+	// The checkout is left alone.
+	if got := gitTest(t, repoRoot, "rev-parse", "HEAD"); got != head {
+		t.Errorf("local HEAD moved to %s", got)
+	}
+	if status := gitTest(t, repoRoot, "status", "--porcelain"); status == "" {
+		t.Error("local changes were committed to the checkout")
+	}
+}
+
+func TestGitPublisherMissingBranch(t *testing.T) {
+	repoRoot, _ := newTestRemote(t)
+	_, err := newGitPublisher(io.Discard, repoRoot, "origin").Publish(context.Background(), "main", "", repoRoot, filepath.Join(repoRoot, "gitspace-catalog.toml"))
+	if err == nil {
+		t.Fatal("publishing to a missing branch succeeded")
+	}
+}
+
+func TestGitPublisherRejectsMovedBase(t *testing.T) {
+	repoRoot, remote := newTestRemote(t)
+	head := gitTest(t, repoRoot, "rev-parse", "HEAD")
+
+	// Another clone moves master after repoRoot was updated.
+	other := t.TempDir()
+	gitTest(t, other, "clone", "--quiet", remote, ".")
+	gitTest(t, other, "config", "user.name", "Other")
+	gitTest(t, other, "config", "user.email", "other@example.com")
+	gitTest(t, other, "commit", "--quiet", "--allow-empty", "-m", "Concurrent update")
+	gitTest(t, other, "push", "--quiet", "origin", "master")
+	moved := gitTest(t, other, "rev-parse", "HEAD")
+
+	catalogPath := filepath.Join(repoRoot, "gitspace-catalog.toml")
+	_, err := newGitPublisher(io.Discard, repoRoot, "origin").Publish(context.Background(), "master", head, repoRoot, catalogPath)
+	if !errors.Is(err, errNonFastForward) {
+		t.Fatalf("err = %v, want errNonFastForward", err)
+	}
+	if got := gitTest(t, remote, "rev-parse", "master"); got != moved {
+		t.Errorf("remote master moved to %s", got)
+	}
+}
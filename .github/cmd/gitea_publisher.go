@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// giteaTokenEnv holds the access token giteaPublisher authenticates with.
+const giteaTokenEnv = "GITEA_TOKEN"
+
+// giteaPublisher publishes through the REST API of a Gitea instance, such
+// as the one the scmtea plugin runs. It needs Gitea 1.20 or later, which
+// can change several files in one commit.
+type giteaPublisher struct {
+	// BaseURL is the address of the instance, such as
+	// http://localhost:3000, without /api/v1.
+	BaseURL string
+	Token   string
+	Owner   string
+	Repo    string
+	Client  *http.Client
+	// Progress receives the progress messages.
+	Progress io.Writer
+}
+
+func newGiteaPublisher(w io.Writer, baseURL, token, owner, repo string) *giteaPublisher {
+	return &giteaPublisher{
+		BaseURL:  strings.TrimSuffix(baseURL, "/"),
+		Token:    token,
+		Owner:    owner,
+		Repo:     repo,
+		Client:   http.DefaultClient,
+		Progress: w,
+	}
+}
+
+func (g *giteaPublisher) Name() string {
+	return publisherGitea
+}
+
+// giteaError is the body of a Gitea API error response.
+type giteaError struct {
+	StatusCode int
+	Message    string `json:"message"`
+}
+
+func (e *giteaError) Error() string {
+	return fmt.Sprintf("gitea API responded with %d: %s", e.StatusCode, e.Message)
+}
+
+func isGiteaNotFound(err error) bool {
+	var giteaErr *giteaError
+	return errors.As(err, &giteaErr) && giteaErr.StatusCode == http.StatusNotFound
+}
+
+// isGiteaConflict reports whether err is Gitea refusing to change files
+// that changed on the branch since they were read: a file updated or
+// deleted with a stale SHA, or created by someone else in the meantime.
+func isGiteaConflict(err error) bool {
+	var giteaErr *giteaError
+	if !errors.As(err, &giteaErr) || giteaErr.StatusCode != http.StatusUnprocessableEntity {
+		return false
+	}
+	message := strings.ToLower(giteaErr.Message)
+	return strings.Contains(message, "sha does not match") || strings.Contains(message, "already exists")
+}
+
+// do calls the repository API at path, relative to /repos/<owner>/<repo>,
+// sending in as JSON if it is not nil and decoding the response into out.
+func (g *giteaPublisher) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		content, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(content)
+	}
+	endpoint := fmt.Sprintf("%s/api/v1/repos/%s/%s/%s", g.BaseURL, url.PathEscape(g.Owner), url.PathEscape(g.Repo), path)
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if g.Token != "" {
+		req.Header.Set("Authorization", "token "+g.Token)
+	}
+
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		giteaErr := &giteaError{StatusCode: resp.StatusCode}
+		json.NewDecoder(resp.Body).Decode(giteaErr)
+		if giteaErr.Message == "" {
+			giteaErr.Message = resp.Status
+		}
+		return giteaErr
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// giteaFileChange is one file of a giteaChangeFiles request.
+type giteaFileChange struct {
+	// Operation is "create", "update" or "delete".
+	Operation string `json:"operation"`
+	Path      string `json:"path"`
+	// Content is base64 encoded.
+	Content string `json:"content,omitempty"`
+	// SHA is the blob being updated or deleted.
+	SHA string `json:"sha,omitempty"`
+}
+
+// giteaChangeFiles is the body of POST /repos/<owner>/<repo>/contents.
+type giteaChangeFiles struct {
+	Branch  string            `json:"branch"`
+	Message string            `json:"message"`
+	Files   []giteaFileChange `json:"files"`
+}
+
+// Publish commits the catalog at catalogPath and the generated files next
+// to it to branch in a single commit. Files whose content did not change
+// are left out, and nothing is committed if none changed. Gitea checks the
+// SHA of every file changed against the branch, so a concurrent push that
+// changed one of them fails the commit with errNonFastForward, and a retry
+// updates the catalog again on the new state of the branch. Gitea cannot
+// make the commit conditional on the branch head, nor move a branch only
+// if it still points to a given commit, so a concurrent push that changed
+// none of the files does not stop the commit: it lands on top of that
+// push. Publish then reports it and returns the commit, rather than
+// errNonFastForward, since retrying would commit the catalog a second time.
+func (g *giteaPublisher) Publish(ctx context.Context, branch, base, repoRoot, catalogPath string) (string, error) {
+	fmt.Fprintf(g.Progress, "Attempting to access Gitea repository: %s/%s/%s\n", g.BaseURL, g.Owner, g.Repo)
+	var ref struct {
+		Commit struct {
+			ID string `json:"id"`
+		} `json:"commit"`
+	}
+	if err := g.do(ctx, http.MethodGet, "branches/"+url.PathEscape(branch), nil, &ref); err != nil {
+		return "", fmt.Errorf("error getting branch %s: %w", branch, err)
+	}
+	if err := checkBase(branch, base, ref.Commit.ID); err != nil {
+		return "", err
+	}
+
+	entries, err := generatedTreeEntries(g.Progress, repoRoot, catalogPath, filepath.Dir(catalogPath))
+	if err != nil {
+		return "", err
+	}
+	change := giteaChangeFiles{Branch: branch, Message: commitMessage}
+	for _, entry := range entries {
+		var current struct {
+			SHA string `json:"sha"`
+		}
+		err := g.do(ctx, http.MethodGet, "contents/"+entry.GetPath()+"?ref="+url.QueryEscape(branch), nil, &current)
+		if err != nil && !isGiteaNotFound(err) {
+			return "", fmt.Errorf("error reading %s: %w", entry.GetPath(), err)
+		}
+
+		file := giteaFileChange{Path: entry.GetPath(), SHA: current.SHA}
+		switch {
+		case entry.Content == nil && current.SHA == "":
+			continue
+		case entry.Content == nil:
+			file.Operation = "delete"
+		case current.SHA == gitBlobSHA([]byte(entry.GetContent())):
+			continue
+		case current.SHA == "":
+			file.Operation = "create"
+		default:
+			file.Operation = "update"
+		}
+		if entry.Content != nil {
+			file.Content = base64.StdEncoding.EncodeToString([]byte(entry.GetContent()))
+		}
+		fmt.Fprintf(g.Progress, "Gitea: %s %s\n", file.Operation, file.Path)
+		change.Files = append(change.Files, file)
+	}
+	if len(change.Files) == 0 {
+		fmt.Fprintf(g.Progress, "No files differ from %s, nothing to commit\n", branch)
+		return ref.Commit.ID, nil
+	}
+
+	var result struct {
+		Commit struct {
+			SHA     string `json:"sha"`
+			Parents []struct {
+				SHA string `json:"sha"`
+			} `json:"parents"`
+		} `json:"commit"`
+	}
+	err = g.do(ctx, http.MethodPost, "contents", change, &result)
+	if isGiteaConflict(err) {
+		return "", fmt.Errorf("error committing files: %w: %w", errNonFastForward, err)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error committing files: %w", err)
+	}
+	if parents := result.Commit.Parents; len(parents) != 1 || parents[0].SHA != ref.Commit.ID {
+		fmt.Fprintf(g.Progress, "Warning: %s moved from %s while the commit was prepared, commit %s landed on top of the concurrent push\n", branch, ref.Commit.ID, result.Commit.SHA)
+	}
+	fmt.Fprintln(g.Progress, "Successfully committed and pushed changes")
+	return result.Commit.SHA, nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeGitea is an in-memory stand-in for the Gitea repository API, with a
+// single branch.
+type fakeGitea struct {
+	mu     sync.Mutex
+	branch string
+	head   string
+	// files maps paths on the branch to their content.
+	files   map[string]string
+	changes []giteaChangeFiles
+	auth    []string
+	// commits counts the commits on the branch; commit N is "headN".
+	commits int
+	// concurrent, if set, is committed by someone else just before the
+	// next commit of the publisher.
+	concurrent map[string]string
+}
+
+// commit moves the head to a new commit and returns its parent.
+func (f *fakeGitea) commit() string {
+	parent := f.head
+	f.commits++
+	f.head = fmt.Sprintf("head%d", f.commits)
+	return parent
+}
+
+func newFakeGitea(t *testing.T, files map[string]string) (*fakeGitea, *giteaPublisher) {
+	t.Helper()
+	f := &fakeGitea{branch: "master", head: "head0", files: files}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return f, newGiteaPublisher(io.Discard, server.URL+"/", "secret", "owner", "repo")
+}
+
+func (f *fakeGitea) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.auth = append(f.auth, r.Header.Get("Authorization"))
+
+	route := strings.TrimPrefix(r.URL.Path, "/api/v1/repos/owner/repo/")
+	switch {
+	case r.Method == http.MethodGet && route == "branches/"+f.branch:
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{"commit": map[string]string{"id": f.head}})
+
+	case r.Method == http.MethodGet && strings.HasPrefix(route, "contents/"):
+		content, ok := f.files[strings.TrimPrefix(route, "contents/")]
+		if !ok || r.URL.Query().Get("ref") != f.branch {
+			writeFakeJSON(w, http.StatusNotFound, map[string]string{"message": "GetContentsOrList"})
+			return
+		}
+		writeFakeJSON(w, http.StatusOK, map[string]string{
+			"sha":     gitBlobSHA([]byte(content)),
+			"content": base64.StdEncoding.EncodeToString([]byte(content)),
+		})
+
+	case r.Method == http.MethodPost && route == "contents":
+		if f.concurrent != nil {
+			for path, content := range f.concurrent {
+				f.files[path] = content
+			}
+			f.concurrent = nil
+			f.commit()
+		}
+		var change giteaChangeFiles
+		decodeFakeJSON(r, &change)
+		for _, file := range change.Files {
+			if file.Operation != "create" && file.SHA != gitBlobSHA([]byte(f.files[file.Path])) {
+				writeFakeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "sha does not match " + file.Path})
+				return
+			}
+			content, _ := base64.StdEncoding.DecodeString(file.Content)
+			f.files[file.Path] = string(content)
+		}
+		f.changes = append(f.changes, change)
+		parent := f.commit()
+		writeFakeJSON(w, http.StatusCreated, map[string]interface{}{"commit": map[string]interface{}{
+			"sha":     f.head,
+			"parents": []map[string]string{{"sha": parent}},
+		}})
+
+	default:
+		writeFakeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+	}
+}
+
+func TestGiteaPublisherCommitsChangedFiles(t *testing.T) {
+	repoRoot := t.TempDir()
+	catalogPath := writeTestCatalog(t, repoRoot)
+	fake, publisher := newFakeGitea(t, map[string]string{
+		"gitspace-catalog.toml": testBaseCatalog,
+		changelogFile:           "generated " + changelogFile + "\n",
+	})
+
+	sha, err := publisher.Publish(context.Background(), "master", "", repoRoot, catalogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sha != "head1" {
+		t.Errorf("commit = %s, want head1", sha)
+	}
+	if len(fake.changes) != 1 {
+		t.Fatalf("%d commits, want 1", len(fake.changes))
+	}
+	operations := map[string]string{}
+	for _, file := range fake.changes[0].Files {
+		operations[file.Path] = file.Operation
+	}
+	if operations["gitspace-catalog.toml"] != "update" {
+		t.Errorf("catalog operation = %q, want update", operations["gitspace-catalog.toml"])
+	}
+	if op, ok := operations[changelogFile]; ok {
+		t.Errorf("unchanged %s was committed with %q", changelogFile, op)
+	}
+	if operations[catalogJSONFile] != "create" {
+		t.Errorf("%s operation = %q, want create", catalogJSONFile, operations[catalogJSONFile])
+	}
+	if fake.files["gitspace-catalog.toml"] != testCatalog {
+		t.Errorf("published catalog:\n%s", fake.files["gitspace-catalog.toml"])
+	}
+	for _, auth := range fake.auth {
+		if auth != "token secret" {
+			t.Errorf("Authorization = %q", auth)
+		}
+	}
+
+	// Publishing again finds nothing to commit.
+	if sha, err = publisher.Publish(context.Background(), "master", "", repoRoot, catalogPath); err != nil {
+		t.Fatal(err)
+	}
+	if sha != "head1" || len(fake.changes) != 1 {
+		t.Errorf("second publish committed again: %s, %d commits", sha, len(fake.changes))
+	}
+}
+
+func TestGiteaPublisherMissingBranch(t *testing.T) {
+	repoRoot := t.TempDir()
+	catalogPath := writeTestCatalog(t, repoRoot)
+	_, publisher := newFakeGitea(t, map[string]string{})
+
+	_, err := publisher.Publish(context.Background(), "main", "", repoRoot, catalogPath)
+	if !isGiteaNotFound(err) {
+		t.Errorf("err = %v, want a Gitea not found error", err)
+	}
+}
+
+func TestGiteaPublisherConflict(t *testing.T) {
+	repoRoot := t.TempDir()
+	catalogPath := writeTestCatalog(t, repoRoot)
+	fake, publisher := newFakeGitea(t, map[string]string{"gitspace-catalog.toml": testBaseCatalog})
+	fake.concurrent = map[string]string{"gitspace-catalog.toml": "concurrent\n"}
+
+	_, err := publisher.Publish(context.Background(), "master", "", repoRoot, catalogPath)
+	if !errors.Is(err, errNonFastForward) {
+		t.Fatalf("err = %v, want errNonFastForward", err)
+	}
+}
+
+func TestGiteaPublisherKeepsCommitOnConcurrentPush(t *testing.T) {
+	repoRoot := t.TempDir()
+	catalogPath := writeTestCatalog(t, repoRoot)
+	fake, publisher := newFakeGitea(t, map[string]string{"gitspace-catalog.toml": testBaseCatalog})
+	// The concurrent push touches none of the published files, so Gitea
+	// accepts the commit on top of it.
+	fake.concurrent = map[string]string{"README.md": "concurrent\n"}
+	var progress strings.Builder
+	publisher.Progress = &progress
+
+	sha, err := publisher.Publish(context.Background(), "master", "head0", repoRoot, catalogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sha != "head2" || fake.head != "head2" {
+		t.Errorf("commit = %s, head = %s, want the commit head2 on top of the concurrent push", sha, fake.head)
+	}
+	if len(fake.changes) != 1 {
+		t.Errorf("%d commits, want 1", len(fake.changes))
+	}
+	if fake.files["README.md"] != "concurrent\n" || fake.files["gitspace-catalog.toml"] != testCatalog {
+		t.Errorf("files after the commit: %v", fake.files)
+	}
+	if !strings.Contains(progress.String(), "landed on top of the concurrent push") {
+		t.Errorf("the concurrent push was not reported:\n%s", progress.String())
+	}
+}
+
+func TestGiteaPublisherRejectsMovedBase(t *testing.T) {
+	repoRoot := t.TempDir()
+	catalogPath := writeTestCatalog(t, repoRoot)
+	fake, publisher := newFakeGitea(t, map[string]string{"gitspace-catalog.toml": testBaseCatalog})
+
+	_, err := publisher.Publish(context.Background(), "master", "head1", repoRoot, catalogPath)
+	if !errors.Is(err, errNonFastForward) {
+		t.Fatalf("err = %v, want errNonFastForward", err)
+	}
+	if len(fake.changes) != 0 {
+		t.Errorf("%d commits made on a moved branch", len(fake.changes))
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/mod/modfile"
+)
+
+// pluginSDKModule is the module plugins use to talk to the gitspace host.
+const pluginSDKModule = "github.com/ssotops/gitspace-plugin-sdk"
+
+// parseGoMod reads the go.mod file at path.
+func parseGoMod(path string) (*modfile.File, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return modfile.Parse(path, content, nil)
+}
+
+// loadCompatibility reads the Go and plugin SDK versions from the go.mod
+// in dir, if there is one. minGitspace is the manifest's
+// min_gitspace_version. It returns nil if there is nothing to record.
+func loadCompatibility(dir, minGitspace string) (*Compatibility, error) {
+	compat := &Compatibility{MinGitspaceVersion: minGitspace}
+
+	mod, err := parseGoMod(filepath.Join(dir, "go.mod"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading go.mod: %w", err)
+	}
+	if mod != nil {
+		if mod.Go != nil {
+			compat.Go = mod.Go.Version
+		}
+		for _, r := range mod.Require {
+			if r.Mod.Path == pluginSDKModule {
+				compat.SDK = r.Mod.Version
+			}
+		}
+		for _, r := range mod.Replace {
+			if r.Old.Path != pluginSDKModule || (r.Old.Version != "" && r.Old.Version != compat.SDK) {
+				continue
+			}
+			compat.SDKReplace = r.New.Path
+			if r.New.Version != "" {
+				// Replaced by another module version, e.g. a fork.
+				compat.SDK = r.New.Version
+				compat.SDKReplace += " " + r.New.Version
+			}
+		}
+	}
+
+	if *compat == (Compatibility{}) {
+		return nil, nil
+	}
+	return compat, nil
+}
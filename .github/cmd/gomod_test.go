@@ -0,0 +1,107 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestLoadCompatibility(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		gomod string
+		want  *Compatibility
+	}{
+		{
+			name: "blocks and comments",
+			gomod: `// Package comment
+module github.com/ssotops/scmtea
+
+go 1.23.1 // toolchain minimum
+
+toolchain go1.23.4
+
+require (
+	github.com/charmbracelet/log v0.4.0
+	github.com/ssotops/gitspace-plugin-sdk v0.0.0-20241001023129-8c91f9f5d979 // plugin protocol
+)
+
+require github.com/pelletier/go-toml v1.9.5 // indirect
+
+replace (
+	// Develop against a local checkout.
+	github.com/ssotops/gitspace-plugin-sdk => ../../../gitspace-plugin-sdk
+)
+`,
+			want: &Compatibility{
+				Go:                 "1.23.1",
+				SDK:                "v0.0.0-20241001023129-8c91f9f5d979",
+				SDKReplace:         "../../../gitspace-plugin-sdk",
+				MinGitspaceVersion: "0.2.0",
+			},
+		},
+		{
+			name: "fork",
+			gomod: `module example.com/plugin
+
+go 1.22
+
+require github.com/ssotops/gitspace-plugin-sdk v1.0.0
+
+replace github.com/ssotops/gitspace-plugin-sdk v1.0.0 => github.com/example/gitspace-plugin-sdk v1.0.1-fork
+`,
+			want: &Compatibility{
+				Go:                 "1.22",
+				SDK:                "v1.0.1-fork",
+				SDKReplace:         "github.com/example/gitspace-plugin-sdk v1.0.1-fork",
+				MinGitspaceVersion: "0.2.0",
+			},
+		},
+		{
+			name: "replace of another version",
+			gomod: `module example.com/plugin
+
+go 1.22
+
+require github.com/ssotops/gitspace-plugin-sdk v1.0.0
+
+replace github.com/ssotops/gitspace-plugin-sdk v0.9.0 => ./sdk
+`,
+			want: &Compatibility{Go: "1.22", SDK: "v1.0.0", MinGitspaceVersion: "0.2.0"},
+		},
+		{
+			name:  "no sdk",
+			gomod: "module example.com/template\n\ngo 1.23.0\n",
+			want:  &Compatibility{Go: "1.23.0", MinGitspaceVersion: "0.2.0"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTestFiles(t, dir, map[string]string{"go.mod": tc.gomod})
+			got, err := loadCompatibility(dir, "0.2.0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != *tc.want {
+				t.Errorf("compatibility = %+v, want %+v", *got, *tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadCompatibilityWithoutGoMod(t *testing.T) {
+	got, err := loadCompatibility(t.TempDir(), "")
+	if err != nil || got != nil {
+		t.Errorf("loadCompatibility() = %+v, %v; want nil", got, err)
+	}
+	got, err = loadCompatibility(t.TempDir(), "0.2.0")
+	if err != nil || got == nil || *got != (Compatibility{MinGitspaceVersion: "0.2.0"}) {
+		t.Errorf("loadCompatibility() = %+v, %v; want only min_gitspace_version", got, err)
+	}
+}
+
+func TestLoadCompatibilityReportsSyntaxErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"go.mod": "module example.com/x\n\nrequire (\n\tgithub.com/a\n)\n"})
+	if _, err := loadCompatibility(dir, ""); err == nil {
+		t.Error("loadCompatibility accepted a malformed go.mod")
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"dagger.io/dagger"
+	"github.com/pelletier/go-toml"
+)
+
+// imageLockFile pins the images the Dagger pipeline runs by digest. It is
+// written by the pin-images command, next to the tool's go.mod.
+const imageLockFile = ".github/dagger-images.toml"
+
+// pipelineImages are the images the Dagger pipeline runs.
+var pipelineImages = []string{goBuilderImage}
+
+// imageLock maps image tags, such as golang:1.23, to references pinned by
+// digest, such as docker.io/library/golang:1.23@sha256:....
+type imageLock map[string]string
+
+// loadImageLock reads the image lock of repoRoot. A missing lock is nil.
+func loadImageLock(repoRoot string) (imageLock, error) {
+	path := filepath.Join(repoRoot, imageLockFile)
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", imageLockFile, err)
+	}
+	tree, err := toml.LoadBytes(content)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", imageLockFile, err)
+	}
+	lock := imageLock{}
+	images, _ := tree.Get("images").(*toml.Tree)
+	if images == nil {
+		return lock, nil
+	}
+	for _, tag := range images.Keys() {
+		ref, ok := images.GetPath([]string{tag}).(string)
+		if !ok || !strings.Contains(ref, "@sha256:") {
+			return nil, fmt.Errorf("%s: image %q must be pinned to a sha256 digest", imageLockFile, tag)
+		}
+		lock[tag] = ref
+	}
+	return lock, nil
+}
+
+// write saves the lock to repoRoot.
+func (l imageLock) write(w io.Writer, repoRoot string) error {
+	var b strings.Builder
+	b.WriteString("# Images the Dagger pipeline runs, pinned by digest.\n")
+	b.WriteString("# Generated by `go run ./cmd pin-images`; rerun it to update them.\n\n")
+	b.WriteString("[images]\n")
+	for _, tag := range sortedKeys(l) {
+		fmt.Fprintf(&b, "%q = %q\n", tag, l[tag])
+	}
+	path := filepath.Join(repoRoot, imageLockFile)
+	fmt.Fprintf(w, "Writing pinned images to %s\n", path)
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// resolve returns the pinned reference of tag. The pipeline only runs
+// pinned images, so a missing lock, or a tag missing from it, is an error.
+func (l imageLock) resolve(w io.Writer, tag string) (string, error) {
+	if l == nil {
+		return "", fmt.Errorf("%s does not exist: run `go run ./cmd pin-images` and commit the lock", imageLockFile)
+	}
+	ref, ok := l[tag]
+	if !ok {
+		return "", fmt.Errorf("%s is not pinned in %s: run `go run ./cmd pin-images` and commit the lock", tag, imageLockFile)
+	}
+	fmt.Fprintf(w, "Using %s for %s\n", ref, tag)
+	return ref, nil
+}
+
+// pinImages resolves every image in pipelineImages to its current digest
+// and writes the lock.
+func pinImages(ctx context.Context, w io.Writer, repoRoot string) error {
+	client, err := dagger.Connect(ctx, dagger.WithLogOutput(w))
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	lock := imageLock{}
+	for _, tag := range pipelineImages {
+		ref, err := client.Container().From(tag).ImageRef(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to resolve image %s: %w", tag, err)
+		}
+		fmt.Fprintf(w, "Pinned %s to %s\n", tag, ref)
+		lock[tag] = ref
+	}
+	return lock.write(w, repoRoot)
+}
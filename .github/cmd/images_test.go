@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImageLockResolve(t *testing.T) {
+	repoRoot := t.TempDir()
+	pinned := "docker.io/library/golang:1.23@sha256:" + strings.Repeat("a", 64)
+	writeTestFiles(t, repoRoot, map[string]string{
+		imageLockFile: "[images]\n\"golang:1.23\" = \"" + pinned + "\"\n",
+	})
+	lock, err := loadImageLock(repoRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref, err := lock.resolve(io.Discard, "golang:1.23"); err != nil || ref != pinned {
+		t.Errorf("resolve(golang:1.23) = %q, %v, want %q", ref, err, pinned)
+	}
+
+	// The pipeline refuses to run an image that is not pinned.
+	_, err = lock.resolve(io.Discard, "alpine:3.20")
+	if err == nil || !strings.Contains(err.Error(), "pin-images") {
+		t.Errorf("resolve(alpine:3.20) = %v, want an unpinned image error", err)
+	}
+
+	// Nor does it run anything without a lock.
+	var missing imageLock
+	if _, err := missing.resolve(io.Discard, "golang:1.23"); err == nil {
+		t.Error("resolve without a lock returned an image")
+	}
+}
+
+func TestLoadImageLockRequiresDigests(t *testing.T) {
+	repoRoot := t.TempDir()
+	writeTestFiles(t, repoRoot, map[string]string{
+		imageLockFile: "[images]\n\"golang:1.23\" = \"golang:1.23\"\n",
+	})
+	if _, err := loadImageLock(repoRoot); err == nil {
+		t.Error("loadImageLock accepted an image without a digest")
+	}
+}
+
+// TestRepoImageLock checks that the lock committed to this repository pins
+// every image the pipeline runs.
+func TestRepoImageLock(t *testing.T) {
+	lock, err := loadImageLock(filepath.Join("..", ".."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock == nil {
+		t.Fatalf("%s is not committed: run `go run ./cmd pin-images` and commit the lock", imageLockFile)
+	}
+	for _, tag := range pipelineImages {
+		if _, ok := lock[tag]; !ok {
+			t.Errorf("%s does not pin %s: run `go run ./cmd pin-images`", imageLockFile, tag)
+		}
+	}
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/pelletier/go-toml"
+)
+
+const (
+	pluginManifestName   = "gitspace-plugin.toml"
+	templateManifestName = "gitspace-template.toml"
+)
+
+// Severity of a manifest diagnostic. Only errors fail validation.
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Diagnostic is a single problem found in a manifest file.
+type Diagnostic struct {
+	File     string   `json:"file"`
+	Line     int      `json:"line"`
+	Col      int      `json:"column"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s", d.File, d.Line, d.Col, d.Severity, d.Message)
+}
+
+type fieldKind int
+
+const (
+	kindString fieldKind = iota
+	kindSemver
+	kindStringArray
+	kindStringTable
+	kindVariables
+	kindFiles
+	kindRequires
+	// kindSources is validated by checkSources rather than checkValue.
+	kindSources
+)
+
+// fieldRule describes one key of a manifest section.
+type fieldRule struct {
+	key      string
+	kind     fieldKind
+	required bool
+}
+
+// pluginSectionSchema applies to [metadata] and the older [plugin] section
+// of gitspace-plugin.toml.
+var pluginSectionSchema = []fieldRule{
+	{key: "name", kind: kindString, required: true},
+	{key: "version", kind: kindSemver, required: true},
+	{key: "description", kind: kindString, required: true},
+	{key: "author", kind: kindString},
+	{key: "license", kind: kindString},
+	{key: "homepage", kind: kindString},
+	{key: "tags", kind: kindStringArray},
+	{key: "keywords", kind: kindStringArray},
+	{key: "dependencies", kind: kindStringTable},
+	{key: "requires", kind: kindRequires},
+	{key: "min_gitspace_version", kind: kindSemver},
+}
+
+// templateSectionSchema applies to the [template] section of
+// gitspace-template.toml.
+var templateSectionSchema = []fieldRule{
+	{key: "name", kind: kindString, required: true},
+	{key: "version", kind: kindSemver, required: true},
+	{key: "description", kind: kindString, required: true},
+	{key: "author", kind: kindString},
+	{key: "license", kind: kindString},
+	{key: "homepage", kind: kindString},
+	{key: "tags", kind: kindStringArray},
+	{key: "keywords", kind: kindStringArray},
+	{key: "dependencies", kind: kindStringTable},
+	{key: "requires", kind: kindRequires},
+	{key: "min_gitspace_version", kind: kindSemver},
+	{key: "variables", kind: kindVariables},
+	{key: "hooks", kind: kindStringTable},
+	{key: "files", kind: kindFiles},
+	{key: "structure", kind: kindStringTable},
+	{key: "commands", kind: kindStringTable},
+}
+
+// templateFilesSchema applies to [template.files].
+var templateFilesSchema = []fieldRule{
+	{key: "include", kind: kindStringArray},
+	{key: "exclude", kind: kindStringArray},
+}
+
+// sourceSchema applies to every [[sources]] table of a plugin manifest.
+var sourceSchema = []fieldRule{
+	{key: "path", kind: kindString, required: true},
+	{key: "entry_point", kind: kindString, required: true},
+}
+
+var variableTypes = map[string]bool{
+	"string": true,
+	"bool":   true,
+	"int":    true,
+	"float":  true,
+	"array":  true,
+}
+
+var tomlErrorPattern = regexp.MustCompile(`^\((\d+), (\d+)\): (.*)$`)
+
+type manifestValidator struct {
+	file  string
+	dir   string
+	diags []Diagnostic
+}
+
+func (v *manifestValidator) report(severity Severity, pos toml.Position, format string, args ...interface{}) {
+	if pos.Invalid() {
+		pos = toml.Position{Line: 1, Col: 1}
+	}
+	v.diags = append(v.diags, Diagnostic{
+		File:     v.file,
+		Line:     pos.Line,
+		Col:      pos.Col,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *manifestValidator) errorf(pos toml.Position, format string, args ...interface{}) {
+	v.report(SeverityError, pos, format, args...)
+}
+
+func (v *manifestValidator) warnf(pos toml.Position, format string, args ...interface{}) {
+	v.report(SeverityWarning, pos, format, args...)
+}
+
+func (v *manifestValidator) load(path string) *toml.Tree {
+	tree, err := toml.LoadFile(path)
+	if err != nil {
+		if m := tomlErrorPattern.FindStringSubmatch(err.Error()); m != nil {
+			line, _ := strconv.Atoi(m[1])
+			col, _ := strconv.Atoi(m[2])
+			v.errorf(toml.Position{Line: line, Col: col}, "invalid TOML: %s", m[3])
+		} else {
+			v.errorf(toml.Position{}, "invalid TOML: %v", err)
+		}
+		return nil
+	}
+	return tree
+}
+
+// checkFields validates section against rules and warns about keys that
+// are not part of the schema.
+func (v *manifestValidator) checkFields(section *toml.Tree, name string, rules []fieldRule) {
+	known := make(map[string]bool)
+	for _, rule := range rules {
+		known[rule.key] = true
+		value := section.GetPath([]string{rule.key})
+		pos := section.GetPositionPath([]string{rule.key})
+		if value == nil {
+			if rule.required {
+				v.errorf(section.Position(), "%s: missing required field %q", name, rule.key)
+			}
+			continue
+		}
+		v.checkValue(value, pos, name+"."+rule.key, rule.kind)
+	}
+	for _, key := range section.Keys() {
+		if !known[key] {
+			v.warnf(section.GetPositionPath([]string{key}), "%s: unknown field %q", name, key)
+		}
+	}
+}
+
+func (v *manifestValidator) checkValue(value interface{}, pos toml.Position, name string, kind fieldKind) {
+	switch kind {
+	case kindString:
+		if s, ok := value.(string); !ok || s == "" {
+			v.errorf(pos, "%s: expected a non-empty string", name)
+		}
+	case kindSemver:
+		s, ok := value.(string)
+		if !ok {
+			v.errorf(pos, "%s: expected a version string", name)
+			return
+		}
+		if _, err := parseSemver(s); err != nil {
+			v.errorf(pos, "%s: %v", name, err)
+		}
+	case kindStringArray:
+		items, ok := value.([]interface{})
+		if !ok {
+			v.errorf(pos, "%s: expected an array of strings", name)
+			return
+		}
+		for i, item := range items {
+			if _, ok := item.(string); !ok {
+				v.errorf(pos, "%s[%d]: expected a string, got %T", name, i, item)
+			}
+		}
+	case kindStringTable:
+		table, ok := value.(*toml.Tree)
+		if !ok {
+			v.errorf(pos, "%s: expected a table", name)
+			return
+		}
+		for _, key := range table.Keys() {
+			if _, ok := table.GetPath([]string{key}).(string); !ok {
+				v.errorf(table.GetPositionPath([]string{key}), "%s.%s: expected a string", name, key)
+			}
+		}
+	case kindRequires:
+		table, ok := value.(*toml.Tree)
+		if !ok {
+			v.errorf(pos, "%s: expected a table", name)
+			return
+		}
+		for _, item := range entryKeyItems(table) {
+			itemPos := item.Pos
+			if itemPos.Invalid() {
+				itemPos = pos
+			}
+			if !isEntryKey(item.Key) {
+				v.errorf(itemPos, "%s: %q is not an entry key (expected \"plugins.<name>\" or \"templates.<name>\")", name, item.Key)
+			}
+			constraint, ok := item.Value.(string)
+			if !ok {
+				v.errorf(itemPos, "%s.%s: expected a version constraint string", name, item.Key)
+				continue
+			}
+			if _, err := parseConstraint(constraint); err != nil {
+				v.errorf(itemPos, "%s.%s: %v", name, item.Key, err)
+			}
+		}
+	case kindFiles:
+		table, ok := value.(*toml.Tree)
+		if !ok {
+			v.errorf(pos, "%s: expected a table", name)
+			return
+		}
+		v.checkFields(table, name, templateFilesSchema)
+	case kindVariables:
+		table, ok := value.(*toml.Tree)
+		if !ok {
+			v.errorf(pos, "%s: expected a table", name)
+			return
+		}
+		for _, key := range table.Keys() {
+			v.checkVariable(table, name, key)
+		}
+	}
+}
+
+func (v *manifestValidator) checkVariable(table *toml.Tree, name, key string) {
+	pos := table.GetPositionPath([]string{key})
+	if pos.Invalid() {
+		// Inline tables do not record their own position.
+		pos = table.Position()
+	}
+	variable, ok := table.GetPath([]string{key}).(*toml.Tree)
+	if !ok {
+		v.errorf(pos, "%s.%s: expected a table with at least a type", name, key)
+		return
+	}
+	typ, ok := variable.Get("type").(string)
+	if !ok {
+		v.errorf(pos, "%s.%s: missing required field \"type\"", name, key)
+		return
+	}
+	if !variableTypes[typ] {
+		v.errorf(pos, "%s.%s: unsupported variable type %q", name, key, typ)
+		return
+	}
+	def := variable.Get("default")
+	if def == nil {
+		return
+	}
+	var matches bool
+	switch typ {
+	case "string":
+		_, matches = def.(string)
+	case "bool":
+		_, matches = def.(bool)
+	case "int":
+		_, matches = def.(int64)
+	case "float":
+		_, matches = def.(float64)
+	case "array":
+		_, matches = def.([]interface{})
+	}
+	if !matches {
+		v.errorf(pos, "%s.%s: default value does not match type %q", name, key, typ)
+	}
+}
+
+func (v *manifestValidator) checkSources(tree *toml.Tree, key string) {
+	value := tree.GetPath([]string{key})
+	if value == nil {
+		v.errorf(tree.Position(), "missing required [[%s]] table", key)
+		return
+	}
+	sources, ok := value.([]*toml.Tree)
+	if !ok {
+		v.errorf(tree.GetPositionPath([]string{key}), "%s: expected an array of tables ([[%s]])", key, key)
+		return
+	}
+	for i, source := range sources {
+		name := fmt.Sprintf("%s[%d]", key, i)
+		v.checkFields(source, name, sourceSchema)
+		path, ok := source.Get("path").(string)
+		if !ok || path == "" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(v.dir, path)); err != nil {
+			v.errorf(source.GetPosition("path"), "%s.path: source file %q does not exist", name, path)
+		}
+	}
+}
+
+func validatePluginManifest(path, displayPath string) []Diagnostic {
+	v := &manifestValidator{file: displayPath, dir: filepath.Dir(path)}
+	tree := v.load(path)
+	if tree == nil {
+		return v.diags
+	}
+
+	switch {
+	case tree.Has("metadata"):
+		// New format: [metadata] plus top-level [[sources]]
+		section, ok := tree.Get("metadata").(*toml.Tree)
+		if !ok {
+			v.errorf(tree.GetPosition("metadata"), "metadata: expected a table")
+			return v.diags
+		}
+		v.checkFields(section, "metadata", pluginSectionSchema)
+		v.checkSources(tree, "sources")
+	case tree.Has("plugin"):
+		// Old format: [plugin] with nested [[plugin.sources]]
+		section, ok := tree.Get("plugin").(*toml.Tree)
+		if !ok {
+			v.errorf(tree.GetPosition("plugin"), "plugin: expected a table")
+			return v.diags
+		}
+		rules := append([]fieldRule{{key: "sources", kind: kindSources}}, pluginSectionSchema...)
+		v.checkFields(section, "plugin", rules)
+		v.checkSources(section, "sources")
+	default:
+		v.errorf(tree.Position(), "neither [metadata] nor [plugin] section found")
+	}
+	return v.diags
+}
+
+func validateTemplateManifest(path, displayPath string) []Diagnostic {
+	v := &manifestValidator{file: displayPath, dir: filepath.Dir(path)}
+	tree := v.load(path)
+	if tree == nil {
+		return v.diags
+	}
+
+	section, ok := tree.Get("template").(*toml.Tree)
+	if !ok {
+		v.errorf(tree.GetPosition("template"), "missing required [template] section")
+		return v.diags
+	}
+	v.checkFields(section, "template", templateSectionSchema)
+	return v.diags
+}
+
+// validateManifests checks the manifests of every discovered entry and
+// returns all diagnostics, with file paths relative to repoRoot.
+func validateManifests(repoRoot string, entries []discoveredEntry) []Diagnostic {
+	var diags []Diagnostic
+	for _, entry := range entries {
+		for _, path := range entry.Manifests {
+			displayPath, err := filepath.Rel(repoRoot, path)
+			if err != nil {
+				displayPath = path
+			}
+			if filepath.Base(path) == pluginManifestName {
+				diags = append(diags, validatePluginManifest(path, displayPath)...)
+			} else {
+				diags = append(diags, validateTemplateManifest(path, displayPath)...)
+			}
+		}
+	}
+	sort.SliceStable(diags, func(i, j int) bool {
+		if diags[i].File != diags[j].File {
+			return diags[i].File < diags[j].File
+		}
+		if diags[i].Line != diags[j].Line {
+			return diags[i].Line < diags[j].Line
+		}
+		return diags[i].Col < diags[j].Col
+	})
+	return diags
+}
+
+func hasErrors(diags []Diagnostic) bool {
+	for _, d := range diags {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestFiles writes files, keyed by slash-separated path, under root.
+func writeTestFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestValidateManifestDiagnostics(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		manifest string
+		content  string
+		want     string
+	}{
+		{
+			name:     "missing required field",
+			manifest: templateManifestName,
+			content: `[template]
+name = "starter"
+version = "0.1.0"
+`,
+			want: `gitspace-template.toml:1:1: error: template: missing required field "description"`,
+		},
+		{
+			name:     "non-semver version",
+			manifest: templateManifestName,
+			content: `[template]
+name = "starter"
+description = "A starter"
+version = "one"
+`,
+			want: `gitspace-template.toml:4:1: error: template.version: `,
+		},
+		{
+			name:     "source without path",
+			manifest: pluginManifestName,
+			content: `[metadata]
+name = "scmtea"
+version = "1.0.0"
+description = "Gitea"
+
+[[sources]]
+entry_point = "Plugin"
+`,
+			want: `gitspace-plugin.toml:6:1: error: sources[0]: missing required field "path"`,
+		},
+		{
+			name:     "missing source file",
+			manifest: pluginManifestName,
+			content: `[metadata]
+name = "scmtea"
+version = "1.0.0"
+description = "Gitea"
+
+[[sources]]
+path = "main.go"
+entry_point = "Plugin"
+`,
+			want: `gitspace-plugin.toml:7:1: error: sources[0].path: source file "main.go" does not exist`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTestFiles(t, dir, map[string]string{tc.manifest: tc.content})
+			entries := []discoveredEntry{{Dir: dir, Manifests: []string{filepath.Join(dir, tc.manifest)}}}
+			diags := validateManifests(dir, entries)
+			if !hasErrors(diags) {
+				t.Fatalf("no errors reported: %v", diags)
+			}
+			for _, d := range diags {
+				if strings.HasPrefix(d.String(), tc.want) {
+					return
+				}
+			}
+			t.Errorf("diagnostics %v, want one starting with %q", diags, tc.want)
+		})
+	}
+}
+
+func TestValidateManifestAcceptsValidPlugin(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"main.go": "package main\n",
+		pluginManifestName: `[metadata]
+name = "scmtea"
+version = "1.0.0"
+description = "Gitea"
+
+[[sources]]
+path = "main.go"
+entry_point = "Plugin"
+`,
+	})
+	entries := []discoveredEntry{{Dir: dir, Manifests: []string{filepath.Join(dir, pluginManifestName)}}}
+	if diags := validateManifests(dir, entries); len(diags) > 0 {
+		t.Errorf("unexpected diagnostics: %v", diags)
+	}
+}
+
+func TestRunValidateWritesDiagnostics(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		templateManifestName: "[template]\nname = \"starter\"\nversion = \"0.1.0\"\n",
+	})
+	entries := []discoveredEntry{{Dir: dir, Manifests: []string{filepath.Join(dir, templateManifestName)}}}
+	var out strings.Builder
+	if err := runValidate(&out, dir, entries); err == nil {
+		t.Error("runValidate accepted a manifest with errors")
+	}
+	if want := `missing required field "description"`; !strings.Contains(out.String(), want) {
+		t.Errorf("output %q does not contain %q", out.String(), want)
+	}
+}
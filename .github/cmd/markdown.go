@@ -0,0 +1,170 @@
+package main
+
+import (
+	"html"
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+var (
+	markdownHeading  = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	markdownBullet   = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	markdownNumbered = regexp.MustCompile(`^\s*\d+[.)]\s+(.*)$`)
+	markdownRule     = regexp.MustCompile(`^(-\s*){3,}$|^(\*\s*){3,}$|^(_\s*){3,}$`)
+	markdownLink     = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	markdownStrong   = regexp.MustCompile(`(\*\*|__)(\S(?:.*?\S)?)(\*\*|__)`)
+	markdownEmphasis = regexp.MustCompile(`(^|[^\w*])[*_](\S(?:.*?\S)?)[*_]($|[^\w*])`)
+	// markdownSafeURL allows web and mail links and relative paths. Any
+	// other scheme, such as javascript: or data:, is dropped with the link.
+	markdownSafeURL = regexp.MustCompile(`^((?i:https?://|mailto:)|#|/|\./|\.\./|[\w.-]+(/|$))`)
+)
+
+const markdownFenceMarker = "```"
+
+// renderMarkdown converts the subset of Markdown used in entry READMEs to
+// HTML: ATX headings, paragraphs, fenced code blocks, bullet and numbered
+// lists, block quotes, horizontal rules, and inline code, emphasis and
+// links. Raw HTML in the source is escaped rather than passed through.
+func renderMarkdown(src string) template.HTML {
+	var out strings.Builder
+	var paragraph []string
+	var list string
+	var quote []string
+
+	flushParagraph := func() {
+		if len(paragraph) > 0 {
+			out.WriteString("<p>" + renderInline(strings.Join(paragraph, " ")) + "</p>\n")
+			paragraph = nil
+		}
+	}
+	closeList := func() {
+		if list != "" {
+			out.WriteString("</" + list + ">\n")
+			list = ""
+		}
+	}
+	flushQuote := func() {
+		if len(quote) > 0 {
+			out.WriteString("<blockquote>\n" + string(renderMarkdown(strings.Join(quote, "\n"))) + "</blockquote>\n")
+			quote = nil
+		}
+	}
+	flush := func() {
+		flushParagraph()
+		closeList()
+		flushQuote()
+	}
+
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, markdownFenceMarker) {
+			flush()
+			lang := strings.TrimSpace(strings.TrimPrefix(trimmed, markdownFenceMarker))
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), markdownFenceMarker); i++ {
+				code = append(code, lines[i])
+			}
+			class := ""
+			if lang != "" {
+				class = ` class="language-` + html.EscapeString(lang) + `"`
+			}
+			out.WriteString("<pre><code" + class + ">" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, ">") {
+			flushParagraph()
+			closeList()
+			quote = append(quote, strings.TrimPrefix(strings.TrimPrefix(trimmed, ">"), " "))
+			continue
+		}
+		flushQuote()
+
+		switch {
+		case trimmed == "":
+			flushParagraph()
+			closeList()
+		case markdownHeading.MatchString(trimmed):
+			flush()
+			m := markdownHeading.FindStringSubmatch(trimmed)
+			level := string(rune('0' + len(m[1])))
+			out.WriteString("<h" + level + ">" + renderInline(m[2]) + "</h" + level + ">\n")
+		case markdownRule.MatchString(trimmed):
+			flush()
+			out.WriteString("<hr>\n")
+		case markdownBullet.MatchString(line):
+			flushParagraph()
+			openList(&out, &list, "ul")
+			out.WriteString("<li>" + renderInline(markdownBullet.FindStringSubmatch(line)[1]) + "</li>\n")
+		case markdownNumbered.MatchString(line):
+			flushParagraph()
+			openList(&out, &list, "ol")
+			out.WriteString("<li>" + renderInline(markdownNumbered.FindStringSubmatch(line)[1]) + "</li>\n")
+		default:
+			closeList()
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	flush()
+	return template.HTML(out.String())
+}
+
+func openList(out *strings.Builder, list *string, tag string) {
+	if *list == tag {
+		return
+	}
+	if *list != "" {
+		out.WriteString("</" + *list + ">\n")
+	}
+	out.WriteString("<" + tag + ">\n")
+	*list = tag
+}
+
+// renderInline renders code spans, links, strong and emphasis. Text
+// inside code spans is only escaped.
+func renderInline(text string) string {
+	var out strings.Builder
+	parts := strings.Split(text, "`")
+	for i, part := range parts {
+		switch {
+		case i%2 == 1 && i < len(parts)-1:
+			out.WriteString("<code>" + html.EscapeString(part) + "</code>")
+		case i%2 == 1:
+			// Unbalanced backtick: keep it as text.
+			out.WriteString("`" + renderSpans(part))
+		default:
+			out.WriteString(renderSpans(part))
+		}
+	}
+	return out.String()
+}
+
+// renderSpans renders links, strong and emphasis. Emphasis is applied to
+// the text around links and to link texts, never to link targets.
+func renderSpans(text string) string {
+	var out strings.Builder
+	last := 0
+	for _, m := range markdownLink.FindAllStringSubmatchIndex(text, -1) {
+		out.WriteString(renderEmphasis(text[last:m[0]]))
+		label, url := renderEmphasis(text[m[2]:m[3]]), text[m[4]:m[5]]
+		if markdownSafeURL.MatchString(url) {
+			out.WriteString(`<a href="` + html.EscapeString(url) + `">` + label + "</a>")
+		} else {
+			out.WriteString(label)
+		}
+		last = m[1]
+	}
+	out.WriteString(renderEmphasis(text[last:]))
+	return out.String()
+}
+
+// renderEmphasis escapes text and renders strong and emphasis in it.
+func renderEmphasis(text string) string {
+	text = html.EscapeString(text)
+	text = markdownStrong.ReplaceAllString(text, "<strong>$2</strong>")
+	return markdownEmphasis.ReplaceAllString(text, "$1<em>$2</em>$3")
+}
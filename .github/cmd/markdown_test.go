@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdownEscapesRawHTML(t *testing.T) {
+	for _, src := range []string{
+		`<script>alert(1)</script>`,
+		`<img src=x onerror=alert(1)>`,
+		"# <b onclick=alert(1)>Title</b>",
+		"- <iframe src=javascript:alert(1)>",
+		"> <script>alert(1)</script>",
+		"```html\n<script>alert(1)</script>\n```",
+		"```\"><script>alert(1)</script>\ncode\n```",
+		"`<script>` and <script>",
+		"**<script>**",
+	} {
+		got := string(renderMarkdown(src))
+		for _, tag := range []string{"<script", "<img", "<iframe", "<b ", `"><`} {
+			if strings.Contains(got, tag) {
+				t.Errorf("renderMarkdown(%q) = %q, contains %q", src, got, tag)
+			}
+		}
+	}
+}
+
+func TestRenderMarkdownLinks(t *testing.T) {
+	for _, tc := range []struct {
+		src  string
+		want string
+	}{
+		{"[site](https://example.com/a?b=1&c=2)", `<a href="https://example.com/a?b=1&amp;c=2">site</a>`},
+		{"[site](HTTPS://example.com)", `<a href="HTTPS://example.com">site</a>`},
+		{"[mail](mailto:team@example.com)", `<a href="mailto:team@example.com">mail</a>`},
+		{"[docs](docs/usage.md)", `<a href="docs/usage.md">docs</a>`},
+		{"[up](../README.md)", `<a href="../README.md">up</a>`},
+		{"[anchor](#usage)", `<a href="#usage">anchor</a>`},
+		{"[**bold** link](https://example.com)", `<a href="https://example.com"><strong>bold</strong> link</a>`},
+		{"[a](https://example.com/_x_) and _b_", `<a href="https://example.com/_x_">a</a> and <em>b</em>`},
+		{`[q](https://example.com/"onmouseover="alert(1))`, `<a href="https://example.com/&#34;onmouseover=&#34;alert(1">q</a>)`},
+	} {
+		got := string(renderMarkdown(tc.src))
+		if !strings.Contains(got, tc.want) {
+			t.Errorf("renderMarkdown(%q) = %q, want it to contain %q", tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestRenderMarkdownDropsUnsafeLinks(t *testing.T) {
+	for _, url := range []string{
+		"javascript:alert(1)",
+		"JavaScript:alert(1)",
+		"JAVASCRIPT:alert(1)",
+		"jAvAsCrIpT:alert(1)",
+		"data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==",
+		"DATA:text/html,<script>alert(1)</script>",
+		"vbscript:msgbox(1)",
+		"&#106;avascript:alert(1)",
+		"java&#x09;script:alert(1)",
+	} {
+		src := "[click](" + url + ")"
+		got := string(renderMarkdown(src))
+		if strings.Contains(got, "<a") || strings.Contains(strings.ToLower(got), "href") {
+			t.Errorf("renderMarkdown(%q) = %q, kept the link", src, got)
+		}
+		if !strings.Contains(got, "click") {
+			t.Errorf("renderMarkdown(%q) = %q, dropped the link text", src, got)
+		}
+	}
+}
+
+func TestRenderMarkdownBlocks(t *testing.T) {
+	src := "# Title\n\nSome *text* with `code`.\n\n- one\n- two\n\n1. first\n\n> quoted\n\n---\n"
+	want := "<h1>Title</h1>\n" +
+		"<p>Some <em>text</em> with <code>code</code>.</p>\n" +
+		"<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n" +
+		"<ol>\n<li>first</li>\n</ol>\n" +
+		"<blockquote>\n<p>quoted</p>\n</blockquote>\n" +
+		"<hr>\n"
+	if got := string(renderMarkdown(src)); got != want {
+		t.Errorf("renderMarkdown() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Metadata is the manifest metadata carried into catalog entries, so that
+// clients can show an entry's details and prompt for template variables
+// without fetching the entry itself. All fields are optional.
+type Metadata struct {
+	Author   string
+	License  string
+	Homepage string
+	// Tags merges the manifest's tags and keywords.
+	Tags []string
+	// Dependencies are toolchain requirements, e.g. go = ">=1.16".
+	Dependencies map[string]string
+	// Requires are other catalog entries this entry depends on, keyed by
+	// entry key with a version constraint, e.g. "plugins.scmtea" = "^1.0".
+	Requires map[string]string
+	// Variables are the template variables users are prompted for.
+	Variables map[string]Variable
+	// Commands are the template's declared commands, e.g. test = "sh test.sh".
+	Commands    map[string]string
+	EntryPoints []EntryPoint
+}
+
+// Variable is a template variable declared in [template.variables].
+type Variable struct {
+	Type        string
+	Description string
+	// Default is nil when the variable has no default.
+	Default interface{}
+}
+
+// EntryPoint is a plugin source file and the symbol gitspace loads from it.
+type EntryPoint struct {
+	Path   string
+	Symbol string
+}
+
+// keyValue is a single TOML key and its value.
+type keyValue struct {
+	Key   string
+	Value interface{}
+}
+
+// fields returns the metadata as TOML key/value pairs in the order they are
+// written to the catalog, leaving out empty fields.
+func (m Metadata) fields() []keyValue {
+	var kv []keyValue
+	for _, f := range []struct {
+		key   string
+		value string
+	}{
+		{"author", m.Author},
+		{"license", m.License},
+		{"homepage", m.Homepage},
+	} {
+		if f.value != "" {
+			kv = append(kv, keyValue{f.key, f.value})
+		}
+	}
+	if len(m.Tags) > 0 {
+		kv = append(kv, keyValue{"tags", m.Tags})
+	}
+	if len(m.Dependencies) > 0 {
+		kv = append(kv, keyValue{"dependencies", stringMapValue(m.Dependencies)})
+	}
+	if len(m.Requires) > 0 {
+		kv = append(kv, keyValue{"requires", stringMapValue(m.Requires)})
+	}
+	if len(m.Commands) > 0 {
+		kv = append(kv, keyValue{"commands", stringMapValue(m.Commands)})
+	}
+	if len(m.Variables) > 0 {
+		variables := make(map[string]interface{}, len(m.Variables))
+		for name, v := range m.Variables {
+			variable := map[string]interface{}{"type": v.Type}
+			if v.Description != "" {
+				variable["description"] = v.Description
+			}
+			if v.Default != nil {
+				variable["default"] = v.Default
+			}
+			variables[name] = variable
+		}
+		kv = append(kv, keyValue{"variables", variables})
+	}
+	if len(m.EntryPoints) > 0 {
+		entryPoints := make([]interface{}, 0, len(m.EntryPoints))
+		for _, ep := range m.EntryPoints {
+			entryPoints = append(entryPoints, map[string]interface{}{"path": ep.Path, "entry_point": ep.Symbol})
+		}
+		kv = append(kv, keyValue{"entry_points", entryPoints})
+	}
+	return kv
+}
+
+func stringMapValue(m map[string]string) map[string]interface{} {
+	result := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		result[k] = v
+	}
+	return result
+}
+
+// loadManifestMetadata reads the optional metadata of a plugin or template
+// manifest. section is the manifest's main section ([metadata], [plugin]
+// or [template]); [[sources]] may live in it or at the top level.
+func loadManifestMetadata(tomlPath string, tree, section *toml.Tree) (Metadata, error) {
+	var m Metadata
+	var err error
+
+	for _, f := range []struct {
+		key string
+		dst *string
+	}{
+		{"author", &m.Author},
+		{"license", &m.License},
+		{"homepage", &m.Homepage},
+	} {
+		if section.Has(f.key) {
+			if *f.dst, err = getString(tomlPath, f.key, section, f.key); err != nil {
+				return m, err
+			}
+		}
+	}
+
+	for _, key := range []string{"tags", "keywords"} {
+		values, err := stringArray(section, key)
+		if err != nil {
+			return m, fmt.Errorf("%s: %w", tomlPath, err)
+		}
+		m.Tags = appendUnique(m.Tags, values...)
+	}
+
+	if m.Dependencies, err = getStringMap(tomlPath, section, "dependencies"); err != nil {
+		return m, err
+	}
+	if m.Requires, err = getEntryKeyMap(tomlPath, section, "requires"); err != nil {
+		return m, err
+	}
+	if m.Commands, err = getStringMap(tomlPath, section, "commands"); err != nil {
+		return m, err
+	}
+	if m.Variables, err = getVariables(tomlPath, section, "variables"); err != nil {
+		return m, err
+	}
+
+	sources := section.GetPath([]string{"sources"})
+	if sources == nil {
+		sources = tree.GetPath([]string{"sources"})
+	}
+	if m.EntryPoints, err = getEntryPoints(tomlPath, "sources", sources); err != nil {
+		return m, err
+	}
+	return m, nil
+}
+
+// decodeMetadataField decodes key of a catalog entry table into m. It
+// reports whether key is a metadata field.
+func decodeMetadataField(file, fullKey string, section *toml.Tree, key string, m *Metadata) (bool, error) {
+	var err error
+	switch key {
+	case "author":
+		m.Author, err = getString(file, fullKey, section, key)
+	case "license":
+		m.License, err = getString(file, fullKey, section, key)
+	case "homepage":
+		m.Homepage, err = getString(file, fullKey, section, key)
+	case "tags":
+		m.Tags, err = stringArray(section, key)
+		if err != nil {
+			err = &CatalogError{File: file, Key: fullKey + "." + key, Pos: section.GetPositionPath([]string{key}), Err: err}
+		}
+	case "dependencies":
+		m.Dependencies, err = getStringMap(file, section, key)
+	case "requires":
+		m.Requires, err = getEntryKeyMap(file, section, key)
+	case "commands":
+		m.Commands, err = getStringMap(file, section, key)
+	case "variables":
+		m.Variables, err = getVariables(file, section, key)
+	case "entry_points":
+		m.EntryPoints, err = getEntryPoints(file, fullKey+"."+key, section.GetPath([]string{key}))
+	default:
+		return false, nil
+	}
+	return true, err
+}
+
+func getStringMap(file string, tree *toml.Tree, key string) (map[string]string, error) {
+	value := tree.GetPath([]string{key})
+	if value == nil {
+		return nil, nil
+	}
+	table, ok := value.(*toml.Tree)
+	if !ok {
+		return nil, &CatalogError{File: file, Key: key, Pos: tree.GetPositionPath([]string{key}), Err: fmt.Errorf("expected a table, got %T", value)}
+	}
+	result := make(map[string]string)
+	for _, k := range table.Keys() {
+		if result[k], ok = table.GetPath([]string{k}).(string); !ok {
+			return nil, &CatalogError{File: file, Key: key + "." + k, Pos: table.GetPositionPath([]string{k}), Err: fmt.Errorf("expected a string")}
+		}
+	}
+	return result, nil
+}
+
+func getVariables(file string, tree *toml.Tree, key string) (map[string]Variable, error) {
+	value := tree.GetPath([]string{key})
+	if value == nil {
+		return nil, nil
+	}
+	table, ok := value.(*toml.Tree)
+	if !ok {
+		return nil, &CatalogError{File: file, Key: key, Pos: tree.GetPositionPath([]string{key}), Err: fmt.Errorf("expected a table, got %T", value)}
+	}
+	result := make(map[string]Variable)
+	for _, name := range table.Keys() {
+		fullKey := key + "." + name
+		section, ok := table.GetPath([]string{name}).(*toml.Tree)
+		if !ok {
+			return nil, &CatalogError{File: file, Key: fullKey, Pos: table.Position(), Err: fmt.Errorf("expected a table")}
+		}
+		var v Variable
+		var err error
+		if v.Type, err = getString(file, fullKey, section, "type"); err != nil {
+			return nil, err
+		}
+		if section.Has("description") {
+			if v.Description, err = getString(file, fullKey, section, "description"); err != nil {
+				return nil, err
+			}
+		}
+		v.Default = toGoValue(section.GetPath([]string{"default"}))
+		result[name] = v
+	}
+	return result, nil
+}
+
+// getEntryPoints decodes [[sources]] from a manifest or entry_points from
+// the catalog. Both are arrays of tables with path and entry_point.
+func getEntryPoints(file, key string, value interface{}) ([]EntryPoint, error) {
+	tables, err := tableArray(file, key, value)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []EntryPoint
+	for i, table := range tables {
+		var ep EntryPoint
+		var err error
+		itemKey := fmt.Sprintf("%s[%d]", key, i)
+		if ep.Path, err = getString(file, itemKey, table, "path"); err != nil {
+			return nil, err
+		}
+		if ep.Symbol, err = getString(file, itemKey, table, "entry_point"); err != nil {
+			return nil, err
+		}
+		result = append(result, ep)
+	}
+	return result, nil
+}
+
+// tableArray returns the tables of an array of tables, written either as
+// [[key]] sections or as an inline array. It returns nil for a nil value.
+func tableArray(file, key string, value interface{}) ([]*toml.Tree, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []*toml.Tree:
+		return v, nil
+	case []interface{}:
+		var tables []*toml.Tree
+		for _, item := range v {
+			table, ok := item.(*toml.Tree)
+			if !ok {
+				return nil, &CatalogError{File: file, Key: key, Err: fmt.Errorf("expected an array of tables")}
+			}
+			tables = append(tables, table)
+		}
+		return tables, nil
+	default:
+		return nil, &CatalogError{File: file, Key: key, Err: fmt.Errorf("expected an array of tables, got %T", value)}
+	}
+}
+
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		found := false
+		for _, existing := range list {
+			if existing == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestManifestMetadataIsCarriedIntoEntry(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		kind     string
+		manifest string
+		content  string
+		want     Metadata
+	}{
+		{
+			name:     "plugin metadata section",
+			kind:     "plugins",
+			manifest: pluginManifestName,
+			content: `[metadata]
+name = "scmtea"
+version = "1.0.0"
+description = "Gitea integration"
+author = "ssotops"
+license = "MIT"
+homepage = "https://example.com/scmtea"
+tags = ["git", "gitea"]
+keywords = ["gitea", "scm"]
+
+[metadata.dependencies]
+go = ">=1.21"
+
+[[sources]]
+path = "main.go"
+entry_point = "Plugin"
+
+[[sources]]
+path = "hooks.go"
+entry_point = "Hooks"
+`,
+			want: Metadata{
+				Author:       "ssotops",
+				License:      "MIT",
+				Homepage:     "https://example.com/scmtea",
+				Tags:         []string{"git", "gitea", "scm"},
+				Dependencies: map[string]string{"go": ">=1.21"},
+				EntryPoints:  []EntryPoint{{Path: "main.go", Symbol: "Plugin"}, {Path: "hooks.go", Symbol: "Hooks"}},
+			},
+		},
+		{
+			name:     "plugin section with nested sources",
+			kind:     "plugins",
+			manifest: pluginManifestName,
+			content: `[plugin]
+name = "scmtea"
+version = "1.0.0"
+description = "Gitea integration"
+author = "ssotops"
+
+[[plugin.sources]]
+path = "plugin.go"
+entry_point = "Plugin"
+`,
+			want: Metadata{
+				Author:      "ssotops",
+				EntryPoints: []EntryPoint{{Path: "plugin.go", Symbol: "Plugin"}},
+			},
+		},
+		{
+			name:     "template",
+			kind:     "templates",
+			manifest: templateManifestName,
+			content: `[template]
+name = "starter"
+version = "0.1.0"
+description = "Starter template"
+author = "Gitspace Team"
+license = "MIT"
+tags = ["starter"]
+
+[template.dependencies]
+go = ">=1.16"
+
+[template.variables]
+name = { type = "string", description = "Name of the project" }
+replicas = { type = "integer", default = 3 }
+private = { type = "boolean", default = false, description = "Keep the repository private" }
+
+[template.commands]
+build = "sh build.sh"
+test = "sh test.sh"
+`,
+			want: Metadata{
+				Author:       "Gitspace Team",
+				License:      "MIT",
+				Tags:         []string{"starter"},
+				Dependencies: map[string]string{"go": ">=1.16"},
+				Variables: map[string]Variable{
+					"name":     {Type: "string", Description: "Name of the project"},
+					"replicas": {Type: "integer", Default: int64(3)},
+					"private":  {Type: "boolean", Description: "Keep the repository private", Default: false},
+				},
+				Commands: map[string]string{"build": "sh build.sh", "test": "sh test.sh"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTestFiles(t, dir, map[string]string{tc.manifest: tc.content})
+
+			catalog := newCatalog()
+			var entry *Entry
+			if tc.kind == "plugins" {
+				plugin, err := loadPluginInfo(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				catalog.Plugins["entry"] = plugin
+				entry = &plugin.Entry
+			} else {
+				template, err := loadTemplateInfo(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				catalog.Templates["entry"] = template
+				entry = &template.Entry
+			}
+			if !reflect.DeepEqual(entry.Metadata, tc.want) {
+				t.Errorf("metadata = %+v, want %+v", entry.Metadata, tc.want)
+			}
+
+			// The catalog keeps every field of the manifest.
+			reparsed, _ := roundTrip(t, tc.name, []byte(formatTomlTree(catalog)))
+			var got Metadata
+			if tc.kind == "plugins" {
+				got = reparsed.Plugins["entry"].Metadata
+			} else {
+				got = reparsed.Templates["entry"].Metadata
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("metadata in the catalog = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPluginStarterTemplateMetadata(t *testing.T) {
+	template, err := loadTemplateInfo("../../templates/gitspace-plugin-starter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Metadata{
+		Author:       "Gitspace Team",
+		License:      "MIT",
+		Dependencies: map[string]string{"go": ">=1.16"},
+		Variables: map[string]Variable{
+			"plugin_name":        {Type: "string", Description: "Name of the plugin"},
+			"plugin_description": {Type: "string", Description: "Short description of the plugin"},
+			"author_name":        {Type: "string", Description: "Name of the plugin author"},
+		},
+		Commands: map[string]string{"build": "sh build.sh", "test": "sh test.sh"},
+	}
+	// The [[plugin.sources]] of its gitspace-plugin.toml belong to the
+	// plugin it scaffolds, not to the template.
+	if !reflect.DeepEqual(template.Metadata, want) {
+		t.Errorf("metadata = %+v, want %+v", template.Metadata, want)
+	}
+}
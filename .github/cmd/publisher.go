@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+)
+
+// Publishers, chosen with -publisher or CATALOG_PUBLISHER.
+const (
+	publisherGitHub = "github"
+	publisherGit    = "git"
+	publisherGitea  = "gitea"
+
+	publisherEnv = "CATALOG_PUBLISHER"
+)
+
+// Publisher commits the catalog and the files generated with it to a
+// repository.
+type Publisher interface {
+	// Name is the name the publisher is chosen by.
+	Name() string
+	// Publish commits the catalog at catalogPath and the generated files
+	// next to it on top of branch, moves branch to the new commit, and
+	// returns the commit SHA. base is the commit the catalog was updated
+	// on; if branch does not point to it, or moved while publishing, so
+	// that the commit would not fast-forward it, the error wraps
+	// errNonFastForward. An empty base commits on top of whatever branch
+	// points to. A publisher that cannot guard the branch update, such as
+	// Gitea's, documents what it does instead.
+	Publish(ctx context.Context, branch, base, repoRoot, catalogPath string) (string, error)
+}
+
+// errNonFastForward is wrapped by the errors of Publish when the branch
+// moved while publishing, e.g. because of a concurrent push.
+var errNonFastForward = errors.New("branch moved, the commit does not fast-forward it")
+
+// checkBase returns an error wrapping errNonFastForward if branch, which
+// points to head, moved away from base.
+func checkBase(branch, base, head string) error {
+	if base != "" && head != base {
+		return fmt.Errorf("%s is at %s, not at %s the catalog was updated on: %w", branch, head, base, errNonFastForward)
+	}
+	return nil
+}
+
+// pullRequestPublisher is a Publisher that can propose the commit as a
+// pull request instead of moving the branch.
+type pullRequestPublisher interface {
+	Publisher
+	// PublishPullRequest commits on top of base, points head at the commit
+	// and opens or refreshes a pull request from head into base.
+	PublishPullRequest(ctx context.Context, base, head, repoRoot, catalogPath string) (*pullRequestResult, error)
+}
+
+// newPublisher returns the publisher chosen in p.
+func newPublisher(ctx context.Context, opts *cliOptions, p *publishOptions) (Publisher, error) {
+	switch p.Publisher {
+	case publisherGitHub:
+		owner, name, err := splitRepository(p.Repository)
+		if err != nil {
+			return nil, err
+		}
+		client, err := newGitHubClient(ctx, opts.progress, p.GitHubAPIURL, defaultCredentialProviders(opts.RepoRoot))
+		if err != nil {
+			return nil, err
+		}
+		return newGitHubPublisher(opts.progress, client, owner, name), nil
+	case publisherGit:
+		return newGitPublisher(opts.progress, opts.RepoRoot, p.Remote), nil
+	case publisherGitea:
+		if p.GiteaURL == "" {
+			return nil, fmt.Errorf("no Gitea instance given: use -gitea-url or set GITEA_URL")
+		}
+		owner, name, err := splitRepository(p.Repository)
+		if err != nil {
+			return nil, err
+		}
+		return newGiteaPublisher(opts.progress, p.GiteaURL, os.Getenv(giteaTokenEnv), owner, name), nil
+	}
+	return nil, fmt.Errorf("unknown publisher %q (expected %s, %s or %s)", p.Publisher, publisherGitHub, publisherGit, publisherGitea)
+}
+
+// githubPublisher publishes through the GitHub API.
+type githubPublisher struct {
+	client   *github.Client
+	owner    string
+	name     string
+	progress io.Writer
+}
+
+func newGitHubPublisher(w io.Writer, client *github.Client, owner, name string) *githubPublisher {
+	return &githubPublisher{client: client, owner: owner, name: name, progress: w}
+}
+
+func (g *githubPublisher) Name() string {
+	return publisherGitHub
+}
+
+func (g *githubPublisher) Publish(ctx context.Context, branch, base, repoRoot, catalogPath string) (string, error) {
+	return commitAndPush(ctx, g.progress, g.client, g.owner, g.name, branch, base, repoRoot, catalogPath)
+}
+
+func (g *githubPublisher) PublishPullRequest(ctx context.Context, base, head, repoRoot, catalogPath string) (*pullRequestResult, error) {
+	return publishPullRequest(ctx, g.progress, g.client, g.owner, g.name, base, head, repoRoot, catalogPath)
+}
+
+// publishRetry publishes with bounded retries: when the branch moves while
+// publishing, the new state of the branch is fetched and checked out, the
+// update is run again on the checkout, and the result is published again.
+type publishRetry struct {
+	// Attempts is the number of times publishing is tried.
+	Attempts int
+	// Delay is the wait before the first retry. It doubles with every
+	// retry, up to MaxDelay.
+	Delay    time.Duration
+	MaxDelay time.Duration
+	// Remote is the git remote the new state of the branch is fetched
+	// from.
+	Remote string
+	// Update runs the catalog update again, on the catalog at
+	// catalogPath in a checkout of the new state of the branch at
+	// repoRoot.
+	Update func(repoRoot, catalogPath string) (*catalogUpdate, error)
+}
+
+// newPublishRetry returns the retry policy of the publish commands, which
+// fetch from remote and rerun updateCatalog.
+func newPublishRetry(w io.Writer, remote string) *publishRetry {
+	return &publishRetry{
+		Attempts: 5,
+		Delay:    2 * time.Second,
+		MaxDelay: 30 * time.Second,
+		Remote:   remote,
+		Update: func(repoRoot, catalogPath string) (*catalogUpdate, error) {
+			return updateCatalog(w, repoRoot, catalogPath)
+		},
+	}
+}
+
+// publish publishes the catalog at catalogPath to branch with publisher,
+// retrying as long as the branch moves underneath it. The first attempt
+// publishes the catalog as updated on the HEAD of repoRoot; a retry
+// updates it on a temporary checkout of the new state of the branch,
+// whose catalog files are copied back to repoRoot once published. It
+// returns "" if, after a retry, the catalog on the branch is already up
+// to date.
+func (r *publishRetry) publish(ctx context.Context, w io.Writer, publisher Publisher, branch, repoRoot, catalogPath string) (string, error) {
+	catalogRel, err := filepath.Rel(repoRoot, catalogPath)
+	if err != nil {
+		return "", err
+	}
+	base, err := gitRevParse(repoRoot, "HEAD^{commit}")
+	if err != nil {
+		return "", err
+	}
+
+	// checkout is the repository the catalog is updated in, repoRoot
+	// until the first retry.
+	checkout, catalog := repoRoot, catalogPath
+	defer func() {
+		if checkout != repoRoot {
+			os.RemoveAll(checkout)
+		}
+	}()
+	// done copies the catalog files of checkout back to repoRoot.
+	done := func(sha string) (string, error) {
+		if checkout != repoRoot {
+			if err := syncCatalogFiles(filepath.Dir(catalog), filepath.Dir(catalogPath), filepath.Base(catalogPath)); err != nil {
+				return "", fmt.Errorf("error copying the catalog files of %s: %w", base, err)
+			}
+		}
+		return sha, nil
+	}
+
+	delay := r.Delay
+	for attempt := 1; ; attempt++ {
+		sha, err := publisher.Publish(ctx, branch, base, checkout, catalog)
+		if err == nil {
+			return done(sha)
+		}
+		if !errors.Is(err, errNonFastForward) {
+			return "", err
+		}
+		if attempt >= r.Attempts {
+			return "", fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		fmt.Fprintf(w, "Attempt %d of %d failed: %v\n", attempt, r.Attempts, err)
+		fmt.Fprintf(w, "Retrying on the new state of %s in %s\n", branch, delay)
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, r.MaxDelay)
+
+		fmt.Fprintf(w, "Fetching %s from %s\n", branch, r.Remote)
+		if base, err = gitFetch(ctx, repoRoot, r.Remote, branch); err != nil {
+			return "", fmt.Errorf("error fetching %s for retry %d: %w", branch, attempt, err)
+		}
+		if checkout != repoRoot {
+			os.RemoveAll(checkout)
+		}
+		if checkout, err = gitCheckout(ctx, repoRoot, base); err != nil {
+			checkout = repoRoot
+			return "", fmt.Errorf("error checking out %s for retry %d: %w", base, attempt, err)
+		}
+		catalog = filepath.Join(checkout, catalogRel)
+		fmt.Fprintf(w, "Checked out %s at %s in %s\n", branch, base, checkout)
+
+		update, err := r.Update(checkout, catalog)
+		if err != nil {
+			return "", fmt.Errorf("error updating catalog for retry %d: %w", attempt, err)
+		}
+		if !update.Changed() {
+			fmt.Fprintf(w, "Catalog on %s is already up to date, nothing to publish\n", branch)
+			return done("")
+		}
+		fmt.Fprintf(w, "Catalog updated on the new state of %s, publishing attempt %d of %d\n", branch, attempt+1, r.Attempts)
+	}
+}
+
+// syncCatalogFiles copies the catalog named catalogName and the files
+// generated with it from srcDir to dstDir. Optional generated files
+// missing from srcDir are removed from dstDir.
+func syncCatalogFiles(srcDir, dstDir, catalogName string) error {
+	for _, file := range append(append([]string{catalogName}, generatedFiles...), optionalGeneratedFiles...) {
+		dst := filepath.Join(dstDir, file)
+		err := copyFile(filepath.Join(srcDir, file), dst)
+		if os.IsNotExist(err) {
+			if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error copying %s: %w", file, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testEntriesCatalog is the catalog of the repositories of
+// newTestEntriesRemote before its first update.
+const testEntriesCatalog = `[catalog]
+name = "Test Catalog"
+description = "Catalog used by the publishing tests"
+version = "1.0.0"
+`
+
+// newTestEntriesRemote returns a clone of a new bare repository whose
+// master holds the scmtea plugin and the catalog updated from it, and the
+// bare repository.
+func newTestEntriesRemote(t *testing.T) (string, string) {
+	t.Helper()
+	remote := t.TempDir()
+	gitTest(t, remote, "init", "--quiet", "--bare", "--initial-branch=master")
+	repoRoot := newTestClone(t, remote)
+	writeTestFiles(t, repoRoot, map[string]string{"gitspace-catalog.toml": testEntriesCatalog})
+	pushTestPlugin(t, repoRoot, "scmtea", "1.0.0")
+	commitTestUpdate(t, repoRoot)
+	gitTest(t, repoRoot, "push", "--quiet", "origin", "master")
+	return repoRoot, remote
+}
+
+// newTestClone returns a new clone of remote with a committer configured.
+func newTestClone(t *testing.T, remote string) string {
+	t.Helper()
+	dir := t.TempDir()
+	gitTest(t, dir, "clone", "--quiet", remote, ".")
+	gitTest(t, dir, "config", "user.name", "Test")
+	gitTest(t, dir, "config", "user.email", "test@example.com")
+	return dir
+}
+
+// commitTestUpdate updates the catalog of repoRoot and commits it.
+func commitTestUpdate(t *testing.T, repoRoot string) {
+	t.Helper()
+	if _, err := updateCatalog(io.Discard, repoRoot, filepath.Join(repoRoot, "gitspace-catalog.toml")); err != nil {
+		t.Fatal(err)
+	}
+	gitTest(t, repoRoot, "add", ".")
+	gitTest(t, repoRoot, "commit", "--quiet", "-m", commitMessage)
+}
+
+// pushTestPlugin commits the plugin name at version in repoRoot and
+// pushes it to master without updating the catalog.
+func pushTestPlugin(t *testing.T, repoRoot, name, version string) {
+	t.Helper()
+	writeTestFiles(t, repoRoot, map[string]string{
+		"plugins/" + name + "/main.go": "package main\n",
+		"plugins/" + name + "/" + pluginManifestName: fmt.Sprintf(`[metadata]
+name = %q
+version = %q
+description = "Test plugin"
+
+[[sources]]
+path = "main.go"
+entry_point = "Plugin"
+`, name, version),
+	})
+	gitTest(t, repoRoot, "add", ".")
+	gitTest(t, repoRoot, "commit", "--quiet", "-m", "Update "+name)
+	gitTest(t, repoRoot, "push", "--quiet", "origin", "master")
+}
+
+// testRetry returns the retry policy of the publish commands without
+// delays, and the number of updates it ran, which it checks are run
+// outside repoRoot.
+func testRetry(t *testing.T, repoRoot string) (*publishRetry, *int) {
+	retry := newPublishRetry(io.Discard, "origin")
+	retry.Attempts = 3
+	retry.Delay, retry.MaxDelay = time.Millisecond, time.Millisecond
+	update := retry.Update
+	updates := 0
+	retry.Update = func(checkout, catalogPath string) (*catalogUpdate, error) {
+		updates++
+		if checkout == repoRoot {
+			t.Error("the retry updated the stale checkout")
+		}
+		return update(checkout, catalogPath)
+	}
+	return retry, &updates
+}
+
+// catalogEntryVersion returns the version of the plugin name in the
+// catalog at path, or "" if it has no such plugin.
+func catalogEntryVersion(t *testing.T, path, name string) string {
+	t.Helper()
+	catalog, err := readCatalog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plugin := catalog.Plugins[name]; plugin != nil {
+		return plugin.Version
+	}
+	return ""
+}
+
+// failingPublisher is a Publisher that fails with err.
+type failingPublisher struct {
+	err   error
+	calls int
+}
+
+func (p *failingPublisher) Name() string {
+	return "failing"
+}
+
+func (p *failingPublisher) Publish(ctx context.Context, branch, base, repoRoot, catalogPath string) (string, error) {
+	p.calls++
+	return "", p.err
+}
+
+func TestPublishRetryUpdatesNewBranchState(t *testing.T) {
+	repoRoot, remote := newTestEntriesRemote(t)
+	pushTestPlugin(t, repoRoot, "scmtea", "1.1.0")
+	catalogPath := filepath.Join(repoRoot, "gitspace-catalog.toml")
+	if _, err := updateCatalog(io.Discard, repoRoot, catalogPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// A concurrent push adds a plugin after the checkout was updated.
+	other := newTestClone(t, remote)
+	pushTestPlugin(t, other, "gitea", "0.1.0")
+	concurrent := gitTest(t, other, "rev-parse", "HEAD")
+
+	retry, updates := testRetry(t, repoRoot)
+	sha, err := retry.publish(context.Background(), io.Discard, newGitPublisher(io.Discard, repoRoot, "origin"), "master", repoRoot, catalogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *updates != 1 {
+		t.Errorf("update ran %d times, want 1", *updates)
+	}
+	if got := gitTest(t, remote, "rev-parse", "master"); got != sha {
+		t.Errorf("remote master = %s, want %s", got, sha)
+	}
+	if got := gitTest(t, remote, "rev-parse", sha+"^"); got != concurrent {
+		t.Errorf("parent = %s, want the concurrent push %s", got, concurrent)
+	}
+
+	// The published catalog has the entries of both pushes, and records
+	// the commit it was updated on.
+	published := filepath.Join(t.TempDir(), "gitspace-catalog.toml")
+	writeTestFiles(t, filepath.Dir(published), map[string]string{
+		"gitspace-catalog.toml": gitTest(t, remote, "show", "master:gitspace-catalog.toml") + "\n",
+	})
+	if v := catalogEntryVersion(t, published, "scmtea"); v != "1.1.0" {
+		t.Errorf("published scmtea version = %q, want 1.1.0", v)
+	}
+	if v := catalogEntryVersion(t, published, "gitea"); v != "0.1.0" {
+		t.Errorf("published gitea version = %q, want 0.1.0", v)
+	}
+	catalog, err := readCatalog(published)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lu := catalog.Info.LastUpdated; lu == nil || lu.CommitHash != concurrent {
+		t.Errorf("last_updated = %+v, want commit %s", lu, concurrent)
+	}
+	if got := catalog.Plugins["gitea"].CommitHash; got != concurrent {
+		t.Errorf("gitea commit_hash = %s, want %s", got, concurrent)
+	}
+
+	// The published catalog files are copied back to the checkout.
+	for _, file := range append([]string{"gitspace-catalog.toml"}, generatedFiles...) {
+		if got, want := gitTest(t, repoRoot, "hash-object", file), gitTest(t, remote, "rev-parse", "master:"+file); got != want {
+			t.Errorf("%s in the checkout is not the published one", file)
+		}
+	}
+}
+
+func TestPublishRetryStopsWhenUpToDate(t *testing.T) {
+	repoRoot, remote := newTestEntriesRemote(t)
+	pushTestPlugin(t, repoRoot, "scmtea", "1.1.0")
+	catalogPath := filepath.Join(repoRoot, "gitspace-catalog.toml")
+	if _, err := updateCatalog(io.Discard, repoRoot, catalogPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// A concurrent run publishes the same update first.
+	other := newTestClone(t, remote)
+	commitTestUpdate(t, other)
+	gitTest(t, other, "push", "--quiet", "origin", "master")
+	concurrent := gitTest(t, other, "rev-parse", "HEAD")
+
+	retry, updates := testRetry(t, repoRoot)
+	sha, err := retry.publish(context.Background(), io.Discard, newGitPublisher(io.Discard, repoRoot, "origin"), "master", repoRoot, catalogPath)
+	if err != nil || sha != "" {
+		t.Errorf("publish = %q, %v, want nothing published", sha, err)
+	}
+	if *updates != 1 {
+		t.Errorf("update ran %d times, want 1", *updates)
+	}
+	if got := gitTest(t, remote, "rev-parse", "master"); got != concurrent {
+		t.Errorf("master moved to %s", got)
+	}
+	for _, file := range append([]string{"gitspace-catalog.toml"}, generatedFiles...) {
+		if got, want := gitTest(t, repoRoot, "hash-object", file), gitTest(t, remote, "rev-parse", "master:"+file); got != want {
+			t.Errorf("%s in the checkout is not the one on master", file)
+		}
+	}
+}
+
+func TestPublishRetryGivesUp(t *testing.T) {
+	repoRoot, _ := newTestEntriesRemote(t)
+	pushTestPlugin(t, repoRoot, "scmtea", "1.1.0")
+	catalogPath := filepath.Join(repoRoot, "gitspace-catalog.toml")
+	publisher := &failingPublisher{err: errNonFastForward}
+	retry, updates := testRetry(t, repoRoot)
+
+	_, err := retry.publish(context.Background(), io.Discard, publisher, "master", repoRoot, catalogPath)
+	if !errors.Is(err, errNonFastForward) {
+		t.Fatalf("err = %v, want errNonFastForward", err)
+	}
+	if publisher.calls != retry.Attempts {
+		t.Errorf("published %d times, want %d", publisher.calls, retry.Attempts)
+	}
+	if *updates != retry.Attempts-1 {
+		t.Errorf("update ran %d times, want %d", *updates, retry.Attempts-1)
+	}
+}
+
+func TestPublishRetryReturnsOtherErrors(t *testing.T) {
+	repoRoot, _ := newTestEntriesRemote(t)
+	catalogPath := filepath.Join(repoRoot, "gitspace-catalog.toml")
+	retry, updates := testRetry(t, repoRoot)
+
+	_, err := retry.publish(context.Background(), io.Discard, newGitPublisher(io.Discard, repoRoot, "origin"), "main", repoRoot, catalogPath)
+	if err == nil || errors.Is(err, errNonFastForward) {
+		t.Errorf("err = %v, want a missing branch error", err)
+	}
+	if *updates != 0 {
+		t.Errorf("update ran %d times, want 0", *updates)
+	}
+}
+
+func TestPublishCatalogRefusesUnverifiedVersions(t *testing.T) {
+	repoRoot, remote := newTestRemote(t)
+	pushTestPlugin(t, repoRoot, "lint", "1.0.0")
+	head := gitTest(t, remote, "rev-parse", "master")
+	catalogPath := filepath.Join(repoRoot, "gitspace-catalog.toml")
+	if _, err := updateCatalog(io.Discard, repoRoot, catalogPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// The update ran outside the pipeline, so lint has no verification.
+	opts := &cliOptions{RepoRoot: repoRoot, CatalogPath: catalogPath, Branch: "master", stdout: io.Discard, progress: io.Discard}
+	p := &publishOptions{Publisher: publisherGit, Remote: "origin", Mode: publishModePush}
+	retry, _ := testRetry(t, repoRoot)
+	_, err := publishCatalog(context.Background(), opts, p, retry)
+	if err == nil || !strings.Contains(err.Error(), "plugins.lint 1.0.0: not verified") {
+		t.Fatalf("err = %v, want plugins.lint refused", err)
+	}
+	if got := gitTest(t, remote, "rev-parse", "master"); got != head {
+		t.Errorf("master moved to %s although publishing was refused", got)
+	}
+}
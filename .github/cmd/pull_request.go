@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-github/v45/github"
+)
+
+// Publish modes: push moves the base branch to the catalog commit, while
+// pull-request commits to a bot branch and opens a pull request into the
+// base branch for review.
+const (
+	publishModePush        = "push"
+	publishModePullRequest = "pull-request"
+
+	// defaultPullRequestBranch is the bot branch catalog updates are
+	// proposed from.
+	defaultPullRequestBranch = "gitspace-catalog/update"
+)
+
+// pullRequestResult is the outcome of publishing a pull request.
+type pullRequestResult struct {
+	Number int    `json:"number"`
+	URL    string `json:"url"`
+	// Created is false when an open pull request was refreshed.
+	Created bool   `json:"created"`
+	Commit  string `json:"commit"`
+}
+
+// publishPullRequest commits the catalog at catalogPath and the generated
+// files next to it on top of base, points head at the commit, and opens a
+// pull request from head into base, or refreshes the one that is already
+// open. head is owned by the updater: it is rebuilt from base every time,
+// so changes pushed to it by hand are overwritten.
+func publishPullRequest(ctx context.Context, w io.Writer, client *github.Client, repoOwner, repoName, base, head, repoRoot, catalogPath string) (*pullRequestResult, error) {
+	fmt.Fprintf(w, "Proposing catalog update to %s/%s from %s into %s\n", repoOwner, repoName, head, base)
+	baseRef, err := getBranchRef(ctx, w, client, repoOwner, repoName, base)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := generatedTreeEntries(w, repoRoot, catalogPath, filepath.Dir(catalogPath))
+	if err != nil {
+		return nil, err
+	}
+	commit, err := createCatalogCommit(ctx, client, repoOwner, repoName, baseRef.GetObject().GetSHA(), entries)
+	if err != nil {
+		return nil, err
+	}
+	if err := setBranch(ctx, w, client, repoOwner, repoName, head, commit.GetSHA()); err != nil {
+		return nil, err
+	}
+
+	title, body, err := pullRequestDescription(ctx, w, client, repoOwner, repoName, base, repoRoot, catalogPath)
+	if err != nil {
+		return nil, err
+	}
+	result := &pullRequestResult{Commit: commit.GetSHA()}
+
+	open, _, err := client.PullRequests.List(ctx, repoOwner, repoName, &github.PullRequestListOptions{
+		State: "open",
+		Head:  repoOwner + ":" + head,
+		Base:  base,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing pull requests: %w", err)
+	}
+	var pr *github.PullRequest
+	if len(open) > 0 {
+		pr, _, err = client.PullRequests.Edit(ctx, repoOwner, repoName, open[0].GetNumber(), &github.PullRequest{
+			Title: github.String(title),
+			Body:  github.String(body),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error updating pull request #%d: %w", open[0].GetNumber(), err)
+		}
+		fmt.Fprintf(w, "Updated pull request #%d: %s\n", pr.GetNumber(), pr.GetHTMLURL())
+	} else {
+		pr, _, err = client.PullRequests.Create(ctx, repoOwner, repoName, &github.NewPullRequest{
+			Title: github.String(title),
+			Head:  github.String(head),
+			Base:  github.String(base),
+			Body:  github.String(body),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error creating pull request: %w", err)
+		}
+		result.Created = true
+		fmt.Fprintf(w, "Opened pull request #%d: %s\n", pr.GetNumber(), pr.GetHTMLURL())
+	}
+	result.Number = pr.GetNumber()
+	result.URL = pr.GetHTMLURL()
+	return result, nil
+}
+
+// setBranch points branch at sha, creating the branch if it does not
+// exist yet.
+func setBranch(ctx context.Context, w io.Writer, client *github.Client, repoOwner, repoName, branch, sha string) error {
+	ref := &github.Reference{
+		Ref:    github.String("refs/heads/" + branch),
+		Object: &github.GitObject{SHA: github.String(sha)},
+	}
+	_, _, err := client.Git.GetRef(ctx, repoOwner, repoName, "heads/"+branch)
+	if isNotFound(err) {
+		fmt.Fprintf(w, "Creating branch %s at %s\n", branch, sha)
+		if _, _, err := client.Git.CreateRef(ctx, repoOwner, repoName, ref); err != nil {
+			return fmt.Errorf("error creating branch %s: %w", branch, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error getting ref: %w", err)
+	}
+	fmt.Fprintf(w, "Resetting branch %s to %s\n", branch, sha)
+	if _, _, err := client.Git.UpdateRef(ctx, repoOwner, repoName, ref, true); err != nil {
+		return fmt.Errorf("error updating branch %s: %w", branch, err)
+	}
+	return nil
+}
+
+func isNotFound(err error) bool {
+	errResp, ok := err.(*github.ErrorResponse)
+	return ok && errResp.Response != nil && errResp.Response.StatusCode == http.StatusNotFound
+}
+
+// pullRequestDescription returns the title and body of the pull request
+// for the catalog at catalogPath. The body describes the entry changes
+// against the catalog on base, in the format of the changelog.
+func pullRequestDescription(ctx context.Context, w io.Writer, client *github.Client, repoOwner, repoName, base, repoRoot, catalogPath string) (string, string, error) {
+	catalog, err := readCatalog(catalogPath)
+	if err != nil {
+		return "", "", fmt.Errorf("error reading catalog: %w", err)
+	}
+	treePath, err := catalogTreePath(repoRoot, catalogPath)
+	if err != nil {
+		return "", "", err
+	}
+
+	previous := newCatalog()
+	content, found, err := readGitHubFile(ctx, client, repoOwner, repoName, base, treePath)
+	if err != nil {
+		return "", "", err
+	}
+	if !found {
+		fmt.Fprintf(w, "%s does not exist on %s yet\n", treePath, base)
+	} else if previous, err = parseCatalog(treePath, content); err != nil {
+		return "", "", fmt.Errorf("error parsing %s on %s: %w", treePath, base, err)
+	}
+
+	diff := diffCatalogs(previous, catalog)
+	record := newHistoryRecord(previous.Info.Version, catalog, diff)
+	title := fmt.Sprintf("Update catalog to %s", catalog.Info.Version)
+	return title, renderPullRequestBody(base, record, diff), nil
+}
+
+// renderPullRequestBody describes a catalog update for review.
+func renderPullRequestBody(base string, record HistoryRecord, diff CatalogDiff) string {
+	var sb strings.Builder
+	if record.PreviousVersion != "" && record.PreviousVersion != record.Version {
+		sb.WriteString(fmt.Sprintf("Updates the catalog from %s to %s.\n\n", record.PreviousVersion, record.Version))
+	}
+	if diff.Empty() {
+		sb.WriteString(fmt.Sprintf("No catalog entries differ from `%s`; only generated files changed.\n", base))
+	} else {
+		sb.WriteString(renderChangelogEntry(record, diff))
+		sb.WriteString("\n<details>\n<summary>Field changes</summary>\n\n```\n")
+		sb.WriteString(diff.String())
+		sb.WriteString("```\n\n</details>\n")
+	}
+	sb.WriteString("\n---\nThis pull request is updated automatically whenever the catalog changes. Changes pushed to its branch are overwritten.\n")
+	return sb.String()
+}
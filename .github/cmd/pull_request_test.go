@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-github/v45/github"
+)
+
+const testCatalog = `[catalog]
+name = "Test Catalog"
+description = "Catalog used by the publishing tests"
+version = "2024.10.2"
+version_policy = "calver"
+
+[plugins]
+[plugins.scmtea]
+version = "1.1.0"
+description = "Gitea local container management"
+path = "plugins/scmtea"
+
+[templates]
+`
+
+const testBaseCatalog = `[catalog]
+name = "Test Catalog"
+description = "Catalog used by the publishing tests"
+version = "2024.10.1"
+version_policy = "calver"
+
+[plugins]
+[plugins.scmtea]
+version = "1.0.0"
+description = "Gitea local container management"
+path = "plugins/scmtea"
+
+[templates]
+`
+
+// fakeGitHub is an in-memory stand-in for the parts of the GitHub API the
+// publisher uses: refs, trees, commits, contents and pull requests.
+type fakeGitHub struct {
+	mu sync.Mutex
+	// refs maps branch names to commit SHAs.
+	refs map[string]string
+	// trees maps tree SHAs to the entries they were created with.
+	trees map[string][]*github.TreeEntry
+	// commits maps commit SHAs to the tree and parents they were created
+	// with.
+	commits map[string]*github.Commit
+	// contents maps "<ref>:<path>" to file contents.
+	contents map[string]string
+	pulls    []*github.PullRequest
+	// forced records whether each ref update was forced.
+	forced []bool
+	// beforeUpdateRef, if set, is called with the lock held before a ref
+	// update that is not forced, and rejects it as not a fast forward by
+	// returning false.
+	beforeUpdateRef func(branch string) bool
+	nextID          int
+}
+
+func newFakeGitHub(t *testing.T) (*fakeGitHub, *github.Client) {
+	t.Helper()
+	f := &fakeGitHub{
+		refs:     map[string]string{"master": "base0"},
+		trees:    map[string][]*github.TreeEntry{},
+		commits:  map[string]*github.Commit{},
+		contents: map[string]string{},
+	}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+
+	client := github.NewClient(nil)
+	base, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.BaseURL = base
+	return f, client
+}
+
+func (f *fakeGitHub) sha(prefix string) string {
+	f.nextID++
+	return fmt.Sprintf("%s%d", prefix, f.nextID)
+}
+
+func (f *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	route := strings.TrimPrefix(r.URL.Path, "/repos/owner/repo/")
+	if route == r.URL.Path {
+		writeFakeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(route, "git/ref/heads/"):
+		branch := strings.TrimPrefix(route, "git/ref/heads/")
+		sha, ok := f.refs[branch]
+		if !ok {
+			writeFakeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+			return
+		}
+		writeFakeJSON(w, http.StatusOK, fakeRef(branch, sha))
+
+	case r.Method == http.MethodPost && route == "git/refs":
+		var body struct{ Ref, SHA string }
+		decodeFakeJSON(r, &body)
+		branch := strings.TrimPrefix(body.Ref, "refs/heads/")
+		if _, ok := f.refs[branch]; ok {
+			writeFakeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "Reference already exists"})
+			return
+		}
+		f.refs[branch] = body.SHA
+		writeFakeJSON(w, http.StatusCreated, fakeRef(branch, body.SHA))
+
+	case r.Method == http.MethodPatch && strings.HasPrefix(route, "git/refs/heads/"):
+		branch := strings.TrimPrefix(route, "git/refs/heads/")
+		var body struct {
+			SHA   string
+			Force bool
+		}
+		decodeFakeJSON(r, &body)
+		if _, ok := f.refs[branch]; !ok {
+			writeFakeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "Reference does not exist"})
+			return
+		}
+		if !body.Force && f.beforeUpdateRef != nil && !f.beforeUpdateRef(branch) {
+			writeFakeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "Update is not a fast forward"})
+			return
+		}
+		f.refs[branch] = body.SHA
+		f.forced = append(f.forced, body.Force)
+		writeFakeJSON(w, http.StatusOK, fakeRef(branch, body.SHA))
+
+	case r.Method == http.MethodPost && route == "git/trees":
+		var body struct {
+			BaseTree string              `json:"base_tree"`
+			Tree     []*github.TreeEntry `json:"tree"`
+		}
+		decodeFakeJSON(r, &body)
+		sha := f.sha("tree")
+		f.trees[sha] = body.Tree
+		writeFakeJSON(w, http.StatusCreated, &github.Tree{SHA: github.String(sha), Entries: body.Tree})
+
+	case r.Method == http.MethodPost && route == "git/commits":
+		var body struct {
+			Message string
+			Tree    string
+			Parents []string
+		}
+		decodeFakeJSON(r, &body)
+		commit := &github.Commit{
+			SHA:     github.String(f.sha("commit")),
+			Message: github.String(body.Message),
+			Tree:    &github.Tree{SHA: github.String(body.Tree)},
+		}
+		for _, parent := range body.Parents {
+			commit.Parents = append(commit.Parents, &github.Commit{SHA: github.String(parent)})
+		}
+		f.commits[commit.GetSHA()] = commit
+		writeFakeJSON(w, http.StatusCreated, commit)
+
+	case r.Method == http.MethodGet && strings.HasPrefix(route, "contents/"):
+		key := r.URL.Query().Get("ref") + ":" + strings.TrimPrefix(route, "contents/")
+		content, ok := f.contents[key]
+		if !ok {
+			writeFakeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+			return
+		}
+		writeFakeJSON(w, http.StatusOK, &github.RepositoryContent{
+			Type:     github.String("file"),
+			Encoding: github.String("base64"),
+			Content:  github.String(base64.StdEncoding.EncodeToString([]byte(content))),
+		})
+
+	case r.Method == http.MethodGet && route == "pulls":
+		query := r.URL.Query()
+		open := []*github.PullRequest{}
+		for _, pr := range f.pulls {
+			if pr.GetState() == query.Get("state") && "owner:"+pr.GetHead().GetRef() == query.Get("head") && pr.GetBase().GetRef() == query.Get("base") {
+				open = append(open, pr)
+			}
+		}
+		writeFakeJSON(w, http.StatusOK, open)
+
+	case r.Method == http.MethodPost && route == "pulls":
+		var body github.NewPullRequest
+		decodeFakeJSON(r, &body)
+		number := len(f.pulls) + 1
+		pr := &github.PullRequest{
+			Number:  github.Int(number),
+			State:   github.String("open"),
+			Title:   body.Title,
+			Body:    body.Body,
+			HTMLURL: github.String(fmt.Sprintf("https://github.com/owner/repo/pull/%d", number)),
+			Head:    &github.PullRequestBranch{Ref: body.Head},
+			Base:    &github.PullRequestBranch{Ref: body.Base},
+		}
+		f.pulls = append(f.pulls, pr)
+		writeFakeJSON(w, http.StatusCreated, pr)
+
+	case r.Method == http.MethodPatch && strings.HasPrefix(route, "pulls/"):
+		var number int
+		fmt.Sscan(strings.TrimPrefix(route, "pulls/"), &number)
+		if number < 1 || number > len(f.pulls) {
+			writeFakeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+			return
+		}
+		var body struct{ Title, Body *string }
+		decodeFakeJSON(r, &body)
+		pr := f.pulls[number-1]
+		pr.Title, pr.Body = body.Title, body.Body
+		writeFakeJSON(w, http.StatusOK, pr)
+
+	default:
+		writeFakeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+	}
+}
+
+func fakeRef(branch, sha string) *github.Reference {
+	return &github.Reference{
+		Ref:    github.String("refs/heads/" + branch),
+		Object: &github.GitObject{Type: github.String("commit"), SHA: github.String(sha)},
+	}
+}
+
+func decodeFakeJSON(r *http.Request, v interface{}) {
+	json.NewDecoder(r.Body).Decode(v)
+}
+
+func writeFakeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeTestCatalog writes testCatalog and its generated files to repoRoot
+// and returns the catalog path. The signature is written too, so that no
+// file has to be looked up in git.
+func writeTestCatalog(t *testing.T, repoRoot string) string {
+	t.Helper()
+	catalogPath := filepath.Join(repoRoot, "gitspace-catalog.toml")
+	files := map[string]string{filepath.Base(catalogPath): testCatalog}
+	for _, file := range append(append([]string{}, generatedFiles...), optionalGeneratedFiles...) {
+		files[file] = "generated " + file + "\n"
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(repoRoot, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return catalogPath
+}
+
+func TestPublishPullRequestOpensPullRequest(t *testing.T) {
+	fake, client := newFakeGitHub(t)
+	fake.contents["master:gitspace-catalog.toml"] = testBaseCatalog
+	repoRoot := t.TempDir()
+	catalogPath := writeTestCatalog(t, repoRoot)
+
+	result, err := publishPullRequest(context.Background(), io.Discard, client, "owner", "repo", "master", defaultPullRequestBranch, repoRoot, catalogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Created || result.Number != 1 {
+		t.Errorf("result = %+v, want pull request #1 created", result)
+	}
+	if fake.refs["master"] != "base0" {
+		t.Errorf("base branch moved to %s", fake.refs["master"])
+	}
+	if got := fake.refs[defaultPullRequestBranch]; got != result.Commit {
+		t.Errorf("%s points to %s, want %s", defaultPullRequestBranch, got, result.Commit)
+	}
+	commit := fake.commits[result.Commit]
+	if commit == nil || len(commit.Parents) != 1 || commit.Parents[0].GetSHA() != "base0" {
+		t.Fatalf("commit %s does not have base0 as its only parent: %+v", result.Commit, commit)
+	}
+	paths := map[string]bool{}
+	for _, entry := range fake.trees[commit.GetTree().GetSHA()] {
+		paths[entry.GetPath()] = true
+	}
+	for _, file := range append([]string{"gitspace-catalog.toml"}, generatedFiles...) {
+		if !paths[file] {
+			t.Errorf("tree does not contain %s", file)
+		}
+	}
+
+	pr := fake.pulls[0]
+	if pr.GetHead().GetRef() != defaultPullRequestBranch || pr.GetBase().GetRef() != "master" {
+		t.Errorf("pull request is from %s into %s", pr.GetHead().GetRef(), pr.GetBase().GetRef())
+	}
+	if pr.GetTitle() != "Update catalog to 2024.10.2" {
+		t.Errorf("title = %q", pr.GetTitle())
+	}
+	for _, want := range []string{"from 2024.10.1 to 2024.10.2", "`plugins.scmtea`: 1.0.0 → 1.1.0", "<details>"} {
+		if !strings.Contains(pr.GetBody(), want) {
+			t.Errorf("body does not contain %q:\n%s", want, pr.GetBody())
+		}
+	}
+}
+
+func TestPublishPullRequestRefreshesOpenPullRequest(t *testing.T) {
+	fake, client := newFakeGitHub(t)
+	repoRoot := t.TempDir()
+	catalogPath := writeTestCatalog(t, repoRoot)
+	ctx := context.Background()
+
+	first, err := publishPullRequest(ctx, io.Discard, client, "owner", "repo", "master", defaultPullRequestBranch, repoRoot, catalogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The base branch moves on and the catalog on it catches up, so the
+	// refreshed pull request only carries generated files.
+	fake.refs["master"] = "base1"
+	fake.contents["master:gitspace-catalog.toml"] = testCatalog
+
+	second, err := publishPullRequest(ctx, io.Discard, client, "owner", "repo", "master", defaultPullRequestBranch, repoRoot, catalogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Created || second.Number != first.Number {
+		t.Errorf("second result = %+v, want pull request #%d updated", second, first.Number)
+	}
+	if len(fake.pulls) != 1 {
+		t.Errorf("%d pull requests opened, want 1", len(fake.pulls))
+	}
+	if len(fake.forced) != 1 || !fake.forced[0] {
+		t.Errorf("ref updates forced = %v, want one forced update", fake.forced)
+	}
+	if got := fake.commits[fake.refs[defaultPullRequestBranch]].Parents[0].GetSHA(); got != "base1" {
+		t.Errorf("branch was rebuilt on %s, want base1", got)
+	}
+	if body := fake.pulls[0].GetBody(); !strings.Contains(body, "No catalog entries differ from `master`") {
+		t.Errorf("body was not refreshed:\n%s", body)
+	}
+}
+
+func TestCommitAndPushToConfiguredBranch(t *testing.T) {
+	fake, client := newFakeGitHub(t)
+	fake.refs["main"] = "main0"
+	repoRoot := t.TempDir()
+	catalogPath := writeTestCatalog(t, repoRoot)
+
+	sha, err := commitAndPush(context.Background(), io.Discard, client, "owner", "repo", "main", "main0", repoRoot, catalogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fake.refs["main"] != sha {
+		t.Errorf("main points to %s, want %s", fake.refs["main"], sha)
+	}
+	if fake.refs["master"] != "base0" {
+		t.Errorf("master moved to %s", fake.refs["master"])
+	}
+	if got := fake.commits[sha].Parents[0].GetSHA(); got != "main0" {
+		t.Errorf("commit parent = %s, want main0", got)
+	}
+	if len(fake.pulls) != 0 {
+		t.Errorf("push mode opened %d pull requests", len(fake.pulls))
+	}
+}
+
+func TestCommitAndPushRejectsMovedBase(t *testing.T) {
+	fake, client := newFakeGitHub(t)
+	repoRoot := t.TempDir()
+	catalogPath := writeTestCatalog(t, repoRoot)
+
+	_, err := commitAndPush(context.Background(), io.Discard, client, "owner", "repo", "master", "stale", repoRoot, catalogPath)
+	if !errors.Is(err, errNonFastForward) {
+		t.Fatalf("err = %v, want errNonFastForward", err)
+	}
+	if fake.refs["master"] != "base0" {
+		t.Errorf("master moved to %s", fake.refs["master"])
+	}
+	if len(fake.commits) != 0 {
+		t.Errorf("%d commits created on a moved branch", len(fake.commits))
+	}
+}
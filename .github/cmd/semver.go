@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var semverPattern = regexp.MustCompile(`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)` +
+	`(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?` +
+	`(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
+
+// Semver is a parsed semantic version (https://semver.org).
+type Semver struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string
+	Build      string
+}
+
+func parseSemver(s string) (Semver, error) {
+	m := semverPattern.FindStringSubmatch(s)
+	if m == nil {
+		return Semver{}, fmt.Errorf("%q is not a valid semantic version (expected MAJOR.MINOR.PATCH)", s)
+	}
+	var v Semver
+	var err error
+	if v.Major, err = strconv.Atoi(m[1]); err != nil {
+		return Semver{}, fmt.Errorf("invalid major version in %q: %w", s, err)
+	}
+	if v.Minor, err = strconv.Atoi(m[2]); err != nil {
+		return Semver{}, fmt.Errorf("invalid minor version in %q: %w", s, err)
+	}
+	if v.Patch, err = strconv.Atoi(m[3]); err != nil {
+		return Semver{}, fmt.Errorf("invalid patch version in %q: %w", s, err)
+	}
+	v.Prerelease = m[4]
+	v.Build = m[5]
+	return v, nil
+}
+
+func (v Semver) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 following semver precedence rules. Build
+// metadata is ignored.
+func (v Semver) Compare(o Semver) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+	return comparePrerelease(v.Prerelease, o.Prerelease)
+}
+
+func comparePrerelease(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
+
+// Constraint is a version constraint such as ">=1.2.0, <2.0.0" or
+// "^1.2 || ^2". Alternatives are separated by "||"; within an
+// alternative, comparators are separated by commas or spaces and must all
+// match; an operator may be followed by spaces, as in ">= 1.2". Supported operators are =, !=, >, >=, <, <=, ^ (same major, or
+// same minor below 1.0.0) and ~ (same minor). A bare version means =,
+// except that a partial one such as "1.2" matches any 1.2.x. "*" matches
+// any version, and missing minor or patch numbers default to 0.
+type Constraint struct {
+	text         string
+	alternatives [][]comparator
+}
+
+type comparator struct {
+	op string
+	v  Semver
+}
+
+var constraintOperators = []string{">=", "<=", "!=", ">", "<", "=", "^", "~"}
+
+func parseConstraint(s string) (Constraint, error) {
+	c := Constraint{text: s}
+	for _, alt := range strings.Split(s, "||") {
+		var comparators []comparator
+		fields := strings.FieldsFunc(alt, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+		for i := 0; i < len(fields); i++ {
+			field := fields[i]
+			if field == "*" {
+				continue
+			}
+			op := constraintOperator(field)
+			version := strings.TrimPrefix(field, op)
+			// Allow whitespace between an operator and its version, as
+			// in ">= 1.16".
+			if version == "" && op != "" && i+1 < len(fields) && constraintOperator(fields[i+1]) == "" {
+				i++
+				version = fields[i]
+			}
+			if version == "" {
+				return Constraint{}, fmt.Errorf("invalid constraint %q: operator %q without a version", s, op)
+			}
+			v, parts, err := parseConstraintVersion(version)
+			if err != nil {
+				return Constraint{}, fmt.Errorf("invalid constraint %q: %w", s, err)
+			}
+			comparators = append(comparators, expandComparator(op, v, parts)...)
+		}
+		if strings.TrimSpace(alt) == "" {
+			return Constraint{}, fmt.Errorf("invalid constraint %q: empty alternative", s)
+		}
+		c.alternatives = append(c.alternatives, comparators)
+	}
+	return c, nil
+}
+
+// constraintOperator returns the operator field starts with, or "".
+func constraintOperator(field string) string {
+	for _, op := range constraintOperators {
+		if strings.HasPrefix(field, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+// parseConstraintVersion parses a full or partial version such as "1" or
+// "1.2", and returns how many numeric parts were given.
+func parseConstraintVersion(s string) (Semver, int, error) {
+	core := s
+	if i := strings.IndexAny(core, "-+"); i >= 0 {
+		core = core[:i]
+	}
+	parts := strings.Count(core, ".") + 1
+	if parts < 3 && core != s {
+		return Semver{}, 0, fmt.Errorf("%q: a pre-release needs a full MAJOR.MINOR.PATCH version", s)
+	}
+	full := core + strings.Repeat(".0", max(0, 3-parts)) + s[len(core):]
+	v, err := parseSemver(full)
+	return v, parts, err
+}
+
+// expandComparator rewrites ^ and ~ into plain range comparators.
+func expandComparator(op string, v Semver, parts int) []comparator {
+	switch op {
+	case "^":
+		upper := Semver{Major: v.Major + 1}
+		switch {
+		case v.Major == 0 && (v.Minor > 0 || parts == 2):
+			upper = Semver{Minor: v.Minor + 1}
+		case v.Major == 0 && parts == 3:
+			upper = Semver{Minor: v.Minor, Patch: v.Patch + 1}
+		}
+		return []comparator{{">=", v}, {"<", upper}}
+	case "~":
+		upper := Semver{Major: v.Major, Minor: v.Minor + 1}
+		if parts == 1 {
+			upper = Semver{Major: v.Major + 1}
+		}
+		return []comparator{{">=", v}, {"<", upper}}
+	case "", "=":
+		if parts < 3 {
+			// "1.2" means any 1.2.x.
+			return expandComparator("~", v, parts)
+		}
+		return []comparator{{"=", v}}
+	default:
+		return []comparator{{op, v}}
+	}
+}
+
+// Check reports whether v satisfies the constraint.
+func (c Constraint) Check(v Semver) bool {
+	for _, alt := range c.alternatives {
+		ok := true
+		for _, cmp := range alt {
+			if !cmp.check(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c comparator) check(v Semver) bool {
+	d := v.Compare(c.v)
+	switch c.op {
+	case "=":
+		return d == 0
+	case "!=":
+		return d != 0
+	case ">":
+		return d > 0
+	case ">=":
+		return d >= 0
+	case "<":
+		return d < 0
+	case "<=":
+		return d <= 0
+	}
+	return false
+}
+
+func (c Constraint) String() string {
+	return c.text
+}
@@ -0,0 +1,71 @@
+package main
+
+import "testing"
+
+func TestConstraintCheck(t *testing.T) {
+	for _, tc := range []struct {
+		constraint string
+		match      []string
+		noMatch    []string
+	}{
+		{">=1.16", []string{"1.16.0", "1.23.1", "2.0.0"}, []string{"1.15.9"}},
+		{">= 1.16", []string{"1.16.0", "2.0.0"}, []string{"1.15.0"}},
+		{">=1.2.0, <2.0.0", []string{"1.2.0", "1.9.9"}, []string{"1.1.9", "2.0.0"}},
+		{">= 1.2.0 < 2.0.0", []string{"1.5.0"}, []string{"2.0.0"}},
+		{"^1.2", []string{"1.2.0", "1.9.0"}, []string{"1.1.9", "2.0.0"}},
+		{"^ 1.2", []string{"1.2.0", "1.9.0"}, []string{"2.0.0"}},
+		{"^0.2.3", []string{"0.2.3", "0.2.9"}, []string{"0.3.0", "0.2.2"}},
+		{"^0.0.3", []string{"0.0.3"}, []string{"0.0.4"}},
+		{"~1.2.3", []string{"1.2.3", "1.2.9"}, []string{"1.3.0"}},
+		{"~1", []string{"1.0.0", "1.9.0"}, []string{"2.0.0"}},
+		{"1.2", []string{"1.2.0", "1.2.7"}, []string{"1.3.0"}},
+		{"=1.2.3", []string{"1.2.3"}, []string{"1.2.4"}},
+		{"1.2.3", []string{"1.2.3"}, []string{"1.2.4"}},
+		{"!=1.2.3", []string{"1.2.4"}, []string{"1.2.3"}},
+		{"^1.2 || ^2", []string{"1.2.0", "2.5.0"}, []string{"3.0.0", "1.1.0"}},
+		{"*", []string{"0.0.1", "9.9.9"}, nil},
+		{">1.0.0-alpha", []string{"1.0.0-beta", "1.0.0"}, []string{"1.0.0-alpha"}},
+		{"\t>=\t1.0", []string{"1.0.0"}, []string{"0.9.0"}},
+	} {
+		c, err := parseConstraint(tc.constraint)
+		if err != nil {
+			t.Errorf("parseConstraint(%q): %v", tc.constraint, err)
+			continue
+		}
+		for _, v := range tc.match {
+			if !c.Check(mustSemver(t, v)) {
+				t.Errorf("%q does not match %s", tc.constraint, v)
+			}
+		}
+		for _, v := range tc.noMatch {
+			if c.Check(mustSemver(t, v)) {
+				t.Errorf("%q matches %s", tc.constraint, v)
+			}
+		}
+	}
+}
+
+func TestParseConstraintErrors(t *testing.T) {
+	for _, s := range []string{
+		">=",
+		"^ ",
+		">= >= 1.0",
+		"1.x",
+		"^1.2 ||",
+		"1.2-beta",
+		">=one",
+	} {
+		if _, err := parseConstraint(s); err == nil {
+			t.Errorf("parseConstraint(%q) succeeded", s)
+		}
+	}
+}
+
+func mustSemver(t *testing.T, s string) Semver {
+	t.Helper()
+	v, err := parseSemver(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
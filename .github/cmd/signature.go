@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/ssotops/gitspace-catalog/catalogsig"
+)
+
+const (
+	// signatureFile is the detached signature of the catalog files,
+	// written next to gitspace-catalog.toml.
+	signatureFile = catalogsig.FileName
+
+	// signingKeyEnv holds the ed25519 private key the pipeline signs
+	// with, either PEM encoded (PKCS #8) or as a base64 encoded seed.
+	signingKeyEnv = "CATALOG_SIGNING_KEY"
+)
+
+// signedFiles are the optional files covered by the signature besides the
+// catalog: its JSON exports. The catalog records the digest of every
+// entry and the sha256 of every artifact, so signing it covers those too.
+var signedFiles = []string{catalogJSONFile, searchIndexFile}
+
+// signCatalog writes the detached signature of the catalog files in dir.
+func signCatalog(w io.Writer, dir, catalogName string, key ed25519.PrivateKey) error {
+	sig, err := catalogsig.Sign(dir, catalogName, signedFiles, key)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Writing catalog signature with key %s to %s\n", sig.KeyID, filepath.Join(dir, signatureFile))
+	return sig.Write(dir)
+}
+
+// updateSignature signs the catalog files in dir with the key in
+// signingKeyEnv. Without a key, an existing signature no longer matches
+// the updated catalog and is removed.
+func updateSignature(w io.Writer, dir, catalogName string) error {
+	text := os.Getenv(signingKeyEnv)
+	if text == "" {
+		path := filepath.Join(dir, signatureFile)
+		if err := os.Remove(path); err == nil {
+			fmt.Fprintf(w, "%s is not set, removed stale signature %s\n", signingKeyEnv, path)
+		} else if !os.IsNotExist(err) {
+			return err
+		} else {
+			fmt.Fprintf(w, "%s is not set, catalog is not signed\n", signingKeyEnv)
+		}
+		return nil
+	}
+	key, err := catalogsig.ParsePrivateKey(text)
+	if err != nil {
+		return err
+	}
+	return signCatalog(w, dir, catalogName, key)
+}
+
+// readPublicKey parses the -public-key flag: a public key, or the name of
+// a file holding one.
+func readPublicKey(flag string) (ed25519.PublicKey, error) {
+	if content, err := os.ReadFile(flag); err == nil {
+		flag = string(content)
+	}
+	return catalogsig.ParsePublicKey(flag)
+}
+
+// verifyCatalogSignature checks the signature of the catalog at
+// catalogPath against the pinned publicKey.
+func verifyCatalogSignature(w io.Writer, catalogPath string, publicKey ed25519.PublicKey) error {
+	sig, err := catalogsig.Verify(filepath.Dir(catalogPath), filepath.Base(catalogPath), publicKey)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Catalog signature verified with key %s\n", sig.KeyID)
+	return nil
+}
+
+// verifyArtifacts checks the plugin packages found in distRoot against
+// the sha256 recorded in the catalog, printing one line per package.
+func verifyArtifacts(w io.Writer, catalog *Catalog, distRoot string) error {
+	fmt.Fprintf(w, "Verifying plugin artifacts in %s\n", distRoot)
+	recorded := make(map[string]map[string]string)
+	for name, plugin := range catalog.Plugins {
+		recorded[name] = make(map[string]string)
+		for _, a := range plugin.Artifacts {
+			recorded[name][a.Name] = a.SHA256
+		}
+	}
+	results, err := catalogsig.VerifyArtifacts(distRoot, recorded)
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Fprintf(w, "FAIL %s: %v\n", r.Name, r.Err)
+			continue
+		}
+		fmt.Fprintf(w, "ok   %s %s\n", r.Name, r.SHA256)
+	}
+	return err
+}
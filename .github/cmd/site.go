@@ -0,0 +1,331 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// catalogSourcePrefix is the module path that install snippets point at,
+// as documented in the top-level README.
+const catalogSourcePrefix = "github.com/ssotops/catalog"
+
+// siteDir is where the build pipeline exports the generated site,
+// relative to the repository root.
+const siteDir = "site"
+
+// sitePage is one catalog entry as shown on the site.
+type sitePage struct {
+	Kind    string
+	Name    string
+	Entry   *Entry
+	Install string
+	// InstallLang is the code block language of Install.
+	InstallLang string
+	README      template.HTML
+	Variables   []siteVariable
+	Commands    []keyValue
+	Deps        []keyValue
+	Requires    []siteRequirement
+}
+
+// siteRequirement is a dependency on another catalog entry.
+type siteRequirement struct {
+	Key        string
+	Constraint string
+	Resolved   string
+	// URL links to the required entry's page, relative to the site root.
+	URL string
+}
+
+type siteVariable struct {
+	Name string
+	Variable
+}
+
+// HasDefault reports whether the variable declares a default, which may
+// be a zero value such as false.
+func (v siteVariable) HasDefault() bool {
+	return v.Default != nil
+}
+
+// URL is the page path relative to the site root.
+func (p sitePage) URL() string {
+	return p.Kind + "/" + p.Name + ".html"
+}
+
+type siteData struct {
+	Catalog   CatalogInfo
+	Plugins   []sitePage
+	Templates []sitePage
+	// Page is set on entry pages.
+	Page *sitePage
+	// Root is the relative path from the page to the site root.
+	Root string
+}
+
+// generateSite renders catalog as a static website in outDir: an index of
+// all entries and one page per entry with its metadata, install snippet
+// and README.md. repoRoot is used to find the READMEs, and those of
+// included entries in the checkouts of their includes.
+func generateSite(w io.Writer, catalog *Catalog, repoRoot, outDir string) error {
+	fmt.Fprintf(w, "Generating catalog site in %s\n", outDir)
+	data := siteData{Catalog: catalog.Info}
+
+	err := catalog.forEachEntry(func(key string, entry *Entry) error {
+		kind, name, _ := strings.Cut(key, ".")
+		page, err := newSitePage(kind, name, entry, entryRoot(catalog.Info, repoRoot, entry))
+		if err != nil {
+			return err
+		}
+		if kind == "plugins" {
+			data.Plugins = append(data.Plugins, page)
+		} else {
+			data.Templates = append(data.Templates, page)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	data.Root = "."
+	if err := writeSitePage(filepath.Join(outDir, "index.html"), "index", data); err != nil {
+		return err
+	}
+	for _, pages := range [][]sitePage{data.Plugins, data.Templates} {
+		for i := range pages {
+			pageData := data
+			pageData.Page = &pages[i]
+			pageData.Root = ".." + strings.Repeat("/..", strings.Count(pages[i].Name, "/"))
+			if err := writeSitePage(filepath.Join(outDir, filepath.FromSlash(pages[i].URL())), "entry", pageData); err != nil {
+				return err
+			}
+		}
+	}
+	if err := os.WriteFile(filepath.Join(outDir, "style.css"), []byte(siteStyle), 0644); err != nil {
+		return fmt.Errorf("error writing site stylesheet: %w", err)
+	}
+	fmt.Fprintf(w, "Generated site with %d plugins and %d templates\n", len(data.Plugins), len(data.Templates))
+	return nil
+}
+
+// entrySource returns the module path entry is installed from: under
+// catalogSourcePrefix for entries of this repository, and under the source
+// of their origin for included entries. It is "" for an included entry
+// whose include declares no source.
+func entrySource(entry *Entry) string {
+	prefix := catalogSourcePrefix
+	if entry.Origin != "" {
+		prefix = entry.Source
+	}
+	if prefix == "" {
+		return ""
+	}
+	return strings.TrimSuffix(prefix, "/") + "/" + filepath.ToSlash(entry.Path)
+}
+
+// entryRoot returns the checkout that the path of entry is relative to:
+// repoRoot for entries of this repository, and the checkout of the include
+// an entry came from directly. It returns "" for entries that an included
+// catalog took from its own includes, whose checkout is not known here.
+func entryRoot(info CatalogInfo, repoRoot string, entry *Entry) string {
+	if entry.Origin == "" {
+		return repoRoot
+	}
+	inc, ok := info.Includes[entry.Origin]
+	if !ok {
+		return ""
+	}
+	path, err := includePath(repoRoot, inc)
+	if err != nil {
+		return ""
+	}
+	return filepath.Dir(path)
+}
+
+// newSitePage returns the page of entry. Its README is read from the
+// entry's directory in root, see entryRoot; an empty root means it has
+// none.
+func newSitePage(kind, name string, entry *Entry, root string) (sitePage, error) {
+	page := sitePage{Kind: kind, Name: name, Entry: entry}
+	source := entrySource(entry)
+	switch {
+	case source == "":
+		// The page points at the origin catalog instead.
+	case kind == "plugins":
+		page.Install = "gitspace plugin install " + source
+		page.InstallLang = "sh"
+	default:
+		page.Install = "[template]\nsource = " + quoteString(source)
+		page.InstallLang = "toml"
+	}
+
+	if root != "" {
+		readme, err := os.ReadFile(filepath.Join(root, entry.Path, "README.md"))
+		if err != nil && !os.IsNotExist(err) {
+			return page, fmt.Errorf("error reading README for %s: %w", name, err)
+		}
+		if len(readme) > 0 {
+			page.README = renderMarkdown(string(readme))
+		}
+	}
+
+	for _, v := range sortedKeys(entry.Variables) {
+		page.Variables = append(page.Variables, siteVariable{Name: v, Variable: entry.Variables[v]})
+	}
+	for _, k := range sortedKeys(entry.Commands) {
+		page.Commands = append(page.Commands, keyValue{k, entry.Commands[k]})
+	}
+	for _, k := range sortedKeys(entry.Dependencies) {
+		page.Deps = append(page.Deps, keyValue{k, entry.Dependencies[k]})
+	}
+	for _, k := range sortedKeys(entry.Requires) {
+		depKind, depName, _ := strings.Cut(k, ".")
+		page.Requires = append(page.Requires, siteRequirement{
+			Key:        k,
+			Constraint: entry.Requires[k],
+			Resolved:   entry.Resolved[k],
+			URL:        sitePage{Kind: depKind, Name: depName}.URL(),
+		})
+	}
+	return page, nil
+}
+
+func writeSitePage(path, name string, data siteData) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error creating %s: %w", filepath.Dir(path), err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", path, err)
+	}
+	defer f.Close()
+	if err := siteTemplates.ExecuteTemplate(f, name, data); err != nil {
+		return fmt.Errorf("error rendering %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+var siteTemplates = template.Must(template.New("site").Funcs(template.FuncMap{
+	"value": func(v interface{}) string {
+		if s, ok := v.(string); ok {
+			return s
+		}
+		return formatValue(v)
+	},
+	"join": strings.Join,
+}).Parse(`
+{{define "header"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{if .Page}}{{.Page.Name}} - {{end}}{{.Catalog.Name}}</title>
+<link rel="stylesheet" href="{{.Root}}/style.css">
+</head>
+<body>
+<header><a href="{{.Root}}/index.html">{{.Catalog.Name}}</a> <span class="version">{{.Catalog.Version}}</span></header>
+<main>
+{{end}}
+
+{{define "footer"}}</main>
+<footer>{{with .Catalog.LastUpdated}}Last updated {{.Date}}{{if .CommitHash}} ({{.CommitHash}}){{end}}{{end}}</footer>
+</body>
+</html>
+{{end}}
+
+{{define "list"}}<ul class="entries">
+{{range .}}<li><a href="{{.URL}}">{{.Name}}</a> <span class="version">{{.Entry.Version}}</span><p>{{.Entry.Description}}</p>{{with .Entry.Tags}}<p class="tags">{{join . ", "}}</p>{{end}}</li>
+{{end}}</ul>
+{{end}}
+
+{{define "index"}}{{template "header" .}}<h1>{{.Catalog.Name}}</h1>
+<p>{{.Catalog.Description}}</p>
+<h2>Plugins</h2>
+{{if .Plugins}}{{template "list" .Plugins}}{{else}}<p>No plugins yet.</p>{{end}}
+<h2>Templates</h2>
+{{if .Templates}}{{template "list" .Templates}}{{else}}<p>No templates yet.</p>{{end}}
+{{template "footer" .}}{{end}}
+
+{{define "entry"}}{{template "header" .}}{{with .Page}}<h1>{{.Name}} <span class="version">{{.Entry.Version}}</span></h1>
+<p>{{.Entry.Description}}</p>
+<h2>Install</h2>
+{{if .Install}}<pre><code class="language-{{.InstallLang}}">{{.Install}}</code></pre>
+{{else}}<p>Install it from the <code>{{.Entry.Origin}}</code> catalog it was included from.</p>
+{{end}}
+<h2>Details</h2>
+<dl>
+<dt>Path</dt><dd><code>{{.Entry.Path}}</code></dd>
+{{- with .Entry.Origin}}
+<dt>Origin</dt><dd>{{.}}</dd>{{end}}
+{{- with .Entry.Author}}
+<dt>Author</dt><dd>{{.}}</dd>{{end}}
+{{- with .Entry.License}}
+<dt>License</dt><dd>{{.}}</dd>{{end}}
+{{- with .Entry.Homepage}}
+<dt>Homepage</dt><dd><a href="{{.}}">{{.}}</a></dd>{{end}}
+{{- with .Entry.Tags}}
+<dt>Tags</dt><dd>{{join . ", "}}</dd>{{end}}
+{{- with .Entry.CommitHash}}
+<dt>Commit</dt><dd><code>{{.}}</code></dd>{{end}}
+{{- with .Entry.CommitDate}}
+<dt>Committed</dt><dd>{{.}}</dd>{{end}}
+{{- with .Entry.Digest}}
+<dt>Digest</dt><dd><code>{{.}}</code></dd>{{end}}
+{{- with .Entry.Compatibility}}
+{{- with .MinGitspaceVersion}}
+<dt>Minimum gitspace version</dt><dd>{{.}}</dd>{{end}}
+{{- with .SDK}}
+<dt>Plugin SDK</dt><dd><code>{{.}}</code></dd>{{end}}
+{{- with .Go}}
+<dt>Go</dt><dd>{{.}}</dd>{{end}}
+{{- end}}
+{{- with .Entry.Verification}}
+<dt>Verification</dt><dd>{{.Status}}{{with .Failed}} at <code>{{.}}</code>{{end}}{{with .Go}} with {{.}}{{end}}{{with .Commit}} on <code>{{.}}</code>{{end}}</dd>{{end}}
+</dl>
+{{with .Deps}}<h2>Dependencies</h2>
+<dl>{{range .}}<dt>{{.Key}}</dt><dd><code>{{value .Value}}</code></dd>{{end}}</dl>
+{{end}}{{with .Requires}}<h2>Requires</h2>
+<table>
+<tr><th>Entry</th><th>Constraint</th><th>Resolved</th></tr>
+{{range .}}<tr><td><a href="{{$.Root}}/{{.URL}}">{{.Key}}</a></td><td><code>{{.Constraint}}</code></td><td>{{.Resolved}}</td></tr>
+{{end}}</table>
+{{end}}{{with .Variables}}<h2>Variables</h2>
+<table>
+<tr><th>Name</th><th>Type</th><th>Default</th><th>Description</th></tr>
+{{range .}}<tr><td><code>{{.Name}}</code></td><td>{{.Type}}</td><td>{{if .HasDefault}}<code>{{value .Default}}</code>{{end}}</td><td>{{.Description}}</td></tr>
+{{end}}</table>
+{{end}}{{with .Commands}}<h2>Commands</h2>
+<dl>{{range .}}<dt>{{.Key}}</dt><dd><code>{{value .Value}}</code></dd>{{end}}</dl>
+{{end}}{{with .Entry.Artifacts}}<h2>Downloads</h2>
+<table>
+<tr><th>Platform</th><th>Package</th><th>Size</th><th>SHA-256</th></tr>
+{{range .}}<tr><td>{{.Platform}}</td><td><code>{{.Name}}</code></td><td>{{.Size}}</td><td><code>{{.SHA256}}</code></td></tr>
+{{end}}</table>
+{{end}}{{with .Entry.EntryPoints}}<h2>Entry Points</h2>
+<ul>{{range .}}<li><code>{{.Path}}</code>: <code>{{.Symbol}}</code></li>{{end}}</ul>
+{{end}}{{with .README}}<h2>README</h2>
+<article class="readme">
+{{.}}</article>
+{{end}}{{end}}{{template "footer" .}}{{end}}
+`))
+
+const siteStyle = `body { font-family: system-ui, sans-serif; max-width: 60rem; margin: 0 auto; padding: 0 1rem; color: #222; }
+header { padding: 1rem 0; border-bottom: 1px solid #ddd; }
+header a { font-weight: bold; text-decoration: none; color: inherit; }
+footer { padding: 1rem 0; border-top: 1px solid #ddd; color: #666; font-size: 0.9em; }
+.version { color: #666; font-size: 0.8em; font-weight: normal; }
+.tags { color: #666; font-size: 0.9em; }
+ul.entries { list-style: none; padding: 0; }
+ul.entries li { padding: 0.5rem 0; border-bottom: 1px solid #eee; }
+ul.entries p { margin: 0.25rem 0; }
+pre { background: #f5f5f5; padding: 0.75rem; overflow-x: auto; }
+dt { font-weight: bold; }
+dd { margin: 0 0 0.5rem 0; }
+table { border-collapse: collapse; }
+th, td { text-align: left; padding: 0.25rem 0.75rem 0.25rem 0; border-bottom: 1px solid #eee; }
+`
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewSitePageInstallSource(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		kind  string
+		entry Entry
+		want  string
+	}{
+		{"local plugin", "plugins", Entry{Path: "plugins/scmtea"}, "gitspace plugin install github.com/ssotops/catalog/plugins/scmtea"},
+		{"included plugin", "plugins", Entry{Path: "plugins/lint", Origin: "internal", Source: "github.com/acme/catalog"}, "gitspace plugin install github.com/acme/catalog/plugins/lint"},
+		{"included template", "templates", Entry{Path: "templates/starter", Origin: "internal", Source: "github.com/acme/catalog/"}, "[template]\nsource = \"github.com/acme/catalog/templates/starter\""},
+		{"included without source", "plugins", Entry{Path: "plugins/audit", Origin: "internal/official"}, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			page, err := newSitePage(tc.kind, "entry", &tc.entry, t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if page.Install != tc.want {
+				t.Errorf("install = %q, want %q", page.Install, tc.want)
+			}
+		})
+	}
+}
+
+func TestGenerateSiteReadsIncludedREADMEs(t *testing.T) {
+	repoRoot := t.TempDir()
+	writeTestFiles(t, repoRoot, map[string]string{
+		"plugins/scmtea/README.md":                       "local scmtea readme\n",
+		"vendor/official/gitspace-catalog.toml":          "[catalog]\n",
+		"vendor/official/plugins/scmtea/README.md":       "official scmtea readme\n",
+		"vendor/official/plugins/gitea-runner/README.md": "runner readme\n",
+	})
+	catalog := &Catalog{
+		Info: CatalogInfo{Name: "test", Includes: map[string]Include{"official": {Path: "vendor/official"}}},
+		Plugins: map[string]*PluginEntry{
+			"scmtea":          {Entry{Version: "1.0.0", Path: "plugins/scmtea"}},
+			"official/scmtea": {Entry{Version: "2.0.0", Path: "plugins/scmtea", Origin: "official"}},
+			// upstream is an include of official, whose checkout is not known.
+			"gitea-runner": {Entry{Version: "0.3.0", Path: "plugins/gitea-runner", Origin: "official/upstream"}},
+		},
+		Templates: map[string]*TemplateEntry{},
+	}
+	outDir := t.TempDir()
+	if err := generateSite(io.Discard, catalog, repoRoot, outDir); err != nil {
+		t.Fatal(err)
+	}
+	for page, want := range map[string]string{
+		"plugins/scmtea.html":          "local scmtea readme",
+		"plugins/official/scmtea.html": "official scmtea readme",
+		"plugins/gitea-runner.html":    "",
+	} {
+		content, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(page)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		html := string(content)
+		if want != "" && !strings.Contains(html, want) {
+			t.Errorf("%s does not show %q", page, want)
+		}
+		for _, other := range []string{"local scmtea readme", "official scmtea readme", "runner readme"} {
+			if other != want && strings.Contains(html, other) {
+				t.Errorf("%s shows the README %q of another entry", page, other)
+			}
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml"
+)
+
+var bareKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// formatTomlTree renders the catalog as TOML.
+//
+// Output is deterministic: the [catalog] section and entries use a fixed
+// key order (see CatalogInfo.fields and Entry.fields), entries are sorted
+// by name, and unmanaged keys are sorted by name. Values keep their TOML
+// type. Maps are written as inline tables unless they contain other
+// tables, in which case they get their own [section]. Comments that
+// directly follow a table header in the loaded file are written back
+// under the same header.
+func formatTomlTree(catalog *Catalog) string {
+	w := &tomlWriter{comments: catalog.comments}
+
+	// Unmanaged top-level values must come before the first table header,
+	// and unmanaged top-level tables keep their own [section].
+	var topLevel []keyValue
+	var extraTables []keyValue
+	for _, k := range sortedKeys(catalog.Extra) {
+		if _, ok := catalog.Extra[k].(map[string]interface{}); ok {
+			extraTables = append(extraTables, keyValue{k, catalog.Extra[k]})
+		} else {
+			topLevel = append(topLevel, keyValue{k, catalog.Extra[k]})
+		}
+	}
+	w.writeComments(nil)
+	if len(topLevel) > 0 {
+		w.writeValues(topLevel)
+		w.sb.WriteString("\n")
+	}
+
+	w.writeTable([]string{"catalog"}, catalog.Info.fields())
+
+	w.writeHeader([]string{"plugins"})
+	for _, name := range sortedKeys(catalog.Plugins) {
+		w.writeTable([]string{"plugins", name}, catalog.Plugins[name].fields())
+	}
+	if len(catalog.Plugins) == 0 {
+		w.sb.WriteString("\n")
+	}
+
+	w.writeHeader([]string{"templates"})
+	for _, name := range sortedKeys(catalog.Templates) {
+		w.writeTable([]string{"templates", name}, catalog.Templates[name].fields())
+	}
+	if len(catalog.Templates) == 0 {
+		w.sb.WriteString("\n")
+	}
+
+	// Unmanaged top-level tables are written back after the managed ones.
+	for _, kv := range extraTables {
+		w.writeTable([]string{kv.Key}, tableFields(kv.Value))
+	}
+
+	return w.sb.String()
+}
+
+type tomlWriter struct {
+	sb       strings.Builder
+	comments map[string][]string
+}
+
+// writeTable writes a table header, its values and then any sub-tables,
+// followed by a blank line.
+func (w *tomlWriter) writeTable(path []string, kv []keyValue) {
+	w.writeHeader(path)
+
+	var values, tables []keyValue
+	for _, item := range kv {
+		if isTable(item.Value) {
+			tables = append(tables, item)
+		} else {
+			values = append(values, item)
+		}
+	}
+	w.writeValues(values)
+	if len(values) > 0 && len(tables) > 0 {
+		w.sb.WriteString("\n")
+	}
+
+	for _, t := range tables {
+		sub := append(append([]string{}, path...), t.Key)
+		w.writeTable(sub, tableFields(t.Value))
+	}
+	if len(tables) == 0 {
+		w.sb.WriteString("\n")
+	}
+}
+
+func (w *tomlWriter) writeHeader(path []string) {
+	w.sb.WriteString("[" + formatKeyPath(path) + "]\n")
+	w.writeComments(path)
+}
+
+func (w *tomlWriter) writeComments(path []string) {
+	for _, line := range w.comments[formatKeyPath(path)] {
+		w.sb.WriteString(line + "\n")
+	}
+}
+
+func (w *tomlWriter) writeValues(kv []keyValue) {
+	for _, item := range kv {
+		w.sb.WriteString(fmt.Sprintf("%s = %s\n", formatKey(item.Key), formatValue(item.Value)))
+	}
+}
+
+// tomlTable is an ordered table that is always written as its own
+// [section] rather than as an inline table.
+type tomlTable []keyValue
+
+// isTable reports whether v must be written as its own [section], which
+// is the case for tomlTable and for maps that contain other maps.
+func isTable(v interface{}) bool {
+	if _, ok := v.(tomlTable); ok {
+		return true
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for _, value := range m {
+		if _, ok := value.(map[string]interface{}); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func tableFields(v interface{}) []keyValue {
+	if t, ok := v.(tomlTable); ok {
+		return t
+	}
+	m := v.(map[string]interface{})
+	kv := make([]keyValue, 0, len(m))
+	for _, k := range sortedKeys(m) {
+		kv = append(kv, keyValue{k, m[k]})
+	}
+	return kv
+}
+
+func formatKeyPath(path []string) string {
+	keys := make([]string, len(path))
+	for i, k := range path {
+		keys[i] = formatKey(k)
+	}
+	return strings.Join(keys, ".")
+}
+
+func formatKey(k string) string {
+	if bareKeyPattern.MatchString(k) {
+		return k
+	}
+	return quoteString(k)
+}
+
+// formatValue renders a single TOML value, keeping its type. Maps and
+// []keyValue are rendered as inline tables.
+func formatValue(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return quoteString(value)
+	case bool:
+		return strconv.FormatBool(value)
+	case int:
+		return strconv.Itoa(value)
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case uint64:
+		return strconv.FormatUint(value, 10)
+	case float64:
+		return formatFloat(value)
+	case time.Time:
+		return value.Format(time.RFC3339Nano)
+	case toml.LocalDate, toml.LocalTime, toml.LocalDateTime:
+		return fmt.Sprint(value)
+	case []string:
+		items := make([]string, len(value))
+		for i, item := range value {
+			items[i] = quoteString(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case []interface{}:
+		items := make([]string, len(value))
+		tables := false
+		for i, item := range value {
+			items[i] = formatValue(item)
+			_, isMap := item.(map[string]interface{})
+			tables = tables || isMap
+		}
+		if tables && len(items) > 1 {
+			// One inline table per line keeps long arrays readable.
+			return "[\n  " + strings.Join(items, ",\n  ") + ",\n]"
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]interface{}:
+		return formatInlineTable(tableFields(value))
+	case []keyValue:
+		return formatInlineTable(value)
+	case tomlTable:
+		return formatInlineTable(value)
+	default:
+		// Every value produced by the loader or the updater is handled
+		// above; fall back to a string rather than writing invalid TOML.
+		return quoteString(fmt.Sprint(value))
+	}
+}
+
+func formatInlineTable(kv []keyValue) string {
+	if len(kv) == 0 {
+		return "{}"
+	}
+	items := make([]string, len(kv))
+	for i, item := range kv {
+		items[i] = fmt.Sprintf("%s = %s", formatKey(item.Key), formatValue(item.Value))
+	}
+	return "{ " + strings.Join(items, ", ") + " }"
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eEn") {
+		s += ".0"
+	}
+	return s
+}
+
+// quoteString renders s as a TOML basic string.
+func quoteString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\b':
+			sb.WriteString(`\b`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case '\r':
+			sb.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				sb.WriteString(fmt.Sprintf(`\u%04X`, r))
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// parseHeaderComments collects the comment lines that directly follow
+// each table header in content, before the table's first key. Comments
+// before the first header are stored under "". Headers are normalised
+// with formatKeyPath so they can be looked up when writing.
+func parseHeaderComments(content []byte) map[string][]string {
+	comments := make(map[string][]string)
+	header := ""
+	collecting := true
+	for _, line := range strings.Split(string(content), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "["):
+			header = normaliseHeader(trimmed)
+			collecting = true
+		case strings.HasPrefix(trimmed, "#"):
+			if collecting {
+				comments[header] = append(comments[header], trimmed)
+			}
+		case trimmed == "":
+		default:
+			collecting = false
+		}
+	}
+	return comments
+}
+
+func normaliseHeader(line string) string {
+	line = strings.TrimSuffix(strings.TrimPrefix(line, "["), "]")
+	if i := strings.Index(line, "]"); i >= 0 {
+		line = line[:i]
+	}
+	var path []string
+	for _, part := range splitHeader(line) {
+		part = strings.TrimSpace(part)
+		if unquoted, err := strconv.Unquote(part); err == nil && strings.HasPrefix(part, `"`) {
+			part = unquoted
+		} else {
+			part = strings.Trim(part, "'")
+		}
+		path = append(path, part)
+	}
+	return formatKeyPath(path)
+}
+
+// splitHeader splits a dotted table header, honouring quoted keys.
+func splitHeader(header string) []string {
+	var parts []string
+	var current strings.Builder
+	var quote rune
+	for _, r := range header {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+			current.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			current.WriteRune(r)
+		case r == '.':
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	return append(parts, current.String())
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func roundTrip(t *testing.T, name string, content []byte) (*Catalog, string) {
+	t.Helper()
+	catalog, err := parseCatalog(name, content)
+	if err != nil {
+		t.Fatalf("parse %s: %v", name, err)
+	}
+	formatted := formatTomlTree(catalog)
+	reparsed, err := parseCatalog(name, []byte(formatted))
+	if err != nil {
+		t.Fatalf("parse formatted %s: %v\n%s", name, err, formatted)
+	}
+	// Comments are checked through the formatted output instead.
+	catalog.comments, reparsed.comments = nil, nil
+	if !reflect.DeepEqual(catalog, reparsed) {
+		t.Errorf("%s: catalog changed in round trip\nbefore: %#v\nafter:  %#v", name, catalog, reparsed)
+	}
+	return reparsed, formatted
+}
+
+func TestFormatTomlTreeRoundTripsRepositoryCatalogs(t *testing.T) {
+	for _, path := range []string{
+		"../../gitspace-catalog.toml",
+		"../../templates/gitspace-catalog-starter/gitspace-catalog.toml",
+	} {
+		t.Run(filepath.Base(filepath.Dir(path)), func(t *testing.T) {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			roundTrip(t, path, content)
+		})
+	}
+}
+
+func TestFormatTomlTreeIsIdempotent(t *testing.T) {
+	content, err := os.ReadFile("../../templates/gitspace-catalog-starter/gitspace-catalog.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog, err := parseCatalog("starter", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := formatTomlTree(catalog)
+	catalog, err = parseCatalog("starter", []byte(first))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second := formatTomlTree(catalog); second != first {
+		t.Errorf("formatting is not stable\nfirst:\n%s\nsecond:\n%s", first, second)
+	}
+}
+
+func TestFormatTomlTreeKeepsHeaderComments(t *testing.T) {
+	content, err := os.ReadFile("../../templates/gitspace-catalog-starter/gitspace-catalog.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog, err := parseCatalog("starter", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	formatted := formatTomlTree(catalog)
+	for _, want := range []string{
+		"[plugins]\n# This section will be automatically updated by the GitHub Action\n",
+		"[templates]\n# This section will be automatically updated by the GitHub Action\n",
+	} {
+		if !strings.Contains(formatted, want) {
+			t.Errorf("formatted catalog is missing %q:\n%s", want, formatted)
+		}
+	}
+}
+
+func TestFormatTomlTreePreservesValueTypes(t *testing.T) {
+	const content = `schema = 2
+
+[catalog]
+name = "Typed"
+description = "Catalog with \"quotes\" and a tab\t"
+version = "1.2.3"
+mirrors = ["a", "b"]
+retries = 3
+ratio = 1.0
+enabled = false
+published = 2024-10-03T13:42:00Z
+
+[plugins]
+[plugins."dotted.name"]
+version = "1.0.0"
+description = "A plugin"
+path = "plugins/dotted.name"
+tags = ["gitea", "docker"]
+dependencies = { go = ">=1.16" }
+entry_points = [{ path = "main.go", entry_point = "Plugin" }]
+size = 42
+limits = { cpu = 1.5, pinned = true, ports = [80, 443] }
+
+[templates]
+[templates.starter]
+version = "0.1.0"
+description = "A template"
+path = "templates/starter"
+
+[templates.starter.variables]
+name = { type = "string", description = "Name", default = "x" }
+count = { type = "int", default = 3 }
+
+[mirror]
+url = "https://example.com"
+weight = 10
+`
+	catalog, formatted := roundTrip(t, "typed", []byte(content))
+
+	for _, want := range []string{
+		"schema = 2\n",
+		"retries = 3\n",
+		"ratio = 1.0\n",
+		"enabled = false\n",
+		"published = 2024-10-03T13:42:00Z\n",
+		`description = "Catalog with \"quotes\" and a tab\t"` + "\n",
+		`[plugins."dotted.name"]` + "\n",
+		"size = 42\n",
+		"limits = { cpu = 1.5, pinned = true, ports = [80, 443] }\n",
+		"[templates.starter.variables]\n",
+		`count = { default = 3, type = "int" }` + "\n",
+		"[mirror]\nurl = \"https://example.com\"\nweight = 10\n",
+	} {
+		if !strings.Contains(formatted, want) {
+			t.Errorf("formatted catalog is missing %q:\n%s", want, formatted)
+		}
+	}
+
+	plugin := catalog.Plugins["dotted.name"]
+	if plugin == nil {
+		t.Fatalf("plugin with dotted name was lost:\n%s", formatted)
+	}
+	if got := plugin.Extra["size"]; got != int64(42) {
+		t.Errorf("size = %#v, want int64(42)", got)
+	}
+	if got := catalog.Templates["starter"].Variables["count"].Default; got != int64(3) {
+		t.Errorf("count default = %#v, want int64(3)", got)
+	}
+}
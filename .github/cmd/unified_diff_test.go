@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// numberedLines returns "line 1\n" to "line n\n", with the lines in
+// changed replaced by "changed N\n".
+func numberedLines(n int, changed ...int) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		line := fmt.Sprintf("line %d\n", i)
+		for _, c := range changed {
+			if c == i {
+				line = fmt.Sprintf("changed %d\n", i)
+			}
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+var hunkHeader = regexp.MustCompile(`(?m)^@@ .* @@$`)
+
+func TestUnifiedDiff(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		oldName   string
+		newName   string
+		oldText   string
+		newText   string
+		want      string
+		wantHunks []string
+	}{
+		{
+			name:    "equal",
+			oldName: "f", newName: "f",
+			oldText: "a\nb\n", newText: "a\nb\n",
+			want: "",
+		},
+		{
+			name:    "create",
+			oldName: "", newName: "CHANGELOG.md",
+			oldText: "", newText: "a\nb\n",
+			want: "--- /dev/null\n+++ b/CHANGELOG.md\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name:    "delete",
+			oldName: "gitspace-catalog.sig", newName: "",
+			oldText: "a\nb\n", newText: "",
+			want: "--- a/gitspace-catalog.sig\n+++ /dev/null\n@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name:    "single line",
+			oldName: "f", newName: "f",
+			oldText: "a\n", newText: "b\n",
+			want: "--- a/f\n+++ b/f\n@@ -1 +1 @@\n-a\n+b\n",
+		},
+		{
+			name:    "insertion at the top",
+			oldName: "f", newName: "f",
+			oldText: numberedLines(5), newText: "new\n" + numberedLines(5),
+			want: "--- a/f\n+++ b/f\n@@ -1,3 +1,4 @@\n+new\n line 1\n line 2\n line 3\n",
+		},
+		{
+			name:    "change in the middle",
+			oldName: "f", newName: "f",
+			oldText: numberedLines(20), newText: numberedLines(20, 10),
+			want: "--- a/f\n+++ b/f\n@@ -7,7 +7,7 @@\n line 7\n line 8\n line 9\n-line 10\n+changed 10\n line 11\n line 12\n line 13\n",
+		},
+		{
+			name:    "distant changes",
+			oldName: "f", newName: "f",
+			oldText: numberedLines(20), newText: numberedLines(20, 2, 18),
+			wantHunks: []string{"@@ -1,5 +1,5 @@", "@@ -15,6 +15,6 @@"},
+		},
+		{
+			name:    "close changes share a hunk",
+			oldName: "f", newName: "f",
+			oldText: numberedLines(20), newText: numberedLines(20, 5, 11),
+			wantHunks: []string{"@@ -2,13 +2,13 @@"},
+		},
+		{
+			name:    "lines removed before a change",
+			oldName: "f", newName: "f",
+			oldText: numberedLines(20), newText: strings.Replace(numberedLines(20, 18), "line 2\nline 3\n", "", 1),
+			wantHunks: []string{"@@ -1,6 +1,4 @@", "@@ -15,6 +13,6 @@"},
+		},
+		{
+			name:    "no trailing newline",
+			oldName: "f", newName: "f",
+			oldText: "a\nb", newText: "a\nc",
+			want: "--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+		},
+		{
+			name:    "trailing newline added",
+			oldName: "f", newName: "f",
+			oldText: "a\nb", newText: "a\nb\n",
+			want: "--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := unifiedDiff(test.oldName, test.newName, test.oldText, test.newText)
+			if test.wantHunks == nil {
+				if got != test.want {
+					t.Errorf("unifiedDiff() =\n%s\nwant\n%s", got, test.want)
+				}
+				return
+			}
+			hunks := hunkHeader.FindAllString(got, -1)
+			if strings.Join(hunks, "\n") != strings.Join(test.wantHunks, "\n") {
+				t.Errorf("hunks = %q, want %q in\n%s", hunks, test.wantHunks, got)
+			}
+		})
+	}
+}
+
+// lcsLength is the length of the longest common subsequence of a and b.
+func lcsLength(a, b []string) int {
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else {
+				dp[i][j] = max(dp[i+1][j], dp[i][j+1])
+			}
+		}
+	}
+	return dp[0][0]
+}
+
+func TestDiffLinesIsShortestEditScript(t *testing.T) {
+	for _, test := range []struct{ a, b string }{
+		{"abcabba", "cbabac"},
+		{"abcdef", "abcdef"},
+		{"", "abc"},
+		{"abc", ""},
+		{"xaxbxc", "abc"},
+		{"abc", "xaxbxc"},
+		{"aaaa", "aa"},
+		{"abcd", "dcba"},
+		{"a b c d e f g", "a c d x f g y"},
+	} {
+		a, b := strings.Split(test.a, ""), strings.Split(test.b, "")
+		ops := diffLines(a, b)
+		var oldLines, newLines []string
+		edits := 0
+		for _, op := range ops {
+			if op.Kind != '+' {
+				oldLines = append(oldLines, op.Line)
+			}
+			if op.Kind != '-' {
+				newLines = append(newLines, op.Line)
+			}
+			if op.Kind != ' ' {
+				edits++
+			}
+		}
+		if strings.Join(oldLines, "") != test.a || strings.Join(newLines, "") != test.b {
+			t.Errorf("%q -> %q: the edit script gives %q -> %q", test.a, test.b, strings.Join(oldLines, ""), strings.Join(newLines, ""))
+		}
+		if want := len(a) + len(b) - 2*lcsLength(a, b); edits != want {
+			t.Errorf("%q -> %q: %d edits, want %d", test.a, test.b, edits, want)
+		}
+	}
+}
@@ -1,150 +1,337 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/pelletier/go-toml"
 )
 
-func updateCatalog(repoRoot string) error {
-	fmt.Println("Starting catalog update process...")
-	catalogPath := filepath.Join(repoRoot, "gitspace-catalog.toml")
-	fmt.Printf("Catalog path: %s\n", catalogPath)
+// catalogUpdate is a planned catalog update: the catalog as it is on
+// disk, the regenerated catalog and the diff between them.
+type catalogUpdate struct {
+	CatalogPath string
+	Previous    *Catalog
+	Catalog     *Catalog
+	Diff        CatalogDiff
+	// Generated are the files derived from an unchanged catalog that were
+	// written because they were missing or stale.
+	Generated []string
+}
+
+// Changed reports whether the update changed any file: the entries of
+// the catalog, or only files generated from it.
+func (u *catalogUpdate) Changed() bool {
+	return !u.Diff.Empty() || len(u.Generated) > 0
+}
+
+// Dir is the directory of the catalog, where the other generated files
+// are written too.
+func (u *catalogUpdate) Dir() string {
+	return filepath.Dir(u.CatalogPath)
+}
+
+// Record is the history record of the update.
+func (u *catalogUpdate) Record() HistoryRecord {
+	return newHistoryRecord(u.Previous.Info.Version, u.Catalog, u.Diff)
+}
+
+// planCatalogUpdate regenerates the catalog at catalogPath from the
+// entries in repoRoot, without writing anything. When entries changed,
+// the planned catalog also has its next version and last_updated.
+func planCatalogUpdate(w io.Writer, repoRoot, catalogPath string) (*catalogUpdate, error) {
+	fmt.Fprintln(w, "Starting catalog update process...")
+	fmt.Fprintf(w, "Catalog path: %s\n", catalogPath)
 
-	catalog, err := loadCatalog(catalogPath)
+	catalog, err := loadCatalog(w, catalogPath)
 	if err != nil {
-		return fmt.Errorf("error loading catalog: %w", err)
+		return nil, fmt.Errorf("error loading catalog: %w", err)
+	}
+	if _, err := versionPolicyFor(catalog.Info.VersionPolicy); err != nil {
+		return nil, fmt.Errorf("error loading catalog: %w", err)
+	}
+	if err := checkIncludes(catalog.Info.Includes); err != nil {
+		return nil, fmt.Errorf("error loading catalog: %w", err)
+	}
+	previous := catalog.clone()
+
+	entries, err := discoverEntries(w, repoRoot, discoveryOptionsFor(catalog))
+	if err != nil {
+		return nil, fmt.Errorf("error discovering entries: %w", err)
 	}
 
-	fmt.Println("Loaded catalog content:")
-	fmt.Println(catalog.String())
+	// A broken manifest must fail the update rather than silently drop
+	// the entry from the catalog.
+	if err := runValidate(w, repoRoot, entries); err != nil {
+		return nil, err
+	}
 
-	preserveCatalogInfo(catalog)
-	updatePlugins(catalog, repoRoot)
-	updateTemplates(catalog, repoRoot)
-	incrementVersion(catalog)
-	updateLastUpdated(catalog)
+	preserveCatalogInfo(w, catalog)
+	updatePlugins(w, catalog, entries)
+	updateTemplates(w, catalog, entries)
 
 	// Convert absolute paths to relative paths
 	convertToRelativePaths(catalog, repoRoot)
 
-	fmt.Println("Updated catalog content:")
-	updatedContent := formatTomlTree(catalog)
-	fmt.Println(updatedContent)
+	if err := updateProvenance(w, catalog, repoRoot); err != nil {
+		return nil, fmt.Errorf("error updating entry provenance: %w", err)
+	}
+
+	if err := updateDigests(w, catalog, repoRoot); err != nil {
+		return nil, fmt.Errorf("error updating entry digests: %w", err)
+	}
+
+	if err := updateArtifacts(w, catalog, previous, repoRoot); err != nil {
+		return nil, fmt.Errorf("error updating plugin artifacts: %w", err)
+	}
+
+	if err := updateVerification(w, catalog, previous, repoRoot); err != nil {
+		return nil, fmt.Errorf("error updating entry verification: %w", err)
+	}
+
+	// Included entries keep the provenance and digests of their origin,
+	// so they are merged after this repository's entries are updated.
+	if err := mergeIncludes(w, catalog, repoRoot); err != nil {
+		return nil, fmt.Errorf("error merging included catalogs: %w", err)
+	}
+
+	if err := resolveDependencies(w, catalog); err != nil {
+		return nil, err
+	}
+
+	update := &catalogUpdate{
+		CatalogPath: catalogPath,
+		Previous:    previous,
+		Catalog:     catalog,
+		Diff:        diffCatalogs(previous, catalog),
+	}
+	if update.Diff.Empty() {
+		return update, nil
+	}
+	fmt.Fprintf(w, "Catalog changes:\n%s", update.Diff)
+
+	head, err := gitHeadCommit(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	if err := incrementVersion(w, catalog, update.Diff, head.Date); err != nil {
+		return nil, fmt.Errorf("error incrementing version: %w", err)
+	}
+	updateLastUpdated(w, catalog, head)
+	return update, nil
+}
+
+// write saves the planned catalog and writes the JSON exports, signature
+// and changelog next to it.
+func (u *catalogUpdate) write(w io.Writer) error {
+	fmt.Fprintln(w, "Updated catalog content:")
+	updatedContent := formatTomlTree(u.Catalog)
+	fmt.Fprintln(w, updatedContent)
 
 	if updatedContent == "" {
 		return fmt.Errorf("updated catalog content is empty, aborting save to prevent data loss")
 	}
 
-	err = saveCatalog(updatedContent, catalogPath)
-	if err != nil {
+	if err := saveCatalog(w, updatedContent, u.CatalogPath); err != nil {
 		return fmt.Errorf("error saving catalog: %w", err)
 	}
-
-	fmt.Println("Catalog updated successfully")
+	if err := writeCatalogExports(w, u.Catalog, u.Dir()); err != nil {
+		return fmt.Errorf("error exporting catalog: %w", err)
+	}
+	if err := updateSignature(w, u.Dir(), filepath.Base(u.CatalogPath)); err != nil {
+		return fmt.Errorf("error signing catalog: %w", err)
+	}
+	if err := updateChangelog(w, u.Dir(), u.Record(), u.Diff); err != nil {
+		return fmt.Errorf("error updating changelog: %w", err)
+	}
 	return nil
 }
 
-func convertToRelativePaths(catalog *toml.Tree, repoRoot string) {
-	convertSection := func(sectionName string) {
-		if section, ok := catalog.Get(sectionName).(*toml.Tree); ok {
-			for _, key := range section.Keys() {
-				if item, ok := section.Get(key).(*toml.Tree); ok {
-					if path, ok := item.Get("path").(string); ok {
-						relPath, err := filepath.Rel(repoRoot, path)
-						if err == nil {
-							item.Set("path", relPath)
-						}
-					}
-				}
-			}
+// planGenerated records in Generated the files generated from an
+// unchanged catalog that are missing or stale, such as the JSON exports of
+// a catalog that was never updated, without writing them. It returns the
+// content of each of them but the signature, which is computed from the
+// files once they are written.
+func (u *catalogUpdate) planGenerated() (map[string][]byte, error) {
+	exports, err := catalogExports(u.Catalog)
+	if err != nil {
+		return nil, err
+	}
+	stale := map[string][]byte{}
+	for file, content := range exports {
+		existing, err := os.ReadFile(filepath.Join(u.Dir(), file))
+		if err == nil && bytes.Equal(existing, content) {
+			continue
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error reading %s: %w", file, err)
+		}
+		stale[file] = content
+	}
+
+	// The signature covers the exports, so it is stale once they change.
+	// Without a key, updateSignature removes a stale signature.
+	_, err = os.Stat(filepath.Join(u.Dir(), signatureFile))
+	signed, canSign := err == nil, os.Getenv(signingKeyEnv) != ""
+	resign := (len(stale) > 0 && (signed || canSign)) || (!signed && canSign)
+
+	// Without entry changes there is no release to record, but the
+	// changelog and history are committed with the catalog, so they
+	// must exist.
+	for file, content := range map[string]string{changelogFile: changelogHeader, historyFile: ""} {
+		if _, err := os.Stat(filepath.Join(u.Dir(), file)); os.IsNotExist(err) {
+			stale[file] = []byte(content)
 		}
 	}
 
-	convertSection("plugins")
-	convertSection("templates")
+	u.Generated = sortedKeys(stale)
+	if resign {
+		u.Generated = append(u.Generated, signatureFile)
+		sort.Strings(u.Generated)
+	}
+	return stale, nil
 }
 
-func loadCatalog(path string) (*toml.Tree, error) {
-	fmt.Printf("Attempting to load catalog from: %s\n", path)
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		fmt.Println("Catalog file does not exist, creating a new one")
-		return toml.Load(`[catalog]
-name = "Gitspace Official Catalog"
-description = "Official catalog of plugins and templates for Gitspace"
-version = "0.1.0"
+// refreshGenerated writes the files planGenerated finds missing or stale.
+// The catalog file and the changelog entries are left untouched.
+func (u *catalogUpdate) refreshGenerated(w io.Writer) error {
+	stale, err := u.planGenerated()
+	if err != nil {
+		return err
+	}
+	for _, file := range sortedKeys(stale) {
+		path := filepath.Join(u.Dir(), file)
+		if err := os.WriteFile(path, stale[file], 0644); err != nil {
+			return fmt.Errorf("error writing %s: %w", file, err)
+		}
+		fmt.Fprintf(w, "Wrote %s\n", path)
+	}
+	for _, file := range u.Generated {
+		if file == signatureFile {
+			if err := updateSignature(w, u.Dir(), filepath.Base(u.CatalogPath)); err != nil {
+				return fmt.Errorf("error signing catalog: %w", err)
+			}
+		}
+	}
+	return nil
+}
 
-[plugins]
+// planUpdate plans the update of the catalog at catalogPath like
+// planCatalogUpdate and, when no entries changed, the generated files
+// updateCatalog would write, without writing anything.
+func planUpdate(w io.Writer, repoRoot, catalogPath string) (*catalogUpdate, error) {
+	update, err := planCatalogUpdate(w, repoRoot, catalogPath)
+	if err != nil {
+		return nil, err
+	}
+	if update.Diff.Empty() {
+		if _, err := update.planGenerated(); err != nil {
+			return nil, err
+		}
+	}
+	return update, nil
+}
 
-[templates]
-`)
+// upToDate returns an error if the planned update changes any file.
+func (u *catalogUpdate) upToDate() error {
+	switch {
+	case !u.Diff.Empty():
+		return fmt.Errorf("catalog is out of date: %d entries changed, run the update command", len(u.Diff.Changes))
+	case u.Changed():
+		return fmt.Errorf("generated files are out of date: %s, run the update command", strings.Join(u.Generated, ", "))
 	}
-	content, err := ioutil.ReadFile(path)
+	return nil
+}
+
+// updateCatalog regenerates the catalog at catalogPath from the entries in
+// repoRoot. When the diff is empty the catalog file, including its version
+// and last_updated, is left untouched, and only generated files that are
+// missing or stale are written.
+func updateCatalog(w io.Writer, repoRoot, catalogPath string) (*catalogUpdate, error) {
+	update, err := planCatalogUpdate(w, repoRoot, catalogPath)
 	if err != nil {
-		return nil, fmt.Errorf("error reading catalog file: %w", err)
+		return nil, err
 	}
-	fmt.Printf("Loaded catalog content:\n%s\n", string(content))
-	return toml.Load(string(content))
+	if update.Diff.Empty() {
+		fmt.Fprintln(w, "No catalog entries changed, leaving catalog untouched")
+		if err := update.refreshGenerated(w); err != nil {
+			return nil, err
+		}
+		if len(update.Generated) > 0 {
+			fmt.Fprintf(w, "Regenerated %s\n", strings.Join(update.Generated, ", "))
+		}
+		return update, nil
+	}
+	if err := update.write(w); err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(w, "Catalog updated successfully")
+	return update, nil
 }
 
-func preserveCatalogInfo(catalog *toml.Tree) {
-	fmt.Println("Preserving catalog info...")
-	if !catalog.Has("catalog") {
-		catalog.Set("catalog", make(map[string]interface{}))
+func convertToRelativePaths(catalog *Catalog, repoRoot string) {
+	convert := func(entry *Entry) {
+		relPath, err := filepath.Rel(repoRoot, entry.Path)
+		if err == nil {
+			entry.Path = relPath
+		}
+	}
+
+	for _, plugin := range catalog.Plugins {
+		convert(&plugin.Entry)
+	}
+	for _, template := range catalog.Templates {
+		convert(&template.Entry)
 	}
-	catalogInfo := catalog.Get("catalog").(*toml.Tree)
-	if !catalogInfo.Has("name") {
-		catalogInfo.Set("name", "Gitspace Official Catalog")
+}
+
+func preserveCatalogInfo(w io.Writer, catalog *Catalog) {
+	fmt.Fprintln(w, "Preserving catalog info...")
+	info := &catalog.Info
+	if info.Name == "" {
+		info.Name = defaultCatalogName
 	}
-	if !catalogInfo.Has("description") {
-		catalogInfo.Set("description", "Official catalog of plugins and templates for Gitspace")
+	if info.Description == "" {
+		info.Description = defaultCatalogDescription
 	}
-	if !catalogInfo.Has("version") {
-		catalogInfo.Set("version", "0.1.0")
+	if info.Version == "" {
+		info.Version = defaultCatalogVersion
 	}
-	catalog.Set("catalog", catalogInfo)
-	fmt.Printf("Preserved catalog info: %v\n", catalogInfo)
+	fmt.Fprintf(w, "Preserved catalog info: %+v\n", *info)
 }
 
-func updatePlugins(catalog *toml.Tree, repoRoot string) {
-	fmt.Println("Updating plugins...")
-	plugins := make(map[string]interface{})
-	pluginsDir := filepath.Join(repoRoot, "plugins")
-	fmt.Printf("Plugins directory: %s\n", pluginsDir)
+func updatePlugins(w io.Writer, catalog *Catalog, entries []discoveredEntry) {
+	fmt.Fprintln(w, "Updating plugins...")
+	plugins := make(map[string]*PluginEntry)
 
-	err := filepath.Walk(pluginsDir, func(path string, info os.FileInfo, err error) error {
+	for _, d := range entries {
+		if d.Kind != "plugins" {
+			continue
+		}
+		fmt.Fprintf(w, "Found plugin %s in %s\n", d.Name, d.Dir)
+		pluginInfo, err := loadPluginInfo(d.Dir)
 		if err != nil {
-			fmt.Printf("Error accessing path %q: %v\n", path, err)
-			return nil
+			fmt.Fprintf(w, "Error loading plugin info for %s: %v\n", d.Name, err)
+			continue
 		}
-		if info.IsDir() && info.Name() != "plugins" {
-			fmt.Printf("Found plugin directory: %s\n", info.Name())
-			pluginInfo, err := loadPluginInfo(path)
-			if err == nil {
-				plugins[info.Name()] = pluginInfo
-				fmt.Printf("Added plugin %s: %v\n", info.Name(), pluginInfo)
-			} else {
-				fmt.Printf("Error loading plugin info for %s: %v\n", info.Name(), err)
-			}
+		if existing, ok := catalog.Plugins[d.Name]; ok {
+			pluginInfo.Extra = existing.Extra
 		}
-		return nil
-	})
-
-	if err != nil {
-		fmt.Printf("Error walking plugins directory: %v\n", err)
+		plugins[d.Name] = pluginInfo
+		fmt.Fprintf(w, "Added plugin %s: %+v\n", d.Name, pluginInfo.Entry)
 	}
 
-	pluginsTree, _ := toml.TreeFromMap(plugins)
-	catalog.Set("plugins", pluginsTree)
-	fmt.Printf("Updated plugins: %v\n", plugins)
+	catalog.Plugins = plugins
+	fmt.Fprintf(w, "Updated plugins: %v\n", sortedKeys(plugins))
 }
 
-func loadPluginInfo(pluginDir string) (map[string]interface{}, error) {
+func loadPluginInfo(pluginDir string) (*PluginEntry, error) {
 	tomlPath := filepath.Join(pluginDir, "gitspace-plugin.toml")
 
 	tree, err := toml.LoadFile(tomlPath)
@@ -152,67 +339,60 @@ func loadPluginInfo(pluginDir string) (map[string]interface{}, error) {
 		return nil, fmt.Errorf("error loading plugin TOML: %w", err)
 	}
 
-	info := make(map[string]interface{})
-
+	var section *toml.Tree
 	// Check for new format (metadata section)
 	if tree.Has("metadata") {
-		metadataInfo := tree.Get("metadata").(*toml.Tree)
-		info["version"] = metadataInfo.Get("version")
-		info["description"] = metadataInfo.Get("description")
+		section, err = getTable(tomlPath, tree, "metadata")
 	} else if tree.Has("plugin") {
 		// Old format (plugin section)
-		pluginInfo := tree.Get("plugin").(*toml.Tree)
-		info["version"] = pluginInfo.Get("version")
-		info["description"] = pluginInfo.Get("description")
+		section, err = getTable(tomlPath, tree, "plugin")
 	} else {
 		// If neither format is found, return an error
 		return nil, fmt.Errorf("invalid plugin TOML format: neither 'metadata' nor 'plugin' section found")
 	}
-
-	info["path"] = pluginDir
-
-	// Ensure we have both version and description
-	if info["version"] == nil || info["description"] == nil {
-		return nil, fmt.Errorf("plugin TOML is missing required fields (version or description)")
+	if err != nil {
+		return nil, err
 	}
 
-	return info, nil
+	entry, err := loadManifestEntry(tomlPath, tree, section, pluginDir)
+	if err != nil {
+		return nil, fmt.Errorf("plugin TOML is invalid: %w", err)
+	}
+	return &PluginEntry{Entry: entry}, nil
 }
 
-func updateTemplates(catalog *toml.Tree, repoRoot string) {
-	fmt.Println("Updating templates...")
-	templates := make(map[string]interface{})
-	templatesDir := filepath.Join(repoRoot, "templates")
-	fmt.Printf("Templates directory: %s\n", templatesDir)
+func updateTemplates(w io.Writer, catalog *Catalog, entries []discoveredEntry) {
+	fmt.Fprintln(w, "Updating templates...")
+	templates := make(map[string]*TemplateEntry)
 
-	err := filepath.Walk(templatesDir, func(path string, info os.FileInfo, err error) error {
+	for _, d := range entries {
+		if d.Kind != "templates" {
+			continue
+		}
+		fmt.Fprintf(w, "Found template %s in %s\n", d.Name, d.Dir)
+		templateInfo, err := loadTemplateInfo(d.Dir)
 		if err != nil {
-			fmt.Printf("Error accessing path %q: %v\n", path, err)
-			return nil
+			fmt.Fprintf(w, "Error loading template info for %s: %v\n", d.Name, err)
+			continue
 		}
-		if info.IsDir() && info.Name() != "templates" {
-			fmt.Printf("Found template directory: %s\n", info.Name())
-			templateInfo, err := loadTemplateInfo(path)
-			if err == nil {
-				templates[info.Name()] = templateInfo
-				fmt.Printf("Added template %s: %v\n", info.Name(), templateInfo)
-			} else {
-				fmt.Printf("Error loading template info for %s: %v\n", info.Name(), err)
-			}
+		if existing, ok := catalog.Templates[d.Name]; ok {
+			templateInfo.Extra = existing.Extra
 		}
-		return nil
-	})
-
-	if err != nil {
-		fmt.Printf("Error walking templates directory: %v\n", err)
+		templates[d.Name] = templateInfo
+		fmt.Fprintf(w, "Added template %s: %+v\n", d.Name, templateInfo.Entry)
 	}
 
-	templatesTree, _ := toml.TreeFromMap(templates)
-	catalog.Set("templates", templatesTree)
-	fmt.Printf("Updated templates: %v\n", templates)
+	catalog.Templates = templates
+	fmt.Fprintf(w, "Updated templates: %v\n", sortedKeys(templates))
 }
 
-func loadTemplateInfo(templateDir string) (map[string]interface{}, error) {
+// loadTemplateInfo reads the template entry in templateDir from its
+// gitspace-template.toml, or from a gitspace-plugin.toml if it has none. A
+// gitspace-plugin.toml next to a gitspace-template.toml is the manifest of
+// the plugin the template scaffolds, such as the [[plugin.sources]] of
+// templates/gitspace-plugin-starter, so its entry points are not the
+// template's and are ignored.
+func loadTemplateInfo(templateDir string) (*TemplateEntry, error) {
 	templateTomlPath := filepath.Join(templateDir, "gitspace-template.toml")
 	pluginTomlPath := filepath.Join(templateDir, "gitspace-plugin.toml")
 
@@ -230,139 +410,125 @@ func loadTemplateInfo(templateDir string) (map[string]interface{}, error) {
 		return nil, fmt.Errorf("error loading TOML file: %w", err)
 	}
 
-	info := make(map[string]interface{})
-
+	var section *toml.Tree
 	// Check for new format (metadata section)
 	if tree.Has("metadata") {
-		metadataInfo := tree.Get("metadata").(*toml.Tree)
-		info["version"] = metadataInfo.Get("version")
-		info["description"] = metadataInfo.Get("description")
+		section, err = getTable(tomlPath, tree, "metadata")
 	} else if tree.Has("template") {
-		templateInfo := tree.Get("template").(*toml.Tree)
-		info["version"] = templateInfo.Get("version")
-		info["description"] = templateInfo.Get("description")
+		section, err = getTable(tomlPath, tree, "template")
 	} else if tree.Has("plugin") {
-		pluginInfo := tree.Get("plugin").(*toml.Tree)
-		info["version"] = pluginInfo.Get("version")
-		info["description"] = pluginInfo.Get("description")
+		section, err = getTable(tomlPath, tree, "plugin")
 	} else {
 		return nil, fmt.Errorf("invalid TOML format: no 'metadata', 'template', or 'plugin' section found")
 	}
+	if err != nil {
+		return nil, err
+	}
 
-	info["path"] = templateDir
+	entry, err := loadManifestEntry(tomlPath, tree, section, templateDir)
+	if err != nil {
+		return nil, fmt.Errorf("TOML is invalid: %w", err)
+	}
+	return &TemplateEntry{Entry: entry}, nil
+}
+
+// loadManifestEntry reads the fields shared by plugin and template
+// manifests from their main section.
+func loadManifestEntry(tomlPath string, tree, section *toml.Tree, dir string) (Entry, error) {
+	entry := Entry{Path: dir}
 
 	// Ensure we have both version and description
-	if info["version"] == nil || info["description"] == nil {
-		return nil, fmt.Errorf("TOML is missing required fields (version or description)")
+	if !section.Has("version") || !section.Has("description") {
+		return entry, fmt.Errorf("missing required fields (version or description)")
 	}
 
-	return info, nil
-}
-
-func incrementVersion(catalog *toml.Tree) {
-	fmt.Println("Incrementing version...")
-	catalogInfo := catalog.Get("catalog").(*toml.Tree)
-	version := catalogInfo.Get("version").(string)
-	parts := strings.Split(version, ".")
-	if len(parts) == 3 {
-		patch := atoi(parts[2])
-		newVersion := fmt.Sprintf("%s.%s.%d", parts[0], parts[1], patch+1)
-		catalogInfo.Set("version", newVersion)
-		fmt.Printf("Incremented version from %s to %s\n", version, newVersion)
-	} else {
-		fmt.Printf("Invalid version format: %s\n", version)
+	var err error
+	if entry.Version, err = getString(tomlPath, "version", section, "version"); err != nil {
+		return entry, err
+	}
+	if entry.Description, err = getString(tomlPath, "description", section, "description"); err != nil {
+		return entry, err
+	}
+	if entry.Metadata, err = loadManifestMetadata(tomlPath, tree, section); err != nil {
+		return entry, err
 	}
-	catalog.Set("catalog", catalogInfo)
-}
 
-func updateLastUpdated(catalog *toml.Tree) {
-	fmt.Println("Updating last updated info...")
-	catalogInfo := catalog.Get("catalog").(*toml.Tree)
-	lastUpdated := make(map[string]interface{})
-	lastUpdated["date"] = time.Now().Format(time.RFC3339)
-	lastUpdated["commit_hash"] = getLatestCommitHash()
-	lastUpdatedTree, _ := toml.TreeFromMap(lastUpdated)
-	catalogInfo.Set("last_updated", lastUpdatedTree)
-	catalog.Set("catalog", catalogInfo)
-	fmt.Printf("Updated last updated info: %v\n", lastUpdated)
+	var minGitspace string
+	if section.Has("min_gitspace_version") {
+		if minGitspace, err = getString(tomlPath, "min_gitspace_version", section, "min_gitspace_version"); err != nil {
+			return entry, err
+		}
+	}
+	if entry.Compatibility, err = loadCompatibility(dir, minGitspace); err != nil {
+		return entry, fmt.Errorf("%s: %w", dir, err)
+	}
+	return entry, nil
 }
 
-func getLatestCommitHash() string {
-	// Implement logic to get the latest commit hash
-	return "placeholder_hash"
+// incrementVersion bumps the catalog version according to its
+// version_policy. date is the date of the commit being published.
+func incrementVersion(w io.Writer, catalog *Catalog, diff CatalogDiff, date time.Time) error {
+	fmt.Fprintln(w, "Incrementing version...")
+	policy, err := versionPolicyFor(catalog.Info.VersionPolicy)
+	if err != nil {
+		return err
+	}
+	version := catalog.Info.Version
+	newVersion, err := policy.Next(version, diff, date)
+	if err != nil {
+		return fmt.Errorf("error computing next version: %w", err)
+	}
+	if _, ok := policy.(calverPolicy); ok && !strings.HasPrefix(newVersion, date.UTC().Format("2006.01.")) {
+		fmt.Fprintf(w, "Commit date %s is before catalog version %s, keeping its month\n", date.UTC().Format(time.RFC3339), version)
+	}
+	catalog.Info.Version = newVersion
+	fmt.Fprintf(w, "Incremented version from %s to %s\n", version, newVersion)
+	return nil
 }
 
-func atoi(s string) int {
-	i := 0
-	for _, c := range s {
-		if c < '0' || c > '9' {
-			break
-		}
-		i = i*10 + int(c-'0')
+// updateLastUpdated points last_updated at head. The date is the commit
+// date of head, like the calendar version, so the block describes one
+// commit and rerunning the update gives the same catalog.
+func updateLastUpdated(w io.Writer, catalog *Catalog, head *gitCommitInfo) {
+	fmt.Fprintln(w, "Updating last updated info...")
+	catalog.Info.LastUpdated = &LastUpdated{
+		Date:       head.Date.UTC().Format(time.RFC3339),
+		CommitHash: head.Hash,
 	}
-	return i
+	fmt.Fprintf(w, "Updated last updated info: %+v\n", *catalog.Info.LastUpdated)
 }
 
-func formatTomlTree(tree *toml.Tree) string {
-	var sb strings.Builder
-
-	// Format catalog section
-	catalogTree := tree.Get("catalog").(*toml.Tree)
-	sb.WriteString("[catalog]\n")
-	for _, k := range catalogTree.Keys() {
-		v := catalogTree.Get(k)
-		if k == "last_updated" {
-			sb.WriteString(fmt.Sprintf("%s = %s\n", k, formatLastUpdated(v.(*toml.Tree))))
-		} else {
-			sb.WriteString(fmt.Sprintf("%s = %q\n", k, v))
-		}
-	}
-	sb.WriteString("\n")
-
-	// Format plugins section
-	sb.WriteString("[plugins]\n")
-	if pluginsTree := tree.Get("plugins"); pluginsTree != nil {
-		for _, plugin := range pluginsTree.(*toml.Tree).Keys() {
-			pluginInfo := pluginsTree.(*toml.Tree).Get(plugin).(*toml.Tree)
-			sb.WriteString(fmt.Sprintf("[plugins.%s]\n", plugin))
-			for _, k := range pluginInfo.Keys() {
-				v := pluginInfo.Get(k)
-				sb.WriteString(fmt.Sprintf("%s = %q\n", k, v))
-			}
-			sb.WriteString("\n")
+// updateProvenance records, for every entry, the last commit that touched
+// its directory. Entry paths must already be relative to repoRoot.
+func updateProvenance(w io.Writer, catalog *Catalog, repoRoot string) error {
+	fmt.Fprintln(w, "Updating entry provenance...")
+	update := func(name string, entry *Entry) error {
+		commit, err := gitLastCommit(repoRoot, entry.Path)
+		if err != nil {
+			return err
 		}
-	}
-
-	// Format templates section
-	sb.WriteString("[templates]\n")
-	if templatesTree := tree.Get("templates"); templatesTree != nil {
-		for _, template := range templatesTree.(*toml.Tree).Keys() {
-			templateInfo := templatesTree.(*toml.Tree).Get(template).(*toml.Tree)
-			sb.WriteString(fmt.Sprintf("[templates.%s]\n", template))
-			for _, k := range templateInfo.Keys() {
-				v := templateInfo.Get(k)
-				sb.WriteString(fmt.Sprintf("%s = %q\n", k, v))
-			}
-			sb.WriteString("\n")
+		if commit == nil {
+			fmt.Fprintf(w, "No commits found for %s, leaving provenance empty\n", name)
+			entry.CommitHash = ""
+			entry.CommitDate = ""
+			return nil
 		}
+		entry.CommitHash = commit.Hash
+		entry.CommitDate = commit.Date.Format(time.RFC3339)
+		fmt.Fprintf(w, "Provenance for %s: %s (%s)\n", name, entry.CommitHash, entry.CommitDate)
+		return nil
 	}
 
-	return sb.String()
-}
-
-func formatLastUpdated(lastUpdated *toml.Tree) string {
-	return fmt.Sprintf("{ date = %q, commit_hash = %q }",
-		lastUpdated.Get("date"),
-		lastUpdated.Get("commit_hash"))
+	return catalog.forEachEntry(update)
 }
 
-func saveCatalog(content string, path string) error {
-	fmt.Printf("Saving catalog to: %s\n", path)
-	fmt.Printf("Catalog content to be saved:\n%s\n", content)
+func saveCatalog(w io.Writer, content string, path string) error {
+	fmt.Fprintf(w, "Saving catalog to: %s\n", path)
+	fmt.Fprintf(w, "Catalog content to be saved:\n%s\n", content)
 	if content == "" {
 		return fmt.Errorf("catalog content is empty, aborting save to prevent data loss")
 	}
-	return ioutil.WriteFile(path, []byte(content), 0644)
+	return os.WriteFile(path, []byte(content), 0644)
 }
 
 func findRepoRoot(start string) string {
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpdateLastUpdatedUsesHeadCommit(t *testing.T) {
+	catalog := &Catalog{}
+	head := &gitCommitInfo{Hash: "abc123", Date: time.Date(2024, 10, 1, 12, 30, 0, 0, time.FixedZone("CEST", 2*60*60))}
+	updateLastUpdated(io.Discard, catalog, head)
+	want := LastUpdated{Date: "2024-10-01T10:30:00Z", CommitHash: "abc123"}
+	if got := *catalog.Info.LastUpdated; got != want {
+		t.Errorf("last_updated = %+v, want %+v", got, want)
+	}
+}
+
+func TestUpdateCatalogRegeneratesMissingFiles(t *testing.T) {
+	repoRoot, _ := newTestRemote(t)
+	commitTestUpdate(t, repoRoot)
+	catalogPath := filepath.Join(repoRoot, "gitspace-catalog.toml")
+	before, err := os.ReadFile(catalogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A fresh checkout of a catalog whose exports were never generated.
+	for _, file := range []string{catalogJSONFile, searchIndexFile, historyFile} {
+		if err := os.Remove(filepath.Join(repoRoot, file)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Planning reports the missing files, which fails check, without
+	// writing them.
+	update, err := planUpdate(io.Discard, repoRoot, catalogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{historyFile, searchIndexFile, catalogJSONFile}; !reflect.DeepEqual(update.Generated, want) {
+		t.Errorf("planned %q, want %q", update.Generated, want)
+	}
+	if err := update.upToDate(); err == nil || !strings.Contains(err.Error(), "generated files are out of date") {
+		t.Errorf("upToDate = %v, want an error for the missing generated files", err)
+	}
+	if _, err := os.Stat(filepath.Join(repoRoot, catalogJSONFile)); !os.IsNotExist(err) {
+		t.Errorf("planning wrote %s", catalogJSONFile)
+	}
+
+	update, err = updateCatalog(io.Discard, repoRoot, catalogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !update.Diff.Empty() {
+		t.Fatalf("entries changed:\n%s", update.Diff)
+	}
+	if want := []string{historyFile, searchIndexFile, catalogJSONFile}; !reflect.DeepEqual(update.Generated, want) {
+		t.Errorf("generated %q, want %q", update.Generated, want)
+	}
+	if !update.Changed() {
+		t.Error("update with regenerated files reports no change")
+	}
+	after, err := os.ReadFile(catalogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("catalog was rewritten although no entries changed")
+	}
+
+	// Once the files are up to date, nothing is written.
+	update, err = updateCatalog(io.Discard, repoRoot, catalogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if update.Changed() {
+		t.Errorf("second update changed %q", update.Generated)
+	}
+	if update, err = planUpdate(io.Discard, repoRoot, catalogPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := update.upToDate(); err != nil {
+		t.Errorf("upToDate of an up to date catalog: %v", err)
+	}
+}
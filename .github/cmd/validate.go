@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// runValidate checks the manifests of every discovered entry and prints
+// one line per diagnostic to w. It returns an error if any manifest has errors,
+// so callers can fail the build.
+func runValidate(w io.Writer, repoRoot string, entries []discoveredEntry) error {
+	fmt.Fprintf(w, "Validating manifests in %s\n", repoRoot)
+	diags := validateManifests(repoRoot, entries)
+
+	for _, d := range diags {
+		fmt.Fprintln(w, d)
+	}
+
+	if hasErrors(diags) {
+		return fmt.Errorf("manifest validation failed")
+	}
+	fmt.Fprintln(w, "All manifests are valid")
+	return nil
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"dagger.io/dagger"
+	"github.com/pelletier/go-toml"
+)
+
+// verificationFile is where the pipeline records the outcome of building
+// and testing every entry, relative to the repository root. It maps entry
+// keys, such as "plugins.scmtea", to their Verification.
+var verificationFile = filepath.Join(distDir, "verification.json")
+
+// The statuses of a Verification.
+const (
+	verificationPassed = "passed"
+	verificationFailed = "failed"
+)
+
+// Verification is the [<kind>.<name>.verification] table: the outcome of
+// building and testing the entry in the pipeline.
+type Verification struct {
+	// Status is verificationPassed or verificationFailed.
+	Status string `json:"status"`
+	// Go is the version of the Go toolchain the checks ran with, such as
+	// go1.23.4.
+	Go string `json:"go"`
+	// Commit is the last commit that touched the entry when it was tested.
+	Commit string `json:"commit"`
+	// Checks are the commands that ran, in order.
+	Checks []string `json:"checks"`
+	// Failed is the check that failed, the last of Checks.
+	Failed string `json:"failed,omitempty"`
+	// Output is the end of the standard error of the failed check. It
+	// varies between runs, with test timings for example, so it is only
+	// kept in verificationFile and never written to the catalog.
+	Output string `json:"output,omitempty"`
+}
+
+// maxFailureOutputLines bounds the Output of a Verification, so that a
+// failing test run does not flood the catalog.
+const maxFailureOutputLines = 40
+
+func (v Verification) fields() tomlTable {
+	var kv tomlTable
+	for _, f := range []keyValue{
+		{"status", v.Status},
+		{"go", v.Go},
+		{"commit", v.Commit},
+		{"failed", v.Failed},
+	} {
+		if f.Value != "" {
+			kv = append(kv, f)
+		}
+	}
+	if len(v.Checks) > 0 {
+		kv = append(kv, keyValue{"checks", v.Checks})
+	}
+	return kv
+}
+
+func decodeVerification(file, fullKey string, section *toml.Tree) (*Verification, error) {
+	v := &Verification{}
+	for _, f := range []struct {
+		key string
+		dst *string
+	}{
+		{"status", &v.Status},
+		{"go", &v.Go},
+		{"commit", &v.Commit},
+		{"failed", &v.Failed},
+	} {
+		if section.Has(f.key) {
+			var err error
+			if *f.dst, err = getString(file, fullKey, section, f.key); err != nil {
+				return nil, err
+			}
+		}
+	}
+	checks, err := stringArray(section, "checks")
+	if err != nil {
+		return nil, &CatalogError{File: file, Key: fullKey, Pos: section.GetPositionPath([]string{"checks"}), Err: err}
+	}
+	v.Checks = checks
+	return v, nil
+}
+
+// readVerifications reads the verification file of repoRoot. A missing
+// file means no entry was verified in this run.
+func readVerifications(repoRoot string) (map[string]Verification, error) {
+	content, err := os.ReadFile(filepath.Join(repoRoot, verificationFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", verificationFile, err)
+	}
+	var results map[string]Verification
+	if err := json.Unmarshal(content, &results); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", verificationFile, err)
+	}
+	return results, nil
+}
+
+// writeVerifications saves results to the verification file of repoRoot.
+func writeVerifications(w io.Writer, repoRoot string, results map[string]Verification) error {
+	content, err := encodeJSON(results)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(repoRoot, verificationFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Writing verification results to %s\n", path)
+	return os.WriteFile(path, content, 0644)
+}
+
+// updateVerification records the verification file of repoRoot in the
+// entries of this repository. When an entry was not verified in this run,
+// its previous verification is kept as long as its digest did not change,
+// and dropped otherwise since it no longer matches its sources.
+func updateVerification(w io.Writer, catalog, previous *Catalog, repoRoot string) error {
+	fmt.Fprintln(w, "Updating entry verification...")
+	results, err := readVerifications(repoRoot)
+	if err != nil {
+		return err
+	}
+	old := catalogEntries(previous)
+	return catalog.forEachEntry(func(key string, entry *Entry) error {
+		if v, ok := results[key]; ok {
+			v.Output = ""
+			entry.Verification = &v
+			fmt.Fprintf(w, "Verification of %s: %s\n", key, v.Status)
+			return nil
+		}
+		entry.Verification = nil
+		if o, ok := old[key]; ok && o.Digest == entry.Digest {
+			entry.Verification = o.Verification
+		}
+		if entry.Verification != nil {
+			fmt.Fprintf(w, "%s was not verified in this run, keeping its previous verification\n", key)
+		}
+		return nil
+	})
+}
+
+// checkVerifiedVersions refuses an update that adds or bumps the version
+// of an entry that did not pass verification, because it failed or has no
+// verification at all. Entries merged from an include are left to the
+// pipeline of their origin, which gates its own publishing.
+func checkVerifiedVersions(update *catalogUpdate) error {
+	var failures []string
+	for _, c := range update.Diff.Changes {
+		if c.New == nil || c.New.Origin != "" || (c.Old != nil && c.Old.Version == c.New.Version) {
+			continue
+		}
+		v := c.New.Verification
+		switch {
+		case v == nil:
+			failures = append(failures, fmt.Sprintf("%s %s: not verified", c.Key, c.New.Version))
+		case v.Status == verificationFailed:
+			failures = append(failures, fmt.Sprintf("%s %s: %s failed", c.Key, c.New.Version, v.Failed))
+		case v.Status != verificationPassed:
+			failures = append(failures, fmt.Sprintf("%s %s: unknown verification status %q", c.Key, c.New.Version, v.Status))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("refusing to publish new versions that did not pass verification:\n  %s", strings.Join(failures, "\n  "))
+	}
+	return nil
+}
+
+// checkCommittedVersions applies checkVerifiedVersions to the catalog at
+// catalogPath, compared with the catalog committed at HEAD of repoRoot,
+// the commit it was updated on.
+func checkCommittedVersions(repoRoot, catalogPath string) error {
+	catalog, err := readCatalog(catalogPath)
+	if err != nil {
+		return fmt.Errorf("error reading catalog: %w", err)
+	}
+	treePath, err := catalogTreePath(repoRoot, catalogPath)
+	if err != nil {
+		return err
+	}
+	previous := newCatalog()
+	blob, err := gitRevParse(repoRoot, "HEAD:"+treePath)
+	if err != nil {
+		return err
+	}
+	if blob != "" {
+		content, err := runGit(context.Background(), repoRoot, nil, "", "cat-file", "blob", blob)
+		if err != nil {
+			return fmt.Errorf("error reading %s at HEAD: %w", treePath, err)
+		}
+		if previous, err = parseCatalog(treePath, []byte(content)); err != nil {
+			return fmt.Errorf("error parsing %s at HEAD: %w", treePath, err)
+		}
+	}
+	return checkVerifiedVersions(&catalogUpdate{CatalogPath: catalogPath, Previous: previous, Catalog: catalog, Diff: diffCatalogs(previous, catalog)})
+}
+
+// verificationChecks returns the commands that verify e: the Go build, vet
+// and tests of a Go module, then the build and test commands its manifest
+// declares.
+func verificationChecks(e pipelineEntry) [][]string {
+	var checks [][]string
+	if e.GoModule {
+		checks = append(checks,
+			[]string{"go", "build", "./..."},
+			[]string{"go", "vet", "./..."},
+			[]string{"go", "test", "./..."})
+	}
+	for _, name := range []string{"build", "test"} {
+		if command := e.Commands[name]; command != "" {
+			checks = append(checks, []string{"sh", "-c", command})
+		}
+	}
+	return checks
+}
+
+// checkName is how a check is recorded in a Verification.
+func checkName(args []string) string {
+	if len(args) == 3 && args[0] == "sh" && args[1] == "-c" {
+		return args[2]
+	}
+	return strings.Join(args, " ")
+}
+
+// failureOutput returns the last maxFailureOutputLines lines of the
+// standard error of a failed check, or of its standard output when it
+// wrote nothing to standard error.
+func failureOutput(err error) string {
+	var execErr *dagger.ExecError
+	if !errors.As(err, &execErr) {
+		return err.Error()
+	}
+	output := strings.TrimRight(execErr.Stderr, "\n")
+	if output == "" {
+		output = strings.TrimRight(execErr.Stdout, "\n")
+	}
+	lines := strings.Split(output, "\n")
+	if len(lines) > maxFailureOutputLines {
+		lines = lines[len(lines)-maxFailureOutputLines:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// verifyEntry builds and tests e in a container with the commands of
+// verificationChecks, stopping at the first that fails. A failing check
+// is reported in the returned Verification, not as an error. An entry with
+// nothing to check passes with no checks.
+func (s *daggerSteps) verifyEntry(ctx context.Context, e pipelineEntry) (*Verification, error) {
+	commit, err := gitLastCommit(s.repoRoot, e.Dir)
+	if err != nil {
+		return nil, err
+	}
+	v := &Verification{Status: verificationPassed}
+	if commit != nil {
+		v.Commit = commit.Hash
+	}
+	checks := verificationChecks(e)
+	if len(checks) == 0 {
+		fmt.Fprintf(s.progress, "Nothing to verify for %s: no go.mod and no build or test command\n", e.Key())
+		return v, nil
+	}
+
+	// Declared commands may build with cgo, such as Go plugins do.
+	c := s.entryContainer(e).WithoutEnvVariable("CGO_ENABLED")
+	goVersion, err := c.WithExec([]string{"go", "env", "GOVERSION"}).Stdout(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the Go version for %s: %w", e.Key(), err)
+	}
+	v.Go = strings.TrimSpace(goVersion)
+
+	for _, args := range checks {
+		name := checkName(args)
+		fmt.Fprintf(s.progress, "Verifying %s: %s\n", e.Key(), name)
+		v.Checks = append(v.Checks, name)
+		c = c.WithExec(args)
+		output, err := c.Stdout(ctx)
+		fmt.Fprint(s.progress, output)
+		if err != nil {
+			fmt.Fprintf(s.progress, "Verification of %s failed at %s: %v\n", e.Key(), name, err)
+			v.Status = verificationFailed
+			v.Failed = name
+			v.Output = failureOutput(err)
+			return v, nil
+		}
+	}
+	fmt.Fprintf(s.progress, "Verification of %s passed with %s\n", e.Key(), v.Go)
+	return v, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"dagger.io/dagger"
+)
+
+const verifiedCatalog = `[catalog]
+name = "test"
+version = "1.0.0"
+
+[plugins]
+
+[plugins.scmtea]
+version = "1.1.0"
+description = "scmtea"
+path = "plugins/scmtea"
+digest = "sha256:new"
+
+[plugins.scmtea.verification]
+status = "failed"
+go = "go1.23.4"
+commit = "abc123"
+failed = "go test ./..."
+checks = ["go build ./...", "go vet ./...", "go test ./..."]
+
+[templates]
+`
+
+func TestVerificationRoundTrips(t *testing.T) {
+	catalog, formatted := roundTrip(t, "verified", []byte(verifiedCatalog))
+	want := &Verification{
+		Status: verificationFailed,
+		Go:     "go1.23.4",
+		Commit: "abc123",
+		Checks: []string{"go build ./...", "go vet ./...", "go test ./..."},
+		Failed: "go test ./...",
+	}
+	if got := catalog.Plugins["scmtea"].Verification; !reflect.DeepEqual(got, want) {
+		t.Errorf("verification = %#v, want %#v", got, want)
+	}
+	if !strings.Contains(formatted, "[plugins.scmtea.verification]") {
+		t.Errorf("verification table not written:\n%s", formatted)
+	}
+}
+
+func TestUpdateVerificationKeepsUnchangedEntries(t *testing.T) {
+	repoRoot := t.TempDir()
+	passed := &Verification{Status: verificationPassed, Go: "go1.23.4", Commit: "old"}
+	previous := &Catalog{
+		Plugins: map[string]*PluginEntry{
+			"same":    {Entry{Digest: "sha256:a", Verification: passed}},
+			"changed": {Entry{Digest: "sha256:b", Verification: passed}},
+		},
+		Templates: map[string]*TemplateEntry{
+			"verified": {Entry{Digest: "sha256:c", Verification: passed}},
+		},
+	}
+	catalog := previous.clone()
+	catalog.Plugins["changed"].Digest = "sha256:d"
+	results := map[string]Verification{
+		"templates.verified": {Status: verificationFailed, Go: "go1.23.4", Commit: "new", Failed: "sh test.sh", Output: "--- FAIL: TestPlugin (0.01s)"},
+	}
+	if err := writeVerifications(io.Discard, repoRoot, results); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := updateVerification(io.Discard, catalog, previous, repoRoot); err != nil {
+		t.Fatal(err)
+	}
+	if got := catalog.Plugins["same"].Verification; got != passed {
+		t.Errorf("unchanged entry lost its verification: %#v", got)
+	}
+	if got := catalog.Plugins["changed"].Verification; got != nil {
+		t.Errorf("changed entry kept a stale verification: %#v", got)
+	}
+	if got := catalog.Templates["verified"].Verification; got == nil || got.Commit != "new" {
+		t.Errorf("verified entry = %#v, want the result of this run", got)
+	} else if got.Output != "" {
+		t.Errorf("verified entry kept the check output %q, which varies between runs", got.Output)
+	}
+}
+
+func TestCheckVerifiedVersions(t *testing.T) {
+	failed := &Verification{Status: verificationFailed, Failed: "go test ./..."}
+	passed := &Verification{Status: verificationPassed}
+	for _, tc := range []struct {
+		name    string
+		old     *Entry
+		new     *Entry
+		refused bool
+	}{
+		{"bump failed", &Entry{Version: "1.0.0"}, &Entry{Version: "1.1.0", Verification: failed}, true},
+		{"new entry failed", nil, &Entry{Version: "1.0.0", Verification: failed}, true},
+		{"bump passed", &Entry{Version: "1.0.0"}, &Entry{Version: "1.1.0", Verification: passed}, false},
+		{"bump unverified", &Entry{Version: "1.0.0"}, &Entry{Version: "1.1.0"}, true},
+		{"new entry unverified", nil, &Entry{Version: "1.0.0"}, true},
+		{"bump unknown status", &Entry{Version: "1.0.0"}, &Entry{Version: "1.1.0", Verification: &Verification{Status: "skipped"}}, true},
+		{"same version unverified", &Entry{Version: "1.0.0"}, &Entry{Version: "1.0.0"}, false},
+		{"included entry", nil, &Entry{Version: "1.0.0", Origin: "official"}, false},
+		{"included bump", &Entry{Version: "1.0.0", Origin: "official"}, &Entry{Version: "1.1.0", Origin: "official"}, false},
+		{"same version failed", &Entry{Version: "1.0.0"}, &Entry{Version: "1.0.0", Verification: failed}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			change := EntryChange{Key: "plugins.scmtea", Type: ChangeUpdated, Old: tc.old, New: tc.new}
+			if tc.old == nil {
+				change.Type = ChangeAdded
+			}
+			update := &catalogUpdate{Diff: CatalogDiff{Changes: []EntryChange{change}}}
+			err := checkVerifiedVersions(update)
+			if (err != nil) != tc.refused {
+				t.Errorf("checkVerifiedVersions() = %v, want refused %v", err, tc.refused)
+			}
+		})
+	}
+}
+
+func TestFailureOutput(t *testing.T) {
+	var stderr strings.Builder
+	for i := 1; i <= maxFailureOutputLines+10; i++ {
+		fmt.Fprintf(&stderr, "line %d\n", i)
+	}
+	err := &dagger.ExecError{Stdout: "ok\n", Stderr: stderr.String()}
+	lines := strings.Split(failureOutput(err), "\n")
+	if len(lines) != maxFailureOutputLines || lines[0] != "line 11" || lines[len(lines)-1] != "line 50" {
+		t.Errorf("failureOutput() kept lines %q to %q (%d), want the last %d", lines[0], lines[len(lines)-1], len(lines), maxFailureOutputLines)
+	}
+
+	// Without standard error, the standard output is kept.
+	if got := failureOutput(&dagger.ExecError{Stdout: "--- FAIL: TestPlugin\n"}); got != "--- FAIL: TestPlugin" {
+		t.Errorf("failureOutput() = %q, want the standard output", got)
+	}
+}
+
+func TestVerificationChecks(t *testing.T) {
+	e := pipelineEntry{GoModule: true, Commands: map[string]string{"test": "sh test.sh", "build": "sh build.sh", "lint": "make lint"}}
+	var got []string
+	for _, args := range verificationChecks(e) {
+		got = append(got, checkName(args))
+	}
+	want := []string{"go build ./...", "go vet ./...", "go test ./...", "sh build.sh", "sh test.sh"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("checks = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// runVerify recomputes the digest of every catalog entry from the checkout
+// at checkoutRoot and compares it with the digest recorded in the catalog
+// at catalogPath. It returns an error if any entry is missing, has no
+// recorded digest, or does not match. Entries merged from included
+// catalogs are skipped; verify them against their own checkout.
+func runVerify(w io.Writer, catalogPath, checkoutRoot string) error {
+	fmt.Fprintf(w, "Verifying %s against %s\n", catalogPath, checkoutRoot)
+	catalog, err := loadCatalog(w, catalogPath)
+	if err != nil {
+		return fmt.Errorf("error loading catalog: %w", err)
+	}
+
+	failures := 0
+	err = catalog.forEachEntry(func(key string, entry *Entry) error {
+		if entry.Origin != "" {
+			fmt.Fprintf(w, "skip %s: included from %s\n", key, entry.Origin)
+			return nil
+		}
+		if entry.Digest == "" {
+			fmt.Fprintf(w, "FAIL %s: no digest recorded\n", key)
+			failures++
+			return nil
+		}
+		actual, err := computeDigest(filepath.Join(checkoutRoot, entry.Path), entryName(key))
+		if err != nil {
+			fmt.Fprintf(w, "FAIL %s: %v\n", key, err)
+			failures++
+			return nil
+		}
+		if actual != entry.Digest {
+			fmt.Fprintf(w, "FAIL %s: digest mismatch\n  catalog:  %s\n  checkout: %s\n", key, entry.Digest, actual)
+			failures++
+			return nil
+		}
+		fmt.Fprintf(w, "ok   %s %s\n", key, actual)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("%d catalog entries failed verification", failures)
+	}
+	fmt.Fprintln(w, "All catalog entries verified")
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultVersionPolicy = "semver"
+
+// VersionPolicy computes the next catalog version. It is selected with
+// version_policy in the [catalog] section.
+type VersionPolicy interface {
+	// Next returns the version that follows current, given the entry
+	// changes being published and the date of the commit they come from.
+	Next(current string, diff CatalogDiff, date time.Time) (string, error)
+}
+
+var versionPolicies = map[string]VersionPolicy{
+	"semver": semverPolicy{},
+	"calver": calverPolicy{},
+}
+
+func versionPolicyFor(name string) (VersionPolicy, error) {
+	if name == "" {
+		name = defaultVersionPolicy
+	}
+	policy, ok := versionPolicies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown version_policy %q (expected one of: %s)", name, strings.Join(sortedKeys(versionPolicies), ", "))
+	}
+	return policy, nil
+}
+
+// semverPolicy bumps MAJOR when an entry is removed, MINOR when an entry
+// is added and PATCH for any other change, such as a new entry version.
+type semverPolicy struct{}
+
+func (semverPolicy) Next(current string, diff CatalogDiff, _ time.Time) (string, error) {
+	v, err := parseSemver(current)
+	if err != nil {
+		return "", err
+	}
+
+	removed, added := false, false
+	for _, c := range diff.Changes {
+		switch c.Type {
+		case ChangeRemoved:
+			removed = true
+		case ChangeAdded:
+			added = true
+		}
+	}
+
+	next := Semver{Major: v.Major, Minor: v.Minor, Patch: v.Patch}
+	switch {
+	case removed:
+		next = Semver{Major: v.Major + 1}
+	case added:
+		next = Semver{Major: v.Major, Minor: v.Minor + 1}
+	default:
+		next.Patch++
+	}
+	return next.String(), nil
+}
+
+// calverPolicy uses YYYY.MM.N versions, where YYYY.MM is taken from the
+// commit date and N counts the releases within that month, starting at 1.
+// A commit dated before the current version's month, such as a rebased
+// one, continues the current month so that versions never go backwards.
+type calverPolicy struct{}
+
+func (calverPolicy) Next(current string, _ CatalogDiff, date time.Time) (string, error) {
+	invalid := fmt.Errorf("%q is not a calendar version (expected YYYY.MM.N)", current)
+	parts := strings.Split(current, ".")
+	if len(parts) != 3 {
+		return "", invalid
+	}
+	var numbers [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", invalid, err)
+		}
+		numbers[i] = n
+	}
+	year, month, n := numbers[0], numbers[1], numbers[2]
+
+	date = date.UTC()
+	if date.Year() > year || date.Year() == year && int(date.Month()) > month {
+		return fmt.Sprintf("%04d.%02d.1", date.Year(), int(date.Month())), nil
+	}
+	return fmt.Sprintf("%04d.%02d.%d", year, month, n+1), nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSemverPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		changes []ChangeType
+		want    string
+	}{
+		{"updated", []ChangeType{ChangeUpdated}, "1.2.4"},
+		{"added", []ChangeType{ChangeUpdated, ChangeAdded}, "1.3.0"},
+		{"removed", []ChangeType{ChangeAdded, ChangeRemoved}, "2.0.0"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var diff CatalogDiff
+			for _, typ := range tc.changes {
+				diff.Changes = append(diff.Changes, EntryChange{Key: "plugins.scmtea", Type: typ})
+			}
+			got, err := semverPolicy{}.Next("1.2.3", diff, time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("Next = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCalverPolicy(t *testing.T) {
+	date := func(year int, month time.Month) time.Time {
+		return time.Date(year, month, 15, 12, 0, 0, 0, time.UTC)
+	}
+	for _, tc := range []struct {
+		name    string
+		current string
+		date    time.Time
+		want    string
+	}{
+		{"same month", "2024.10.3", date(2024, time.October), "2024.10.4"},
+		{"next month", "2024.10.3", date(2024, time.November), "2024.11.1"},
+		{"next year", "2024.12.7", date(2025, time.January), "2025.01.1"},
+		{"earlier month", "2024.10.3", date(2024, time.September), "2024.10.4"},
+		{"earlier year", "2024.01.2", date(2023, time.December), "2024.01.3"},
+		{"from semver", "0.1.0", date(2024, time.October), "2024.10.1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := calverPolicy{}.Next(tc.current, CatalogDiff{}, tc.date)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("Next(%s) = %s, want %s", tc.current, got, tc.want)
+			}
+		})
+	}
+	if _, err := (calverPolicy{}).Next("2024.10", CatalogDiff{}, date(2024, time.October)); err == nil {
+		t.Error("Next accepted a version without a release number")
+	}
+}
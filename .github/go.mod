@@ -7,6 +7,9 @@ require (
 	github.com/bradleyfalzon/ghinstallation/v2 v2.11.0
 	github.com/google/go-github/v45 v45.2.0
 	github.com/pelletier/go-toml v1.9.5
+	github.com/ssotops/gitspace-catalog/catalogsig v0.0.0
+	golang.org/x/mod v0.13.0
+	golang.org/x/sync v0.4.0
 )
 
 require (
@@ -20,6 +23,8 @@ require (
 	github.com/vektah/gqlparser/v2 v2.5.6 // indirect
 	golang.org/x/crypto v0.0.0-20210817164053-32db794688a5 // indirect
 	golang.org/x/exp v0.0.0-20231006140011-7918f672742d // indirect
-	golang.org/x/sync v0.4.0 // indirect
 	golang.org/x/sys v0.13.0 // indirect
 )
+
+// catalogsig is a separate module so that clients can import it.
+replace github.com/ssotops/gitspace-catalog/catalogsig => ../catalogsig
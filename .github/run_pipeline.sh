@@ -1,2 +1,2 @@
 #!/bin/bash
-go run ./cmd/*.go
+go run ./cmd
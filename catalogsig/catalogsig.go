@@ -0,0 +1,320 @@
+// Package catalogsig signs a gitspace catalog and verifies it, together
+// with the plugin artifacts it records, against a pinned ed25519 public
+// key.
+//
+// The catalog pipeline signs the catalog files after every update and
+// writes the detached signature next to them as gitspace-catalog.sig.
+// Clients such as the gitspace CLI pin the public key and call Verify on
+// the downloaded catalog directory, then VerifyArtifacts on the plugin
+// packages they download.
+//
+// The package lives in its own module, outside .github, because Go module
+// paths may not contain an element starting with a dot.
+package catalogsig
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// FileName is the detached signature of the catalog files, written
+	// next to gitspace-catalog.toml.
+	FileName = "gitspace-catalog.sig"
+
+	// Algorithm is the only supported signature algorithm.
+	Algorithm = "ed25519"
+
+	// SchemaVersion is the layout version of the signature file.
+	SchemaVersion = 1
+
+	// payloadHeader starts the signed payload, so that a signature cannot
+	// be mistaken for one over some other message.
+	payloadHeader = "gitspace-catalog-signature-v1\n"
+)
+
+// ErrInvalidSignature is returned by Verify when the signature does not
+// verify with the public key.
+var ErrInvalidSignature = errors.New("invalid catalog signature")
+
+// Signature is the layout of gitspace-catalog.sig.
+type Signature struct {
+	SchemaVersion int    `json:"schema_version"`
+	Algorithm     string `json:"algorithm"`
+	// KeyID identifies the public key that verifies the signature, see
+	// KeyID.
+	KeyID string `json:"key_id"`
+	// Files maps the signed file names to their sha256.
+	Files map[string]string `json:"files"`
+	// Signature is the base64 encoded signature of the payload of Files.
+	Signature string `json:"signature"`
+}
+
+// payload is the message that is signed: the header followed by one
+// "<sha256>  <file>" line per file in name order, the format of
+// sha256sum.
+func payload(files map[string]string) []byte {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b bytes.Buffer
+	b.WriteString(payloadHeader)
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s  %s\n", files[name], name)
+	}
+	return b.Bytes()
+}
+
+// KeyID is the first 16 hex digits of the sha256 of the public key.
+func KeyID(publicKey ed25519.PublicKey) string {
+	sum := sha256.Sum256(publicKey)
+	return hex.EncodeToString(sum[:8])
+}
+
+// GenerateKey creates a new key pair and returns the base64 encoded seed
+// and public key.
+func GenerateKey() (seed, publicKey string, err error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(private.Seed()), base64.StdEncoding.EncodeToString(public), nil
+}
+
+// ParsePrivateKey reads an ed25519 private key, either a PEM "PRIVATE KEY"
+// block as written by `openssl genpkey -algorithm ed25519`, or a base64
+// encoded 32 byte seed as returned by GenerateKey.
+func ParsePrivateKey(text string) (ed25519.PrivateKey, error) {
+	if block, _ := pem.Decode([]byte(text)); block != nil {
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing signing key: %w", err)
+		}
+		private, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("signing key is a %T, expected an ed25519 key", key)
+		}
+		return private, nil
+	}
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+	if err != nil {
+		return nil, fmt.Errorf("signing key is neither PEM nor base64: %w", err)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("signing key has %d bytes, expected a %d byte seed", len(seed), ed25519.SeedSize)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// ParsePublicKey reads an ed25519 public key, either a PEM "PUBLIC KEY"
+// block or 32 base64 encoded bytes.
+func ParsePublicKey(text string) (ed25519.PublicKey, error) {
+	if block, _ := pem.Decode([]byte(text)); block != nil {
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing public key: %w", err)
+		}
+		public, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("public key is a %T, expected an ed25519 key", key)
+		}
+		return public, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+	if err != nil {
+		return nil, fmt.Errorf("public key is neither PEM nor base64: %w", err)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key has %d bytes, expected %d", len(raw), ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// HashFile returns the hex encoded sha256 of the file at path.
+func HashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("error hashing %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Sign signs the files in dir named required, which must exist, and
+// optional, which are signed when present. ed25519 signatures are
+// deterministic, so signing unchanged files with the same key gives the
+// same signature.
+func Sign(dir, required string, optional []string, key ed25519.PrivateKey) (*Signature, error) {
+	files := make(map[string]string)
+	for _, name := range append([]string{required}, optional...) {
+		sum, err := HashFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) && name != required {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error hashing signed files: %w", err)
+		}
+		files[name] = sum
+	}
+	public := key.Public().(ed25519.PublicKey)
+	return &Signature{
+		SchemaVersion: SchemaVersion,
+		Algorithm:     Algorithm,
+		KeyID:         KeyID(public),
+		Files:         files,
+		Signature:     base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload(files))),
+	}, nil
+}
+
+// Write saves the signature to FileName in dir.
+func (s *Signature) Write(dir string) error {
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, FileName), append(content, '\n'), 0644)
+}
+
+// Read loads the signature in dir.
+func Read(dir string) (*Signature, error) {
+	content, err := os.ReadFile(filepath.Join(dir, FileName))
+	if err != nil {
+		return nil, fmt.Errorf("error reading catalog signature: %w", err)
+	}
+	var sig Signature
+	if err := json.Unmarshal(content, &sig); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", FileName, err)
+	}
+	return &sig, nil
+}
+
+// Check verifies the signature itself with publicKey and that it covers
+// required. It does not read the signed files; see Verify.
+func (s *Signature) Check(required string, publicKey ed25519.PublicKey) error {
+	if s.Algorithm != Algorithm {
+		return fmt.Errorf("unsupported signature algorithm %q", s.Algorithm)
+	}
+	if keyID := KeyID(publicKey); s.KeyID != keyID {
+		return fmt.Errorf("catalog is signed with key %s, expected key %s", s.KeyID, keyID)
+	}
+	signature, err := base64.StdEncoding.DecodeString(s.Signature)
+	if err != nil {
+		return fmt.Errorf("error decoding signature: %w", err)
+	}
+	if !ed25519.Verify(publicKey, payload(s.Files), signature) {
+		return ErrInvalidSignature
+	}
+	if _, ok := s.Files[required]; !ok {
+		return fmt.Errorf("signature does not cover %s", required)
+	}
+	return nil
+}
+
+// Verify checks the signature in dir against the pinned publicKey, that it
+// covers the catalog file named required, and that every signed file in
+// dir still has the signed sha256. It returns the verified signature.
+func Verify(dir, required string, publicKey ed25519.PublicKey) (*Signature, error) {
+	sig, err := Read(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := sig.Check(required, publicKey); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(sig.Files))
+	for name := range sig.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var mismatches []string
+	for _, name := range names {
+		actual, err := HashFile(filepath.Join(dir, name))
+		if err != nil {
+			mismatches = append(mismatches, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		if actual != sig.Files[name] {
+			mismatches = append(mismatches, fmt.Sprintf("%s: sha256 %s, signed %s", name, actual, sig.Files[name]))
+		}
+	}
+	if len(mismatches) > 0 {
+		return nil, fmt.Errorf("signed files do not match:\n  %s", strings.Join(mismatches, "\n  "))
+	}
+	return sig, nil
+}
+
+// ArtifactResult is the outcome of checking one downloaded artifact.
+type ArtifactResult struct {
+	Plugin string
+	Name   string
+	// SHA256 is the hash of the downloaded file, empty if it could not be
+	// read.
+	SHA256 string
+	// Err is nil when the artifact matches the catalog.
+	Err error
+}
+
+// VerifyArtifacts checks the plugin packages found in distRoot, laid out
+// as <plugin>/<artifact>, against recorded, which maps plugin names to
+// artifact names to the sha256 the verified catalog records for them.
+// Artifacts that were not downloaded are skipped, but a package without a
+// record fails, as does any mismatch. It returns one result per package
+// found, in name order, and an error if any of them failed.
+func VerifyArtifacts(distRoot string, recorded map[string]map[string]string) ([]ArtifactResult, error) {
+	plugins := make([]string, 0, len(recorded))
+	for name := range recorded {
+		plugins = append(plugins, name)
+	}
+	sort.Strings(plugins)
+
+	var results []ArtifactResult
+	failures := 0
+	for _, plugin := range plugins {
+		found, err := filepath.Glob(filepath.Join(distRoot, plugin, "*"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(found)
+		for _, path := range found {
+			r := ArtifactResult{Plugin: plugin, Name: filepath.Base(path)}
+			want, ok := recorded[plugin][r.Name]
+			if r.SHA256, r.Err = HashFile(path); r.Err == nil {
+				switch {
+				case !ok:
+					r.Err = errors.New("not in the catalog")
+				case r.SHA256 != want:
+					r.Err = fmt.Errorf("sha256 mismatch: catalog %s, artifact %s", want, r.SHA256)
+				}
+			}
+			if r.Err != nil {
+				failures++
+			}
+			results = append(results, r)
+		}
+	}
+	if failures > 0 {
+		return results, fmt.Errorf("%d artifacts failed verification", failures)
+	}
+	return results, nil
+}
@@ -0,0 +1,3 @@
+module github.com/ssotops/gitspace-catalog/catalogsig
+
+go 1.23
@@ -24,7 +24,7 @@ setup_plugin_dependencies() {
     (
         cd "$plugin_dir"
         if [ ! -f "go.mod" ]; then
-            go mod init github.com/ssotops/gitspace-catalog/plugins/$plugin_name
+            go mod init github.com/ssotops/gitspace-catalog/plugins/$(basename "$plugin_dir")
         fi
         go get github.com/ssotops/gitspace-plugin-sdk@latest
         go get github.com/charmbracelet/huh@latest
@@ -92,26 +92,37 @@ setup_nodejs_env() {
 
 # Function to update root .gitignore
 update_gitignore() {
-    local plugin_name="$1"
+    local plugin_dir="$1"
+    local plugin_name="$2"
     local gitignore_file="$(git rev-parse --show-toplevel)/.gitignore"
     
     # Create .gitignore if it doesn't exist
     touch "$gitignore_file"
     
     # Check if the binary is already in .gitignore
-    if ! grep -q "^plugins/$plugin_name/$plugin_name$" "$gitignore_file"; then
-        echo "plugins/$plugin_name/$plugin_name" >> "$gitignore_file"
+    if ! grep -q "^plugins/$plugin_dir/$plugin_name$" "$gitignore_file"; then
+        echo "plugins/$plugin_dir/$plugin_name" >> "$gitignore_file"
         log "Added $plugin_name binary to root .gitignore"
     else
         log "$plugin_name binary already in root .gitignore"
     fi
 }
 
+# Function to read the plugin name from its manifest, which the catalog
+# keys the plugin by; falls back to the directory name
+manifest_name() {
+    local plugin_dir="$1"
+    local name
+    name=$(sed -n 's/^name *= *"\(.*\)"/\1/p' "$plugin_dir/gitspace-plugin.toml" 2>/dev/null | head -n 1)
+    echo "${name:-$(basename "$plugin_dir")}"
+}
+
 # Build all plugins in the catalog
 build_plugins() {
     for plugin_dir in */; do
         if [ -d "$plugin_dir" ]; then
-            plugin_name=${plugin_dir%/}
+            plugin_dir=${plugin_dir%/}
+            plugin_name=$(manifest_name "$plugin_dir")
             log "Setting up dependencies for plugin: $plugin_name"
             setup_plugin_dependencies "$plugin_dir" "$plugin_name"
             
@@ -122,7 +133,7 @@ build_plugins() {
                 if [ $? -eq 0 ]; then
                     success "Plugin $plugin_name built successfully."
                     install_plugin "$plugin_name" "$PWD"
-                    update_gitignore "$plugin_name"
+                    update_gitignore "$plugin_dir" "$plugin_name"
                 else
                     error "Failed to build plugin $plugin_name."
                     exit 1
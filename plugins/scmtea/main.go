@@ -26,6 +26,9 @@ import (
 //go:embed default-docker-compose.yaml
 var defaultComposeFile embed.FS
 
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "1.0.0"
+
 const (
 	pluginDataDir          = "/.ssot/gitspace/plugins/data/scmtea"
 	composeFileName        = "docker-compose.yaml"
@@ -49,7 +52,7 @@ func (p *ScmteaPlugin) GetPluginInfo(req *pb.PluginInfoRequest) (*pb.PluginInfo,
 	log.Info("GetPluginInfo called")
 	return &pb.PluginInfo{
 		Name:    "Scmtea Plugin",
-		Version: "1.0.0",
+		Version: version,
 	}, nil
 }
 